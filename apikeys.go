@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/validate"
+	"github.com/gorilla/mux"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"Name" validate:"required,max=100"`
+	Scopes        []string `json:"Scopes"`
+	ExpiresInDays int      `json:"ExpiresInDays"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey db.APIKey `json:"APIKey"`
+	//Key is only ever shown here, only its hash is kept
+	Key string `json:"Key"`
+}
+
+type GetAPIKeysResponse struct {
+	APIKeys []db.APIKey `json:"APIKeys"`
+}
+
+func createAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "createAPIKeyHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var createReq CreateAPIKeyRequest
+	err := dec.Decode(&createReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	errs := validate.Struct(&createReq)
+	if len(createReq.Scopes) == 0 {
+		errs.Add("Scopes", "Scopes should not be empty")
+	}
+	for _, scope := range createReq.Scopes {
+		if !db.IsValidScope(scope) {
+			errs.Add("Scopes", "Scope %s should be one of %s, %s, %s, %s or %s", scope, db.ScopeRead, db.ScopePostsWrite, db.ScopeCommentsWrite, db.ScopeCommentsModerate, db.ScopeAdmin)
+		}
+	}
+	if createReq.ExpiresInDays < 0 {
+		errs.Add("ExpiresInDays", "ExpiresInDays should not be negative")
+	}
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	apiKey, key, err := db.CreateAPIKey(req.Context(), currentDB(req), auditActor(req), createReq.Name, createReq.Scopes, time.Duration(createReq.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error creating API key"))
+		return
+	}
+
+	log(req.Context(), funcname, "Created API key", apiKey.ID, "with scopes", apiKey.Scopes)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: CreateAPIKeyResponse{APIKey: *apiKey, Key: key}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func getAPIKeysHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAPIKeysHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	apiKeys, err := db.GetAPIKeys(req.Context(), currentDB(req))
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting API keys"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(apiKeys), "API keys")
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetAPIKeysResponse{APIKeys: apiKeys}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func revokeAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "revokeAPIKeyHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(req)
+	keyID := params["keyID"]
+	exists, err := db.RevokeAPIKey(req.Context(), currentDB(req), auditActor(req), keyID)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error revoking API key"))
+		return
+	}
+	if !exists {
+		err = fmt.Errorf("API key %s not found", keyID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	log(req.Context(), funcname, "Revoked API key", keyID)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: "OK"})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/gorilla/mux"
+)
+
+type expectedResponseCreateAPIKey struct {
+	Data  CreateAPIKeyResponse
+	Error string
+}
+
+func Test_APIKeyScopes(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	_, err := db.RegisterAPIKey(context.Background(), inMemDB, db.SystemActor, "bootstrap admin", "eak_admin", []string{db.ScopeAdmin}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(apiKeyMiddleware)
+	r.Handle("/blog", server.bearerAuthMiddleware(requireScope(db.ScopePostsWrite, http.HandlerFunc(createBlogPostHandler)))).Methods(http.MethodPost)
+	r.Handle("/admin/apikeys", requireAdmin(http.HandlerFunc(createAPIKeyHandler))).Methods(http.MethodPost)
+	r.Handle("/admin/apikeys/{keyID}", requireAdmin(http.HandlerFunc(revokeAPIKeyHandler))).Methods(http.MethodDelete)
+
+	mint := func(apiKey, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/admin/apikeys", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := mint("", "{\"Name\":\"Review Importer\",\"Scopes\":[\"read\"]}")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d minting without a key, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	rec = mint("eak_admin", "{\"Name\":\"Review Importer\",\"Scopes\":[\"everything\"]}")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an unknown scope, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	minted := map[string]CreateAPIKeyResponse{}
+	for _, scope := range []string{db.ScopeRead, db.ScopePostsWrite} {
+		rec = mint("eak_admin", "{\"Name\":\"Review Importer\",\"Scopes\":[\""+scope+"\"],\"ExpiresInDays\":30}")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d minting a key, got %d", http.StatusOK, rec.Code)
+		}
+		var actualResponse expectedResponseCreateAPIKey
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		minted[scope] = actualResponse.Data
+	}
+
+	rec = mint(minted[db.ScopePostsWrite].Key, "{\"Name\":\"Sneaky\",\"Scopes\":[\"admin\"]}")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d minting with a non-admin key, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	post := func(apiKey string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"Imported review\",\"ArticleText\":\"walnut moon\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		req.Header.Set(apiKeyHeader, apiKey)
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		apiKey             string
+		expectedStatusCode int
+	}{
+		{"eak_guessed", http.StatusUnauthorized},
+		{minted[db.ScopeRead].Key, http.StatusForbidden},
+		{minted[db.ScopePostsWrite].Key, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec = post(c.apiKey)
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d, got %d", c.expectedStatusCode, rec.Code)
+		}
+	}
+
+	authorPosts, _, err := db.GetAuthorPosts(context.Background(), inMemDB, "Review Importer", 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(authorPosts) != 1 {
+		t.Errorf("Expected the post to be made under the key's name, got %#v", authorPosts)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodDelete, "/admin/apikeys/"+minted[db.ScopePostsWrite].APIKey.ID, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set(apiKeyHeader, "eak_admin")
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d revoking a key, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = post(minted[db.ScopePostsWrite].Key)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d with a revoked key, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/db"
+)
+
+type GetAuditEntriesResponse struct {
+	Offset  int             `json:"Offset"`
+	Limit   int             `json:"Limit"`
+	Total   int             `json:"Total"`
+	Entries []db.AuditEntry `json:"Entries"`
+}
+
+//auditActor is who req's changes get recorded against in the audit log
+func auditActor(req *http.Request) db.Actor {
+	a := currentActor(req)
+	return db.Actor{Name: a.Name, Role: a.Role, IP: clientIP(req)}
+}
+
+//openAuditLog reloads the audit log kept in Config.AuditLogFile into s's store and appends every change to it from now on. An empty AuditLogFile keeps the audit log in memory only
+func (s *Server) openAuditLog() error {
+	const funcname = "Server.openAuditLog"
+	path := s.Config.AuditLogFile
+	if path == "" {
+		log(context.Background(), funcname, "audit_log_file is empty, the audit log will not survive restarts")
+		return nil
+	}
+
+	loaded, err := db.LoadAuditLog(context.Background(), s.DB, path)
+	if err != nil {
+		return err
+	}
+	s.DB.AuditWriter = &db.AuditFile{Path: path}
+	log(context.Background(), funcname, "Loaded", loaded, "audit entries from", path)
+	return nil
+}
+
+//parseAuditFilter reads the actor, action, table, target, article, since and until query params
+func parseAuditFilter(req *http.Request) (filter db.AuditFilter, err error) {
+	query := req.URL.Query()
+	filter = db.AuditFilter{
+		ActorName: query.Get("actor"),
+		Action:    query.Get("action"),
+		Table:     query.Get("table"),
+		TargetID:  query.Get("target"),
+		ArticleID: query.Get("article"),
+	}
+	switch filter.Action {
+	case "", db.AuditActionCreate, db.AuditActionUpdate, db.AuditActionDelete:
+	default:
+		return filter, fmt.Errorf("action should be one of %s, %s or %s", db.AuditActionCreate, db.AuditActionUpdate, db.AuditActionDelete)
+	}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(param); value != "" {
+			*t, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s should be an RFC 3339 timestamp", param)
+			}
+		}
+	}
+	return filter, nil
+}
+
+func getAuditEntriesHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAuditEntriesHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	filter, err := parseAuditFilter(req)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, limit, err := parsePagination(req)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	entries, total, err := db.GetAuditEntries(req.Context(), currentDB(req), filter, offset, limit)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting audit entries"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(entries), "of", total, "audit entries")
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetAuditEntriesResponse{Offset: offset, Limit: limit, Total: total, Entries: entries}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/gorilla/mux"
+)
+
+type expectedResponseGetAuditEntries struct {
+	Data  GetAuditEntriesResponse
+	Error string
+}
+
+func Test_GetAuditEntries(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	adminCookie := loginWithRole(t, "Admin", db.RoleAdmin)
+	authorCookie := loginAs(t, "Dr. Eggman")
+
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.Handle("/blog", server.bearerAuthMiddleware(http.HandlerFunc(createBlogPostHandler))).Methods(http.MethodPost)
+	r.Handle("/admin/audit", requireAdmin(http.HandlerFunc(getAuditEntriesHandler))).Methods(http.MethodGet)
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	req.RemoteAddr = "10.0.0.1:4242"
+	req.AddCookie(authorCookie)
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d creating a post, got %d", http.StatusOK, rec.Code)
+	}
+
+	getAudit := func(cookie *http.Cookie, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/admin/audit"+query, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		req.AddCookie(cookie)
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = getAudit(authorCookie, "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d for a non-admin, got %d", http.StatusForbidden, rec.Code)
+	}
+	rec = getAudit(adminCookie, "?since=yesterday")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a bad timestamp, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = getAudit(adminCookie, "?table="+db.BlogPostTable+"&action=create")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	var actualResponse expectedResponseGetAuditEntries
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if actualResponse.Data.Total != 1 {
+		t.Fatalf("Expected 1 post creation in the audit log, got %#v", actualResponse.Data)
+	}
+	entry := actualResponse.Data.Entries[0]
+	expectedActor := db.Actor{Name: "Dr. Eggman", Role: db.RoleAuthor, IP: "10.0.0.1"}
+	if entry.Operation != "CreateBlogPost" || entry.Actor != expectedActor {
+		t.Errorf("Expected CreateBlogPost by %#v, got %#v", expectedActor, entry)
+	}
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/jwt"
+	"github.com/aschereT/ea-gaming-review/validate"
+	"github.com/gorilla/mux"
+)
+
+type RegisterRequest struct {
+	Username    string `json:"Username" validate:"required,max=50"`
+	DisplayName string `json:"DisplayName" validate:"required,max=100"`
+	//not validated, passwords are used exactly as given
+	Password string `json:"Password"`
+}
+
+type LoginRequest struct {
+	Username string `json:"Username" validate:"required,max=50"`
+	//not validated, passwords are used exactly as given
+	Password string `json:"Password"`
+}
+
+type LoginResponse struct {
+	UserID      string `json:"UserID"`
+	DisplayName string `json:"DisplayName"`
+	Role        string `json:"Role"`
+	//repeat in the X-CSRF-Token header of requests that change anything
+	CSRFToken string `json:"CSRFToken"`
+}
+
+type SetUserRoleRequest struct {
+	//one of the db.Role* roles
+	Role string `json:"Role" validate:"required,oneof=admin editor author commenter"`
+}
+
+type contextKey string
+
+const userContextKey = contextKey("user")
+const claimsContextKey = contextKey("claims")
+const apiKeyContextKey = contextKey("apikey")
+
+const sessionCookieName = "session"
+const apiKeyHeader = "X-API-Key"
+const minPasswordLength = 8
+
+//newKeyset accepts bearer tokens signed with the configured keys
+func newKeyset(cfg config.JWT) (*jwt.Keyset, error) {
+	keys, err := jwt.ParseKeys(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+	keyset := jwt.NewKeyset(keys...)
+	keyset.Issuer = cfg.Issuer
+	keyset.Audience = cfg.Audience
+	return keyset, nil
+}
+
+//currentUser returns the logged in user making req, or nil for anonymous requests
+func currentUser(req *http.Request) *db.User {
+	user, _ := req.Context().Value(userContextKey).(*db.User)
+	return user
+}
+
+//currentClaims returns the verified bearer token claims of req, or nil if it had no bearer token
+func currentClaims(req *http.Request) *jwt.Claims {
+	claims, _ := req.Context().Value(claimsContextKey).(*jwt.Claims)
+	return claims
+}
+
+//currentAPIKey returns the API key req was made with, or nil if it had none
+func currentAPIKey(req *http.Request) *db.APIKey {
+	apiKey, _ := req.Context().Value(apiKeyContextKey).(*db.APIKey)
+	return apiKey
+}
+
+//sessionMiddleware puts the user owning the session cookie, if any, into the request context
+func sessionMiddleware(next http.Handler) http.Handler {
+	const funcname = "sessionMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie(sessionCookieName)
+		if err != nil || cookie.Value == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		user, err := db.GetSessionUser(req.Context(), currentDB(req), cookie.Value)
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error checking session"))
+			return
+		}
+		if user != nil {
+			req = req.WithContext(context.WithValue(req.Context(), userContextKey, user))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+//apiKeyMiddleware puts the API key in the X-API-Key header, if any, into the request context. Unknown, expired and revoked keys are rejected
+func apiKeyMiddleware(next http.Handler) http.Handler {
+	const funcname = "apiKeyMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(apiKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		apiKey, err := db.AuthenticateAPIKey(req.Context(), currentDB(req), key)
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error checking API key"))
+			return
+		}
+		if apiKey == nil {
+			err = fmt.Errorf("Invalid API key")
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		req = req.WithContext(context.WithValue(req.Context(), apiKeyContextKey, apiKey))
+		next.ServeHTTP(w, req)
+	})
+}
+
+//requireScope rejects requests made with an API key that wasn't granted scope. Requests without an API key are left to the other auth checks
+func requireScope(scope string, next http.Handler) http.Handler {
+	const funcname = "requireScope"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if apiKey := currentAPIKey(req); apiKey != nil && !apiKey.HasScope(scope) {
+			err := fmt.Errorf("API key is missing the %s scope", scope)
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusForbidden, err)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+//requireAdmin only lets through admins, and requests made with an API key granted the admin scope
+func requireAdmin(next http.Handler) http.Handler {
+	const funcname = "requireAdmin"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if statusCode, err := authorize(req, actionAdminister, nil, nil); err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, statusCode, err)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+//bearerAuthMiddleware verifies any bearer token and puts its claims into the request context.
+//Invalid tokens are always rejected, and requests with no token, session or API key are rejected if the RequireAuthForWrites feature is on
+func (s *Server) bearerAuthMiddleware(next http.Handler) http.Handler {
+	const funcname = "bearerAuthMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authHeader := req.Header.Get("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			claims, err := s.jwtKeys.Verify(strings.TrimPrefix(authHeader, "Bearer "), time.Now())
+			if err != nil {
+				logError(req.Context(), funcname, err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				respondWithError(w, http.StatusUnauthorized, fmt.Errorf("Invalid bearer token"))
+				return
+			}
+			req = req.WithContext(context.WithValue(req.Context(), claimsContextKey, claims))
+		}
+
+		if s.Config.Features.RequireAuthForWrites && currentUser(req) == nil && currentClaims(req) == nil && currentAPIKey(req) == nil {
+			err := fmt.Errorf("Log in or provide a bearer token or API key")
+			logError(req.Context(), funcname, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+//resolveAuthorName works out who is posting. Logged in users always post under their display name, bearer tokens under their name claim and API keys under the key's name.
+//Anonymous posters give a name in field, which can't be a registered user's display name
+func resolveAuthorName(req *http.Request, field, bodyName string) (name string, statusCode int, err error) {
+	if user := currentUser(req); user != nil {
+		return user.DisplayName, http.StatusOK, nil
+	}
+	if claims := currentClaims(req); claims != nil {
+		if claims.Name != "" {
+			return claims.Name, http.StatusOK, nil
+		}
+		return claims.Subject, http.StatusOK, nil
+	}
+	if apiKey := currentAPIKey(req); apiKey != nil {
+		return apiKey.Name, http.StatusOK, nil
+	}
+
+	if bodyName == "" {
+		return "", http.StatusBadRequest, fmt.Errorf("%s should not be empty", field)
+	}
+
+	owner, err := db.GetUserByDisplayName(req.Context(), currentDB(req), bodyName)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("Error checking %s", field)
+	}
+	if owner != nil {
+		return "", http.StatusForbidden, fmt.Errorf("%s %s belongs to a registered user, log in to post as them", field, bodyName)
+	}
+
+	return bodyName, http.StatusOK, nil
+}
+
+func registerHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "registerHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var registerReq RegisterRequest
+	err := dec.Decode(&registerReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	errs := validate.Struct(&registerReq)
+	if strings.ContainsAny(registerReq.Username, " \t\n") {
+		errs.Add("Username", "Username should not contain spaces")
+	}
+	if len(registerReq.Password) < minPasswordLength {
+		errs.Add("Password", "Password should be at least %d characters", minPasswordLength)
+	}
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	id, err := db.CreateUser(req.Context(), currentDB(req), auditActor(req), registerReq.Username, registerReq.DisplayName, registerReq.Password)
+	if errors.Is(err, db.ErrConflict) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusConflict, &apiError{message: "Username or DisplayName is already taken", kind: db.ErrConflict})
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error creating user"))
+		return
+	}
+
+	log(req.Context(), funcname, "Registered user", id)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: CreateBlogPostOrCommentResponse{ID: id}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func loginHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "loginHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var loginReq LoginRequest
+	err := dec.Decode(&loginReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+	if errs := validate.Struct(&loginReq); len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	user, err := db.AuthenticateUser(req.Context(), currentDB(req), loginReq.Username, loginReq.Password)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error logging in"))
+		return
+	}
+	if user == nil {
+		err = fmt.Errorf("Incorrect username or password")
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	token, err := db.CreateSession(req.Context(), currentDB(req), user.ID, currentConfig(req).SessionTTL.Duration)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error logging in"))
+		return
+	}
+
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error logging in"))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(currentConfig(req).SessionTTL.Duration),
+		HttpOnly: true,
+		Secure:   currentConfig(req).Features.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	setCSRFCookie(w, req, csrfToken)
+
+	log(req.Context(), funcname, "Logged in user", user.ID)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: LoginResponse{UserID: user.ID, DisplayName: user.DisplayName, Role: user.Role, CSRFToken: csrfToken}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func logoutHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "logoutHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	if cookie, err := req.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		_, err = db.DeleteSession(req.Context(), currentDB(req), cookie.Value)
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error logging out"))
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   currentConfig(req).Features.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	setCSRFCookie(w, req, "")
+
+	log(req.Context(), funcname, "Logged out")
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: "OK"})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func setUserRoleHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "setUserRoleHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	username := vars["username"]
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var roleReq SetUserRoleRequest
+	err := dec.Decode(&roleReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	if errs := validate.Struct(&roleReq); len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	exists, err := db.SetUserRole(req.Context(), currentDB(req), auditActor(req), username, roleReq.Role)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error setting role"))
+		return
+	}
+	if !exists {
+		err = fmt.Errorf("No user found with username %s", username)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	log(req.Context(), funcname, "Set role of", username, "to", roleReq.Role)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: "OK"})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
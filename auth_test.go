@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/jwt"
+	"github.com/gorilla/mux"
+)
+
+//registers a user with the given display name and returns a cookie for a session of theirs
+func loginAs(t *testing.T, displayName string) *http.Cookie {
+	username := strings.ReplaceAll(strings.ToLower(displayName), " ", "")
+	_, err := db.CreateUser(context.Background(), inMemDB, db.SystemActor, username, displayName, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := db.AuthenticateUser(context.Background(), inMemDB, username, "correct horse battery staple")
+	if err != nil || user == nil {
+		t.Fatalf("Expected to log in as %s, got %v", displayName, err)
+	}
+	token, err := db.CreateSession(context.Background(), inMemDB, user.ID, defaultConfig.SessionTTL.Duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &http.Cookie{Name: sessionCookieName, Value: token}
+}
+
+//ownerIDOf is the OwnerID of posts and comments made by a user loginAs logged in
+func ownerIDOf(t *testing.T, displayName string) string {
+	user, err := db.GetUserByDisplayName(context.Background(), inMemDB, displayName)
+	if err != nil || user == nil {
+		t.Fatalf("Expected %s to have logged in, got %v", displayName, err)
+	}
+	return "user:" + user.ID
+}
+
+//like loginAs, but gives the user role
+func loginWithRole(t *testing.T, displayName, role string) *http.Cookie {
+	cookie := loginAs(t, displayName)
+	username := strings.ReplaceAll(strings.ToLower(displayName), " ", "")
+	_, err := db.SetUserRole(context.Background(), inMemDB, db.SystemActor, username, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie
+}
+
+func Test_RegisterLoginLogout(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/auth/register", strings.NewReader("{\"Username\":\"eggman\",\"DisplayName\":\"Dr. Eggman\",\"Password\":\"short\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	http.HandlerFunc(registerHandler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	for _, expectedStatusCode := range []int{http.StatusOK, http.StatusConflict} {
+		rec = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodPost, "/auth/register", strings.NewReader("{\"Username\":\"eggman\",\"DisplayName\":\"Dr. Eggman\",\"Password\":\"walnut moon base\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+
+		http.HandlerFunc(registerHandler).ServeHTTP(rec, req)
+
+		if rec.Code != expectedStatusCode {
+			t.Errorf("Expected status code %d, got %d", expectedStatusCode, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/auth/login", strings.NewReader("{\"Username\":\"eggman\",\"Password\":\"hedgehog\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	http.HandlerFunc(loginHandler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/auth/login", strings.NewReader("{\"Username\":\"EggMan\",\"Password\":\"walnut moon base\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	http.HandlerFunc(loginHandler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %#v", cookies)
+	}
+	sessionCookie := cookies[0]
+	if cookies[1].Name != csrfCookieName || cookies[1].HttpOnly || cookies[1].Value == "" {
+		t.Errorf("Expected a CSRF cookie scripts can read, got %#v", cookies[1])
+	}
+
+	user, err := db.GetSessionUser(context.Background(), inMemDB, sessionCookie.Value)
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.DisplayName != "Dr. Eggman" {
+		t.Errorf("Expected session to belong to Dr. Eggman, got %#v", user)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/auth/logout", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(sessionCookie)
+
+	http.HandlerFunc(logoutHandler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	user, err = db.GetSessionUser(context.Background(), inMemDB, sessionCookie.Value)
+	if err != nil {
+		t.Error(err)
+	}
+	if user != nil {
+		t.Errorf("Expected session to be gone after logging out, got %#v", user)
+	}
+}
+
+func Test_CreateBlogPost_StampsLoggedInUser(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	sessionCookie := loginAs(t, "Dr. Eggman")
+	handler := sessionMiddleware(http.HandlerFunc(createBlogPostHandler))
+
+	//logged in users post as themselves, whatever the body says
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Sonic\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(sessionCookie)
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var actualResponse expectedResponseCreateBlogPostOrComment
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+
+	post, err := db.GetBlogPost(context.Background(), inMemDB, actualResponse.Data.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if post == nil || post.AuthorName != "Dr. Eggman" {
+		t.Errorf("Expected post to be by Dr. Eggman, got %#v", post)
+	}
+
+	//anonymous posters can't pretend to be a registered user
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func Test_BearerAuthMiddleware(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	key := jwt.Key{ID: "test-1", Algorithm: jwt.AlgorithmHS256, Secret: []byte(strings.Repeat("s", 32))}
+	cfg := testConfig()
+	cfg.JWT.Keys = "test-1:HS256:" + base64.StdEncoding.EncodeToString(key.Secret)
+	cfg.Features.RequireAuthForWrites = true
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Sign(jwt.Claims{Subject: "bot-1", Name: "Review Importer", ExpiresAt: time.Now().Add(time.Hour).Unix()}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := jwt.Sign(jwt.Claims{Subject: "bot-1", ExpiresAt: time.Now().Add(time.Hour).Unix()}, jwt.Key{ID: "test-1", Algorithm: jwt.AlgorithmHS256, Secret: []byte(strings.Repeat("x", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := server.bearerAuthMiddleware(http.HandlerFunc(createBlogPostHandler))
+	cases := []struct {
+		authHeader         string
+		expectedStatusCode int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer " + forged, http.StatusUnauthorized},
+		{"Bearer " + token, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		if c.authHeader != "" {
+			req.Header.Set("Authorization", c.authHeader)
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d for %q, got %d", c.expectedStatusCode, c.authHeader, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("Expected a WWW-Authenticate header on 401s")
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+
+		var actualResponse expectedResponseCreateBlogPostOrComment
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		post, err := db.GetBlogPost(context.Background(), inMemDB, actualResponse.Data.ID)
+		if err != nil {
+			t.Error(err)
+		}
+		if post == nil || post.AuthorName != "Review Importer" {
+			t.Errorf("Expected post to be stamped with the token's name, got %#v", post)
+		}
+	}
+}
+
+func Test_SetUserRole(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.Handle("/admin/users/{username}/role", requireAdmin(http.HandlerFunc(setUserRoleHandler)))
+
+	authorCookie := loginAs(t, "Dr. Eggman")
+	cases := []struct {
+		cookie             *http.Cookie
+		username           string
+		body               string
+		expectedStatusCode int
+	}{
+		{nil, "dr.eggman", "{\"Role\":\"admin\"}", http.StatusUnauthorized},
+		{authorCookie, "dr.eggman", "{\"Role\":\"admin\"}", http.StatusForbidden},
+		{loginWithRole(t, "Root", db.RoleAdmin), "dr.eggman", "{\"Role\":\"overlord\"}", http.StatusBadRequest},
+		{loginWithRole(t, "Root 2", db.RoleAdmin), "sonic", "{\"Role\":\"editor\"}", http.StatusNotFound},
+		{loginWithRole(t, "Root 3", db.RoleAdmin), "dr.eggman", "{\"Role\":\"commenter\"}", http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPut, "/admin/users/"+c.username+"/role", strings.NewReader(c.body))
+		if err != nil {
+			t.Error(err)
+		}
+		if c.cookie != nil {
+			req.AddCookie(c.cookie)
+		}
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d for %s, got %d", c.expectedStatusCode, c.body, rec.Code)
+		}
+	}
+
+	//commenters can't post anymore
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(authorCookie)
+
+	sessionMiddleware(http.HandlerFunc(createBlogPostHandler)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
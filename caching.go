@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//cacheControl is the Cache-Control header of route: its own if it sets one, otherwise no-store for anything but reads,
+//and for reads revalidating with the ETag every time, kept out of shared caches when who asks can change the answer
+func cacheControl(route routeDoc) string {
+	switch {
+	case route.CacheControl != "":
+		return route.CacheControl
+	case route.Method != http.MethodGet:
+		return "no-store"
+	case route.Auth == authAdmin:
+		return "private, no-store"
+	case route.Auth != authNone:
+		return "private, no-cache"
+	}
+	return "no-cache"
+}
+
+//Cache-Control headers by method and path template
+var cacheControls = func() map[string]string {
+	policies := map[string]string{}
+	for _, route := range routeDocs {
+		policies[route.Method+" "+route.Path] = cacheControl(route)
+	}
+	return policies
+}()
+
+//setLastModified sets the Last-Modified header, which If-Modified-Since is compared with
+func setLastModified(w http.ResponseWriter, modified time.Time) {
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+//strongETag is an ETag of body. Compressed responses get a different one from the same response uncompressed, as they should
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+//etagMatches is whether the If-None-Match header lists etag, comparing weakly like RFC 7232 says to for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+//notModified is whether the client's copy of a response with etag and lastModified is still current.
+//If-Modified-Since is only looked at without If-None-Match
+func notModified(req *http.Request, etag, lastModified string) bool {
+	if ifNoneMatch := strings.Join(req.Header["If-None-Match"], ","); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	ifModifiedSince := req.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+//cacheResponse sets the Cache-Control header of every route, and gives successful reads an ETag,
+//answering 304 Not Modified when If-None-Match or If-Modified-Since show the client already has them
+func cacheResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		policy, ok := cacheControls[routeKey(req)]
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Cache-Control", policy)
+		if req.Method != http.MethodGet || strings.Contains(policy, "no-store") {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buffered, req)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		body := buffered.body.Bytes()
+
+		if buffered.status == http.StatusOK {
+			etag := strongETag(body)
+			w.Header().Set("ETag", etag)
+			if notModified(req, etag, w.Header().Get("Last-Modified")) {
+				for _, header := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+					w.Header().Del(header)
+				}
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+//content codings responses can be compressed with, in the order they are preferred
+var contentCodings = []string{"br", "gzip"}
+
+//negotiateEncoding picks the content coding a client wants from its Accept-Encoding header, "" for none
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, coding := range contentCodings {
+		//an exact match outranks *
+		exact, q := false, 0.0
+		for _, item := range strings.Split(acceptEncoding, ",") {
+			params := strings.Split(item, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if (name != coding && name != "*") || (exact && name == "*") {
+				continue
+			}
+			itemQ := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					var err error
+					itemQ, err = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+					if err != nil || itemQ < 0 || itemQ > 1 {
+						itemQ = 0
+					}
+				}
+			}
+			exact, q = name == coding, itemQ
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func compress(coding string, body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var writer io.WriteCloser
+	switch coding {
+	case "br":
+		writer = brotli.NewWriter(buf)
+	case "gzip":
+		writer = gzip.NewWriter(buf)
+	default:
+		return nil, fmt.Errorf("Unsupported content coding %s", coding)
+	}
+	_, err := writer.Write(body)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//compressResponse compresses responses of at least the configured compress_min_bytes with brotli or gzip, whichever Accept-Encoding prefers
+func compressResponse(next http.Handler) http.Handler {
+	const funcname = "compressResponse"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		coding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+		if coding == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buffered, req)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		body := buffered.body.Bytes()
+
+		if len(body) >= currentConfig(req).CompressMinBytes && w.Header().Get("Content-Encoding") == "" {
+			compressed, err := compress(coding, body)
+			if err != nil {
+				logError(req.Context(), funcname, err)
+			} else {
+				body = compressed
+				w.Header().Set("Content-Encoding", coding)
+				w.Header().Del("Content-Length")
+			}
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
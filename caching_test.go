@@ -0,0 +1,180 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_NegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		acceptEncoding, expected string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"*", "br"},
+		{"*, br;q=0", "gzip"},
+		{"GZIP;q=0.8", "gzip"},
+		{"gzip;q=0", ""},
+	}
+	for _, c := range cases {
+		got := negotiateEncoding(c.acceptEncoding)
+		if got != c.expected {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", c.acceptEncoding, c.expected, got)
+		}
+	}
+}
+
+func Test_Caching(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/blog", `{"Title":"Okami","ArticleText":"Paint the sun back","AuthorName":"Issun"}`, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "no-store" {
+		t.Errorf("Expected writes not to be stored, got %q", cacheControl)
+	}
+	if etag := rec.Header().Get("ETag"); etag != "" {
+		t.Errorf("Expected no ETag on a write, got %s", etag)
+	}
+	var created struct {
+		Data CreateBlogPostOrCommentResponse
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/v1/blog/" + created.Data.ID
+
+	rec = do(http.MethodGet, path, "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	lastModified := rec.Header().Get("Last-Modified")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Errorf("Expected a strong ETag, got %q", etag)
+	}
+	if _, err := http.ParseTime(lastModified); err != nil {
+		t.Errorf("Expected a Last-Modified date, got %q", lastModified)
+	}
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "private, no-cache" {
+		t.Errorf("Expected reads to be revalidated, got %q", cacheControl)
+	}
+
+	modified, _ := http.ParseTime(lastModified)
+	conditionals := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"one of several ETags", map[string]string{"If-None-Match": `"stale", W/` + etag}, http.StatusNotModified},
+		{"any ETag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"other ETag", map[string]string{"If-None-Match": `"stale"`}, http.StatusOK},
+		{"unmodified", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+		{"ETag wins", map[string]string{"If-None-Match": `"stale"`, "If-Modified-Since": lastModified}, http.StatusOK},
+	}
+	for _, c := range conditionals {
+		rec = do(http.MethodGet, path, "", c.headers)
+		if rec.Code != c.status {
+			t.Errorf("%s: expected status code %d, got %d", c.name, c.status, rec.Code)
+		}
+		if c.status == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag) {
+			t.Errorf("%s: expected no body and the ETag, got %q %q", c.name, rec.Body.String(), rec.Header().Get("ETag"))
+		}
+	}
+
+	//errors aren't cached
+	rec = do(http.MethodGet, "/v1/blog/nope", "", map[string]string{"If-None-Match": "*"})
+	if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Errorf("Expected a 404 without an ETag, got %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	rec = do(http.MethodGet, "/health", "", nil)
+	if rec.Header().Get("Cache-Control") != "no-store" || rec.Header().Get("ETag") != "" {
+		t.Errorf("Expected /health not to be stored, got %q %q", rec.Header().Get("Cache-Control"), rec.Header().Get("ETag"))
+	}
+
+	//too small to compress
+	rec = do(http.MethodGet, path, "", map[string]string{"Accept-Encoding": "gzip"})
+	if encoding := rec.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Expected a small response not to be compressed, got %s", encoding)
+	}
+	if vary := rec.Header()["Vary"]; !containsString(vary, "Accept-Encoding") {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", vary)
+	}
+
+	rec = do(http.MethodGet, "/openapi.json", "", nil)
+	uncompressed, uncompressedETag := rec.Body.String(), rec.Header().Get("ETag")
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "public, max-age=3600" {
+		t.Errorf("Expected the spec to be cacheable, got %q", cacheControl)
+	}
+	for _, c := range []struct {
+		coding     string
+		decompress func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	} {
+		rec = do(http.MethodGet, "/openapi.json", "", map[string]string{"Accept-Encoding": c.coding})
+		if encoding := rec.Header().Get("Content-Encoding"); encoding != c.coding {
+			t.Fatalf("Expected the spec compressed with %s, got %q", c.coding, encoding)
+		}
+		if rec.Body.Len() >= len(uncompressed) {
+			t.Errorf("%s: expected the spec to get smaller than %d bytes, got %d", c.coding, len(uncompressed), rec.Body.Len())
+		}
+		if rec.Header().Get("ETag") == uncompressedETag {
+			t.Errorf("%s: expected a different ETag from the uncompressed spec", c.coding)
+		}
+		r, err := c.decompress(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decompressed) != uncompressed {
+			t.Errorf("%s: expected the spec back after decompressing", c.coding)
+		}
+	}
+}
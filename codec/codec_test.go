@@ -0,0 +1,70 @@
+package codec
+
+import (
+	"strings"
+	"testing"
+)
+
+const sample = `{"Data":{"ID":"1c9tqbfzVlvXEtD5iPnCjOU4zXf","Title":"Katamari Damacy","Score":-3,"Big":18446744073709551615,"Ratio":0.5,"Tags":["roll","prince"],"Empty":[],"Parent":null,"Pending":true,"Attributes":{"not a name":"x","1st":2}}}`
+
+func Test_JSON(t *testing.T) {
+	value, err := ParseJSON([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := MarshalJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != sample {
+		t.Errorf("Expected the same JSON back in the same order, got %s", encoded)
+	}
+
+	_, err = ParseJSON([]byte(`{"a":1} {"b":2}`))
+	if err == nil {
+		t.Error("Expected an error for two values, got nil")
+	}
+}
+
+func Test_XML(t *testing.T) {
+	value, err := ParseJSON([]byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := MarshalXML(value, "Response")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<Response><Data><ID>1c9tqbfzVlvXEtD5iPnCjOU4zXf</ID><Title>Katamari Damacy</Title><Score>-3</Score><Big>18446744073709551615</Big><Ratio>0.5</Ratio>` +
+		`<Tags><item>roll</item><item>prince</item></Tags><Empty></Empty><Parent null="true"/><Pending>true</Pending>` +
+		`<Attributes><entry key="not a name">x</entry><entry key="1st">2</entry></Attributes></Data></Response>`
+	if string(encoded) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, encoded)
+	}
+
+	decoded, err := UnmarshalXML(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//everything comes back as strings and Objects, so it is up to the reader to know the types
+	decodedJSON, _ := MarshalJSON(decoded)
+	expectedJSON := `{"Data":{"ID":"1c9tqbfzVlvXEtD5iPnCjOU4zXf","Title":"Katamari Damacy","Score":"-3","Big":"18446744073709551615","Ratio":"0.5",` +
+		`"Tags":{"item":["roll","prince"]},"Empty":"","Parent":null,"Pending":"true","Attributes":{"not a name":"x","1st":"2"}}}`
+	if string(decodedJSON) != expectedJSON {
+		t.Errorf("Expected\n%s\ngot\n%s", expectedJSON, decodedJSON)
+	}
+
+	for _, bad := range []string{"", "<a>", "<a></a><b></b>", "<a><b></a>"} {
+		_, err := UnmarshalXML([]byte(bad))
+		if err == nil {
+			t.Errorf("Expected an error for %q, got nil", bad)
+		}
+	}
+
+	deep := strings.Repeat("<a>", maxDepth+2) + strings.Repeat("</a>", maxDepth+2)
+	_, err = UnmarshalXML([]byte(deep))
+	if err == nil {
+		t.Error("Expected an error for deeply nested XML, got nil")
+	}
+}
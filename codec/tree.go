@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+//Values are what XML is converted to and from JSON through: nil, bool, json.Number, string, []interface{} or Object,
+//the same as encoding/json decodes into with UseNumber, except that objects keep their member order
+
+//Object is an object with its members in order
+type Object []Member
+
+//Member is one key and value of an Object
+type Member struct {
+	Key   string
+	Value interface{}
+}
+
+//Get returns the value of key, and if it was there
+func (o Object) Get(key string) (interface{}, bool) {
+	for _, member := range o {
+		if member.Key == key {
+			return member.Value, true
+		}
+	}
+	return nil, false
+}
+
+//ParseJSON reads a single JSON value
+func ParseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+func parseJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '[':
+			array := []interface{}{}
+			for dec.More() {
+				item, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, item)
+			}
+			_, err = dec.Token()
+			return array, err
+		case '{':
+			object := Object{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				object = append(object, Member{Key: key.(string), Value: value})
+			}
+			_, err = dec.Token()
+			return object, err
+		}
+		return nil, fmt.Errorf("Unexpected %v", token)
+	default:
+		return token, nil
+	}
+}
+
+//MarshalJSON writes value as JSON, keeping the member order of Objects
+func MarshalJSON(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := writeJSON(buf, value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case Object:
+		buf.WriteByte('{')
+		for i, member := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(member.Key)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			err = writeJSON(buf, member.Value)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeJSON(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+		return nil
+	}
+}
+
+//number is a json.Number as the narrowest of int64, uint64 or float64 that holds it
+func number(n json.Number) (interface{}, error) {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u, nil
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid number %s", n)
+	}
+	return f, nil
+}
+
+//floatNumber is f as a json.Number, which can't hold NaN or infinities
+func floatNumber(f float64) (json.Number, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("%v can't be represented", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
@@ -0,0 +1,199 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Values are written to XML as elements named after their keys: array items as <item> elements,
+//null as an empty element with null="true", and keys that aren't XML names as <entry key="...">
+
+//XMLItem is the name of the elements array items are written as
+const XMLItem = "item"
+
+const xmlEntry = "entry"
+
+//maxDepth limits nesting when decoding, so a small body can't exhaust the stack
+const maxDepth = 100
+
+//MarshalXML writes value as an XML document with a root element called root
+func MarshalXML(value interface{}, root string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	err := writeXMLElement(buf, root, value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isXMLName(name string) bool {
+	if name == "" || len(name) >= 3 && (name[0]|0x20) == 'x' && (name[1]|0x20) == 'm' && (name[2]|0x20) == 'l' {
+		return false
+	}
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}) error {
+	buf.WriteByte('<')
+	if isXMLName(name) {
+		buf.WriteString(name)
+	} else {
+		buf.WriteString(xmlEntry + ` key="`)
+		xml.EscapeText(buf, []byte(name))
+		buf.WriteByte('"')
+		name = xmlEntry
+	}
+
+	switch value := value.(type) {
+	case nil:
+		buf.WriteString(` null="true"/>`)
+		return nil
+	case Object:
+		buf.WriteByte('>')
+		for _, member := range value {
+			err := writeXMLElement(buf, member.Key, member.Value)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		buf.WriteByte('>')
+		for _, item := range value {
+			err := writeXMLElement(buf, XMLItem, item)
+			if err != nil {
+				return err
+			}
+		}
+	case bool, json.Number:
+		buf.WriteByte('>')
+		fmt.Fprint(buf, value)
+	case string:
+		buf.WriteByte('>')
+		xml.EscapeText(buf, []byte(value))
+	default:
+		return fmt.Errorf("Can't encode %T", value)
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+//UnmarshalXML reads an XML document written like MarshalXML writes them, ignoring the name of the root element.
+//XML can't tell strings from numbers or one item from an array, so elements with no child elements become strings,
+//and elements with children become Objects, with repeated children collected into arrays
+func UnmarshalXML(data []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("No root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := readXMLElement(dec, start, 0)
+			if err != nil {
+				return nil, err
+			}
+			for {
+				token, err := dec.Token()
+				if err == io.EOF {
+					return value, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := token.(xml.StartElement); ok {
+					return nil, fmt.Errorf("Unexpected second root element")
+				}
+			}
+		}
+	}
+}
+
+//xmlKey is the key an element stands for
+func xmlKey(start xml.StartElement) string {
+	if start.Name.Local == xmlEntry {
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "key" {
+				return attr.Value
+			}
+		}
+	}
+	return start.Name.Local
+}
+
+func readXMLElement(dec *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("Nested too deeply")
+	}
+	null := false
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "null" && attr.Value == "true" {
+			null = true
+		}
+	}
+
+	text := &bytes.Buffer{}
+	var object Object
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.CharData:
+			text.Write(token)
+		case xml.StartElement:
+			key := xmlKey(token)
+			value, err := readXMLElement(dec, token, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			object = addXMLMember(object, key, value)
+		case xml.EndElement:
+			switch {
+			case null:
+				return nil, nil
+			case object != nil:
+				return object, nil
+			case !utf8.Valid(text.Bytes()):
+				return nil, fmt.Errorf("Text should be valid UTF-8")
+			}
+			return text.String(), nil
+		}
+	}
+}
+
+//addXMLMember adds key to object, turning its value into an array if key is repeated
+func addXMLMember(object Object, key string, value interface{}) Object {
+	for i, member := range object {
+		if member.Key != key {
+			continue
+		}
+		//elements are only ever read as strings, Objects or null, so an array can only be from repeats
+		if array, ok := member.Value.([]interface{}); ok {
+			object[i].Value = append(array, value)
+		} else {
+			object[i].Value = []interface{}{member.Value, value}
+		}
+		return object
+	}
+	return append(object, Member{Key: key, Value: value})
+}
@@ -0,0 +1,540 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+//Storage backends
+const (
+	StorageMemory = "memory"
+)
+
+//Log levels, from most to least verbose
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+var logLevels = []string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}
+
+func logLevelIndex(level string) int {
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+//LevelEnabled is whether messages at level should be logged when configured to log at configured
+func LevelEnabled(configured, level string) bool {
+	return logLevelIndex(level) >= logLevelIndex(configured)
+}
+
+//Duration is a time.Duration written like 15s or 1m30s in config files
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	err := unmarshal(&text)
+	if err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(text))
+}
+
+//Features are parts of the server that can be switched on or off
+type Features struct {
+	RequireAuthForWrites     bool `yaml:"require_auth_for_writes" toml:"require_auth_for_writes"`
+	RequireEmailVerification bool `yaml:"require_email_verification" toml:"require_email_verification"`
+	TrustProxyHeaders        bool `yaml:"trust_proxy_headers" toml:"trust_proxy_headers"`
+	SessionCookieSecure      bool `yaml:"session_cookie_secure" toml:"session_cookie_secure"`
+	ValidateRequests         bool `yaml:"validate_requests" toml:"validate_requests"`
+}
+
+//TLS is how HTTPS is served
+type TLS struct {
+	//serve HTTPS with this certificate and key when both are set
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	//clients negotiating an older TLS version are turned away. One of 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `yaml:"min_version" toml:"min_version"`
+	//if set, plain HTTP on this address is redirected to HTTPS
+	RedirectAddr string `yaml:"redirect_addr" toml:"redirect_addr"`
+	//how often the certificate files are checked for changes
+	ReloadIntervalSeconds int `yaml:"reload_interval_seconds" toml:"reload_interval_seconds"`
+}
+
+//Enabled is whether a certificate is configured to serve HTTPS with
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+//CORS is which browser origins can call the API, and how
+type CORS struct {
+	//origins browsers may call the API from. * allows any origin, but then cookies aren't sent cross-origin
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	//methods browsers may use cross-origin, narrowed down to what each route supports in preflights
+	AllowedMethods []string `yaml:"allowed_methods" toml:"allowed_methods"`
+	//request headers browsers may send cross-origin
+	AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers"`
+	//how long browsers can cache preflight responses for
+	MaxAgeSeconds int `yaml:"max_age_seconds" toml:"max_age_seconds"`
+}
+
+//JWT is which bearer tokens are accepted
+type JWT struct {
+	//comma separated kid:alg:key entries, see jwt.ParseKeys
+	Keys string `yaml:"keys" toml:"keys"`
+	//if set, tokens must have a matching iss claim
+	Issuer string `yaml:"issuer" toml:"issuer"`
+	//if set, tokens must have a matching aud claim
+	Audience string `yaml:"audience" toml:"audience"`
+}
+
+//RateLimits are how many requests each client can make to each group of rate limited routes, written like 5/1m. 0 means unlimited
+type RateLimits struct {
+	Auth     string `yaml:"auth" toml:"auth"`
+	Posts    string `yaml:"posts" toml:"posts"`
+	Comments string `yaml:"comments" toml:"comments"`
+	Flags    string `yaml:"flags" toml:"flags"`
+}
+
+//Comments is how commenting works
+type Comments struct {
+	//posts stop accepting comments once they are this old, unless they set their own limit. 0 means never
+	CloseAfter Duration `yaml:"close_after" toml:"close_after"`
+	//how long after posting a comment can still be edited by its author
+	EditWindow Duration `yaml:"edit_window" toml:"edit_window"`
+	//comments are hidden pending moderation once this many distinct readers flag them. 0 means never
+	FlagHideThreshold int `yaml:"flag_hide_threshold" toml:"flag_hide_threshold"`
+}
+
+//EmailVerification is how anonymous commenters prove they own their email, when features.require_email_verification is on
+type EmailVerification struct {
+	//signs verification tokens. If empty a random one is used, and tokens stop working on restart
+	Secret string `yaml:"secret" toml:"secret"`
+	//how long a verification link works for
+	TokenTTL Duration `yaml:"token_ttl" toml:"token_ttl"`
+}
+
+//Mailers emails can be sent with
+const (
+	MailerLog  = "log"
+	MailerFile = "file"
+	MailerSMTP = "smtp"
+)
+
+//Mail is how emails are sent
+type Mail struct {
+	//one of log, file or smtp
+	Mailer string `yaml:"mailer" toml:"mailer"`
+	//where the file mailer appends emails
+	File         string `yaml:"file" toml:"file"`
+	From         string `yaml:"from" toml:"from"`
+	SMTPAddr     string `yaml:"smtp_addr" toml:"smtp_addr"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+//Ways notifications can be delivered
+const (
+	DeliveryLog  = "log"
+	DeliveryFile = "file"
+)
+
+//Notifications is how notifications are delivered
+type Notifications struct {
+	//one of log or file
+	Delivery string `yaml:"delivery" toml:"delivery"`
+	//where the file delivery appends notifications
+	File string `yaml:"file" toml:"file"`
+	//how often the outbox is delivered
+	Interval Duration `yaml:"interval" toml:"interval"`
+}
+
+//Trace exporters
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file"
+	TraceExporterOTLP   = "otlp"
+)
+
+//Tracing is where request traces are exported to
+type Tracing struct {
+	//one of none, stdout, file or otlp. otlp reads its endpoint and headers from the standard OTEL_EXPORTER_OTLP_* variables
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	//where the file exporter appends spans
+	File string `yaml:"file" toml:"file"`
+	//how long spans are batched up for before exporting
+	ExportInterval Duration `yaml:"export_interval" toml:"export_interval"`
+	//the service.name spans are exported under
+	ServiceName string `yaml:"service_name" toml:"service_name"`
+}
+
+//Config is how the server is set up
+type Config struct {
+	Addr         string   `yaml:"addr" toml:"addr"`
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	//how long in-flight requests and background jobs get to finish when shutting down
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	Storage         string   `yaml:"storage" toml:"storage"`
+	LogLevel        string   `yaml:"log_level" toml:"log_level"`
+	Features        Features `yaml:"features" toml:"features"`
+	TLS             TLS      `yaml:"tls" toml:"tls"`
+	CORS            CORS     `yaml:"cors" toml:"cors"`
+	JWT             JWT      `yaml:"jwt" toml:"jwt"`
+	//the audit log is appended to this file and reloaded from it on startup. Empty keeps it in memory only
+	AuditLogFile string     `yaml:"audit_log_file" toml:"audit_log_file"`
+	RateLimits   RateLimits `yaml:"rate_limits" toml:"rate_limits"`
+	//CIDRs of the proxies in front of the server. With features.trust_proxy_headers on, X-Forwarded-For is only believed as far back as these
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	//where the server can be reached from outside, for links in emails
+	PublicURL string `yaml:"public_url" toml:"public_url"`
+	//an API key with the admin scope is registered with this key on startup, if set
+	AdminAPIKey string `yaml:"admin_api_key" toml:"admin_api_key"`
+	//how long logins last
+	SessionTTL Duration `yaml:"session_ttl" toml:"session_ttl"`
+	//request bodies bigger than this are rejected
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	//responses smaller than this aren't compressed
+	CompressMinBytes  int               `yaml:"compress_min_bytes" toml:"compress_min_bytes"`
+	Comments          Comments          `yaml:"comments" toml:"comments"`
+	EmailVerification EmailVerification `yaml:"email_verification" toml:"email_verification"`
+	Mail              Mail              `yaml:"mail" toml:"mail"`
+	Notifications     Notifications     `yaml:"notifications" toml:"notifications"`
+	Tracing           Tracing           `yaml:"tracing" toml:"tracing"`
+}
+
+//Default is the config used for anything not set elsewhere
+func Default() Config {
+	return Config{
+		Addr:            ":8080",
+		ReadTimeout:     Duration{15 * time.Second},
+		WriteTimeout:    Duration{30 * time.Second},
+		IdleTimeout:     Duration{2 * time.Minute},
+		ShutdownTimeout: Duration{15 * time.Second},
+		Storage:         StorageMemory,
+		LogLevel:        LogLevelInfo,
+		TLS:             TLS{MinVersion: "1.2", ReloadIntervalSeconds: 30},
+		CORS: CORS{
+			AllowedOrigins: []string{},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token"},
+			MaxAgeSeconds:  600,
+		},
+		AuditLogFile:      "audit.jsonl",
+		RateLimits:        RateLimits{Auth: "10/1m", Posts: "10/1h", Comments: "5/1m", Flags: "20/1h"},
+		TrustedProxies:    []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+		PublicURL:         "http://localhost:8080",
+		SessionTTL:        Duration{7 * 24 * time.Hour},
+		MaxBodyBytes:      1 << 20,
+		CompressMinBytes:  1024,
+		Comments:          Comments{EditWindow: Duration{15 * time.Minute}, FlagHideThreshold: 3},
+		EmailVerification: EmailVerification{TokenTTL: Duration{24 * time.Hour}},
+		Mail:              Mail{Mailer: MailerLog, File: "mail.jsonl", From: "reviews@localhost"},
+		Notifications:     Notifications{Delivery: DeliveryLog, File: "notifications.jsonl", Interval: Duration{5 * time.Second}},
+		Tracing:           Tracing{Exporter: TraceExporterNone, File: "traces.jsonl", ExportInterval: Duration{5 * time.Second}, ServiceName: "ea-gaming-review"},
+	}
+}
+
+//Validate checks that every setting makes sense
+func (c Config) Validate() error {
+	if c.Addr == "" {
+		return fmt.Errorf("addr should not be empty")
+	}
+	for name, d := range map[string]Duration{"read_timeout": c.ReadTimeout, "write_timeout": c.WriteTimeout, "idle_timeout": c.IdleTimeout, "shutdown_timeout": c.ShutdownTimeout, "comments.close_after": c.Comments.CloseAfter, "comments.edit_window": c.Comments.EditWindow} {
+		if d.Duration < 0 {
+			return fmt.Errorf("%s should not be negative", name)
+		}
+	}
+	for name, d := range map[string]Duration{"session_ttl": c.SessionTTL, "email_verification.token_ttl": c.EmailVerification.TokenTTL, "notifications.interval": c.Notifications.Interval, "tracing.export_interval": c.Tracing.ExportInterval} {
+		if d.Duration <= 0 {
+			return fmt.Errorf("%s should be positive", name)
+		}
+	}
+	if c.Storage != StorageMemory {
+		return fmt.Errorf("storage %q is not supported, the only backend is %s", c.Storage, StorageMemory)
+	}
+	if logLevelIndex(c.LogLevel) < 0 {
+		return fmt.Errorf("log_level should be one of %s, %s, %s or %s, got %q", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, c.LogLevel)
+	}
+	if c.TLS.Enabled() && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file should be set together")
+	}
+	if c.TLS.ReloadIntervalSeconds <= 0 {
+		return fmt.Errorf("tls.reload_interval_seconds should be positive")
+	}
+	if c.CORS.MaxAgeSeconds < 0 {
+		return fmt.Errorf("cors.max_age_seconds should not be negative")
+	}
+	for _, cidr := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("trusted_proxies should only have CIDRs like 10.0.0.0/8, got %q", cidr)
+		}
+	}
+	if c.MaxBodyBytes <= 0 {
+		return fmt.Errorf("max_body_bytes should be positive")
+	}
+	if c.CompressMinBytes < 0 {
+		return fmt.Errorf("compress_min_bytes should not be negative")
+	}
+	if c.Comments.FlagHideThreshold < 0 {
+		return fmt.Errorf("comments.flag_hide_threshold should not be negative")
+	}
+	switch c.Mail.Mailer {
+	case MailerLog, MailerFile:
+	case MailerSMTP:
+		if c.Mail.SMTPAddr == "" {
+			return fmt.Errorf("mail.smtp_addr should be set to send mail with smtp")
+		}
+	default:
+		return fmt.Errorf("mail.mailer should be one of %s, %s or %s, got %q", MailerLog, MailerFile, MailerSMTP, c.Mail.Mailer)
+	}
+	if c.Notifications.Delivery != DeliveryLog && c.Notifications.Delivery != DeliveryFile {
+		return fmt.Errorf("notifications.delivery should be one of %s or %s, got %q", DeliveryLog, DeliveryFile, c.Notifications.Delivery)
+	}
+	switch c.Tracing.Exporter {
+	case TraceExporterNone, TraceExporterStdout, TraceExporterFile, TraceExporterOTLP:
+	default:
+		return fmt.Errorf("tracing.exporter should be one of %s, %s, %s or %s, got %q", TraceExporterNone, TraceExporterStdout, TraceExporterFile, TraceExporterOTLP, c.Tracing.Exporter)
+	}
+	return nil
+}
+
+//setting is a single option that can be given as a flag or environment variable
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+func stringSetting(flag, env, usage string, field func(c *Config) *string) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func durationSetting(flag, env, usage string, field func(c *Config) *Duration) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}}
+}
+
+func intSetting(flag, env, usage string, field func(c *Config) *int) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}}
+}
+
+//listSetting reads a comma separated list, dropping empty entries
+func listSetting(flag, env, usage string, field func(c *Config) *[]string) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, value string) error {
+		values := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*field(c) = values
+		return nil
+	}}
+}
+
+func boolSetting(flag, env, usage string, field func(c *Config) *bool) setting {
+	return setting{flag: flag, env: env, usage: usage, isBool: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+var settings = []setting{
+	stringSetting("addr", "ADDR", "address to listen on", func(c *Config) *string { return &c.Addr }),
+	durationSetting("read-timeout", "READ_TIMEOUT", "how long reading a request can take, eg 15s", func(c *Config) *Duration { return &c.ReadTimeout }),
+	durationSetting("write-timeout", "WRITE_TIMEOUT", "how long writing a response can take", func(c *Config) *Duration { return &c.WriteTimeout }),
+	durationSetting("idle-timeout", "IDLE_TIMEOUT", "how long idle keep-alive connections stay open", func(c *Config) *Duration { return &c.IdleTimeout }),
+	durationSetting("shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long requests and background jobs get to finish on shutdown", func(c *Config) *Duration { return &c.ShutdownTimeout }),
+	stringSetting("storage", "STORAGE", "storage backend", func(c *Config) *string { return &c.Storage }),
+	stringSetting("log-level", "LOG_LEVEL", "one of debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }),
+	boolSetting("require-auth-for-writes", "REQUIRE_AUTH_FOR_WRITES", "reject anonymous posts and comments", func(c *Config) *bool { return &c.Features.RequireAuthForWrites }),
+	boolSetting("require-email-verification", "REQUIRE_EMAIL_VERIFICATION", "hold anonymous comments until their email is verified", func(c *Config) *bool { return &c.Features.RequireEmailVerification }),
+	boolSetting("trust-proxy-headers", "TRUST_PROXY_HEADERS", "take the client IP from X-Forwarded-For", func(c *Config) *bool { return &c.Features.TrustProxyHeaders }),
+	boolSetting("session-cookie-secure", "SESSION_COOKIE_SECURE", "only send the session cookie over HTTPS", func(c *Config) *bool { return &c.Features.SessionCookieSecure }),
+	boolSetting("validate-requests", "VALIDATE_REQUESTS", "reject requests that don't match the OpenAPI document", func(c *Config) *bool { return &c.Features.ValidateRequests }),
+	stringSetting("tls-cert-file", "TLS_CERT_FILE", "PEM certificate to serve HTTPS with", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key-file", "TLS_KEY_FILE", "PEM key of the certificate", func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls-min-version", "TLS_MIN_VERSION", "oldest TLS version clients can use, one of 1.0, 1.1, 1.2 or 1.3", func(c *Config) *string { return &c.TLS.MinVersion }),
+	stringSetting("http-redirect-addr", "HTTP_REDIRECT_ADDR", "address to redirect plain HTTP to HTTPS from", func(c *Config) *string { return &c.TLS.RedirectAddr }),
+	intSetting("tls-reload-interval-seconds", "TLS_RELOAD_INTERVAL_SECONDS", "how often the certificate files are checked for changes", func(c *Config) *int { return &c.TLS.ReloadIntervalSeconds }),
+	listSetting("cors-allowed-origins", "CORS_ALLOWED_ORIGINS", "comma separated origins browsers can call the API from", func(c *Config) *[]string { return &c.CORS.AllowedOrigins }),
+	listSetting("cors-allowed-methods", "CORS_ALLOWED_METHODS", "comma separated methods allowed cross-origin", func(c *Config) *[]string { return &c.CORS.AllowedMethods }),
+	listSetting("cors-allowed-headers", "CORS_ALLOWED_HEADERS", "comma separated request headers allowed cross-origin", func(c *Config) *[]string { return &c.CORS.AllowedHeaders }),
+	intSetting("cors-max-age-seconds", "CORS_MAX_AGE_SECONDS", "how long browsers can cache preflights", func(c *Config) *int { return &c.CORS.MaxAgeSeconds }),
+	stringSetting("jwt-keys", "JWT_KEYS", "comma separated kid:alg:key entries accepted for bearer tokens", func(c *Config) *string { return &c.JWT.Keys }),
+	stringSetting("jwt-issuer", "JWT_ISSUER", "iss bearer tokens must have", func(c *Config) *string { return &c.JWT.Issuer }),
+	stringSetting("jwt-audience", "JWT_AUDIENCE", "aud bearer tokens must have", func(c *Config) *string { return &c.JWT.Audience }),
+	stringSetting("audit-log-file", "AUDIT_LOG_FILE", "file to keep the audit log in, empty keeps it in memory only", func(c *Config) *string { return &c.AuditLogFile }),
+	stringSetting("rate-limit-auth", "RATE_LIMIT_AUTH", "requests each client can make to log in and register, eg 10/1m", func(c *Config) *string { return &c.RateLimits.Auth }),
+	stringSetting("rate-limit-posts", "RATE_LIMIT_POSTS", "requests each client can make to post", func(c *Config) *string { return &c.RateLimits.Posts }),
+	stringSetting("rate-limit-comments", "RATE_LIMIT_COMMENTS", "requests each client can make to comment and edit comments", func(c *Config) *string { return &c.RateLimits.Comments }),
+	stringSetting("rate-limit-flags", "RATE_LIMIT_FLAGS", "requests each client can make to flag comments", func(c *Config) *string { return &c.RateLimits.Flags }),
+	listSetting("trusted-proxies", "TRUSTED_PROXIES", "comma separated CIDRs of the proxies X-Forwarded-For is believed from", func(c *Config) *[]string { return &c.TrustedProxies }),
+	stringSetting("public-url", "PUBLIC_URL", "where the server can be reached from outside, for links in emails", func(c *Config) *string { return &c.PublicURL }),
+	stringSetting("admin-api-key", "ADMIN_API_KEY", "register an admin API key with this key on startup", func(c *Config) *string { return &c.AdminAPIKey }),
+	durationSetting("session-ttl", "SESSION_TTL", "how long logins last, eg 168h", func(c *Config) *Duration { return &c.SessionTTL }),
+	intSetting("max-body-bytes", "MAX_BODY_BYTES", "biggest request body accepted", func(c *Config) *int { return &c.MaxBodyBytes }),
+	intSetting("compress-min-bytes", "COMPRESS_MIN_BYTES", "smallest response that gets compressed", func(c *Config) *int { return &c.CompressMinBytes }),
+	durationSetting("comments-close-after", "COMMENTS_CLOSE_AFTER", "how old posts can get before they stop taking comments, 0 for never", func(c *Config) *Duration { return &c.Comments.CloseAfter }),
+	durationSetting("comment-edit-window", "COMMENT_EDIT_WINDOW", "how long comments can be edited for after posting", func(c *Config) *Duration { return &c.Comments.EditWindow }),
+	intSetting("flag-hide-threshold", "FLAG_HIDE_THRESHOLD", "distinct flags that hide a comment, 0 for never", func(c *Config) *int { return &c.Comments.FlagHideThreshold }),
+	stringSetting("email-verification-secret", "EMAIL_VERIFICATION_SECRET", "signs email verification tokens, random if empty", func(c *Config) *string { return &c.EmailVerification.Secret }),
+	durationSetting("email-verification-ttl", "EMAIL_VERIFICATION_TTL", "how long email verification links work for", func(c *Config) *Duration { return &c.EmailVerification.TokenTTL }),
+	stringSetting("mailer", "MAILER", "how emails are sent, one of log, file or smtp", func(c *Config) *string { return &c.Mail.Mailer }),
+	stringSetting("mail-file", "MAIL_FILE", "file the file mailer appends emails to", func(c *Config) *string { return &c.Mail.File }),
+	stringSetting("mail-from", "MAIL_FROM", "address emails are sent from", func(c *Config) *string { return &c.Mail.From }),
+	stringSetting("smtp-addr", "SMTP_ADDR", "host:port of the SMTP server", func(c *Config) *string { return &c.Mail.SMTPAddr }),
+	stringSetting("smtp-username", "SMTP_USERNAME", "username to log in to the SMTP server with, if it needs one", func(c *Config) *string { return &c.Mail.SMTPUsername }),
+	stringSetting("smtp-password", "SMTP_PASSWORD", "password to log in to the SMTP server with", func(c *Config) *string { return &c.Mail.SMTPPassword }),
+	stringSetting("notification-delivery", "NOTIFICATION_DELIVERY", "how notifications are delivered, one of log or file", func(c *Config) *string { return &c.Notifications.Delivery }),
+	stringSetting("notification-file", "NOTIFICATION_FILE", "file the file delivery appends notifications to", func(c *Config) *string { return &c.Notifications.File }),
+	durationSetting("notification-interval", "NOTIFICATION_INTERVAL", "how often notifications are delivered", func(c *Config) *Duration { return &c.Notifications.Interval }),
+	stringSetting("trace-exporter", "TRACE_EXPORTER", "where traces go, one of none, stdout, file or otlp", func(c *Config) *string { return &c.Tracing.Exporter }),
+	stringSetting("trace-file", "TRACE_FILE", "file the file exporter appends spans to", func(c *Config) *string { return &c.Tracing.File }),
+	durationSetting("trace-export-interval", "TRACE_EXPORT_INTERVAL", "how long spans are batched up for before exporting", func(c *Config) *Duration { return &c.Tracing.ExportInterval }),
+	stringSetting("otel-service-name", "OTEL_SERVICE_NAME", "service.name traces are exported under", func(c *Config) *string { return &c.Tracing.ServiceName }),
+}
+
+//flagValue remembers whether a flag was given, so only given flags override other sources
+type flagValue struct {
+	value  string
+	given  bool
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	f.given = true
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+//LoadFile reads a YAML (.yaml or .yml) or TOML (.toml) config file over c. Unknown keys are an error, to catch typos
+func LoadFile(path string, c *Config) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(raw, c)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(raw), c)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", meta.Undecoded())
+		}
+	default:
+		return fmt.Errorf("Config file %s should end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading config file %s: %w", path, err)
+	}
+	return nil
+}
+
+//Load works out the config from command line args, then environment variables read through getenv,
+//then the file given by -config or CONFIG_FILE, then the defaults, in that order of precedence
+func Load(name string, args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or TOML config file, also read from CONFIG_FILE")
+	flagValues := make([]*flagValue, len(settings))
+	for i, s := range settings {
+		flagValues[i] = &flagValue{isBool: s.isBool}
+		fs.Var(flagValues[i], s.flag, fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c := Default()
+	path := *configFile
+	if path == "" {
+		path = getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		err = LoadFile(path, &c)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			err = s.set(&c, value)
+			if err != nil {
+				return Config{}, fmt.Errorf("Error reading %s: %w", s.env, err)
+			}
+		}
+	}
+	for i, s := range settings {
+		if flagValues[i].given {
+			err = s.set(&c, flagValues[i].value)
+			if err != nil {
+				return Config{}, fmt.Errorf("Error reading -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	err = c.Validate()
+	if err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envFrom(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func Test_Load_Defaults(t *testing.T) {
+	c, err := Load("test", nil, envFrom(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("Expected the defaults %#v, got %#v", Default(), c)
+	}
+}
+
+func Test_Load_Precedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	yamlPath := writeConfigFile(t, dir, "config.yaml", `
+addr: ":9000"
+read_timeout: 5s
+log_level: warn
+features:
+  require_auth_for_writes: true
+  trust_proxy_headers: true
+tls:
+  cert_file: cert.pem
+  key_file: key.pem
+cors:
+  allowed_origins: ["https://reviews.example.com"]
+rate_limits:
+  posts: 1/1m
+comments:
+  close_after: 720h
+  flag_hide_threshold: 2
+mail:
+  mailer: smtp
+  smtp_addr: mail.example.com:587
+`)
+	c, err := Load("test", []string{"-config", yamlPath, "-log-level", "debug", "-trust-proxy-headers=false", "-rate-limit-posts", "0", "-trace-exporter", "otlp"}, envFrom(map[string]string{
+		"ADDR":                 ":9001",
+		"LOG_LEVEL":            "error",
+		"IDLE_TIMEOUT":         "1m",
+		"CORS_ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com,",
+		"FLAG_HIDE_THRESHOLD":  "5",
+		"TRACE_EXPORTER":       "file",
+		"TRUSTED_PROXIES":      "203.0.113.0/24",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Default()
+	//from the file
+	expected.ReadTimeout = Duration{5 * time.Second}
+	expected.Features.RequireAuthForWrites = true
+	expected.TLS.CertFile = "cert.pem"
+	expected.TLS.KeyFile = "key.pem"
+	expected.Comments.CloseAfter = Duration{720 * time.Hour}
+	expected.Mail.Mailer = MailerSMTP
+	expected.Mail.SMTPAddr = "mail.example.com:587"
+	//env beats the file
+	expected.Addr = ":9001"
+	expected.IdleTimeout = Duration{time.Minute}
+	expected.CORS.AllowedOrigins = []string{"https://a.example.com", "https://b.example.com"}
+	expected.Comments.FlagHideThreshold = 5
+	expected.TrustedProxies = []string{"203.0.113.0/24"}
+	//flags beat env
+	expected.LogLevel = LogLevelDebug
+	expected.Features.TrustProxyHeaders = false
+	expected.RateLimits.Posts = "0"
+	expected.Tracing.Exporter = TraceExporterOTLP
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, c)
+	}
+
+	tomlPath := writeConfigFile(t, dir, "config.toml", `
+addr = ":9002"
+write_timeout = "45s"
+
+[features]
+require_email_verification = true
+`)
+	c, err = Load("test", []string{"-require-email-verification=false"}, envFrom(map[string]string{"CONFIG_FILE": tomlPath}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != ":9002" || c.WriteTimeout.Duration != 45*time.Second || c.Features.RequireEmailVerification {
+		t.Errorf("Expected the TOML file overridden by flags, got %#v", c)
+	}
+}
+
+func Test_Load_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		args []string
+		env  map[string]string
+	}{
+		{[]string{"-storage", "postgres"}, nil},
+		{[]string{"-log-level", "loud"}, nil},
+		{nil, map[string]string{"READ_TIMEOUT": "soon"}},
+		{nil, map[string]string{"REQUIRE_AUTH_FOR_WRITES": "maybe"}},
+		{nil, map[string]string{"CORS_MAX_AGE_SECONDS": "forever"}},
+		{nil, map[string]string{"TLS_RELOAD_INTERVAL_SECONDS": "0"}},
+		{[]string{"-tls-cert-file", "cert.pem"}, nil},
+		{nil, map[string]string{"SESSION_TTL": "0s"}},
+		{nil, map[string]string{"MAX_BODY_BYTES": "0"}},
+		{nil, map[string]string{"COMMENT_EDIT_WINDOW": "-1m"}},
+		{nil, map[string]string{"MAILER": "pigeon"}},
+		{[]string{"-mailer", "smtp"}, nil},
+		{nil, map[string]string{"NOTIFICATION_DELIVERY": "pager"}},
+		{nil, map[string]string{"TRACE_EXPORTER": "jaeger"}},
+		{nil, map[string]string{"TRUSTED_PROXIES": "10.0.0.1"}},
+		{[]string{"-config", writeConfigFile(t, dir, "typo.yaml", "adress: \":9000\"\n")}, nil},
+		{[]string{"-config", writeConfigFile(t, dir, "typo.toml", "adress = \":9000\"\n")}, nil},
+		{[]string{"-config", writeConfigFile(t, dir, "config.json", "{}")}, nil},
+		{[]string{"-no-such-flag"}, nil},
+	}
+	for _, c := range cases {
+		_, err := Load("test", c.args, envFrom(c.env))
+		if err == nil {
+			t.Errorf("Expected an error loading args %v and env %v", c.args, c.env)
+		}
+	}
+}
+
+func Test_LevelEnabled(t *testing.T) {
+	if !LevelEnabled(LogLevelInfo, LogLevelError) || LevelEnabled(LogLevelWarn, LogLevelInfo) {
+		t.Errorf("Expected levels at or above the configured level to be enabled")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/gorilla/mux"
+)
+
+//response headers browsers let cross-origin scripts read
+var corsExposedHeaders = []string{"Deprecation", "ETag", "Link", "Retry-After", "Sunset", "X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+//allowedOrigin checks origin against origins, returning whether it is allowed and whether that was only through the * wildcard
+func allowedOrigin(origins []string, origin string) (allowed, wildcard bool) {
+	for _, allowedOrigin := range origins {
+		if strings.EqualFold(allowedOrigin, origin) {
+			return true, false
+		}
+		if allowedOrigin == "*" {
+			wildcard = true
+		}
+	}
+	return wildcard, wildcard
+}
+
+//routeMethods returns which of allowedMethods router has a route for at the path of req
+func routeMethods(router *mux.Router, allowedMethods []string, req *http.Request) []string {
+	methods := []string{}
+	for _, method := range allowedMethods {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+//corsMiddleware adds CORS headers for allowed origins and answers preflight requests with the methods the requested route supports.
+//It wraps the whole router, since preflight OPTIONS requests don't match any route
+func corsMiddleware(cors config.CORS, router *mux.Router) http.Handler {
+	const funcname = "corsMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//even responses without CORS headers vary by origin, so caches don't serve them to origins that should get them
+		w.Header().Add("Vary", "Origin")
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			router.ServeHTTP(w, req)
+			return
+		}
+
+		allowed, wildcard := allowedOrigin(cors.AllowedOrigins, origin)
+		isPreflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+		if !allowed {
+			if isPreflight {
+				err := fmt.Errorf("Origin %s is not allowed", origin)
+				logError(req.Context(), funcname, err)
+				respondWithError(w, http.StatusForbidden, err)
+				return
+			}
+			//browsers will refuse to show the response to the page
+			router.ServeHTTP(w, req)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if !wildcard {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !isPreflight {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+			router.ServeHTTP(w, req)
+			return
+		}
+
+		methods := routeMethods(router, cors.AllowedMethods, req)
+		if len(methods) == 0 {
+			err := fmt.Errorf("No route found for %s", req.URL.Path)
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusNotFound, err)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAgeSeconds))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/gorilla/mux"
+)
+
+func Test_CORSMiddleware(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cors := config.Default().CORS
+	cors.AllowedOrigins = []string{"https://reviews.example.com"}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/blog", getBlogPostsIDsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/blog", createBlogPostHandler).Methods(http.MethodPost)
+	r.HandleFunc("/blog/{id}", getSingleBlogPostHandler).Methods(http.MethodGet)
+	r.HandleFunc("/blog/{id}", deleteBlogPostHandler).Methods(http.MethodDelete)
+	handler := corsMiddleware(cors, r)
+
+	cases := []struct {
+		method                 string
+		path                   string
+		origin                 string
+		expectedStatusCode     int
+		expectedAllowOrigin    string
+		expectedAllowedMethods string
+	}{
+		//preflights get the methods of the route they're for
+		{http.MethodOptions, "/blog", "https://reviews.example.com", http.StatusNoContent, "https://reviews.example.com", "GET, POST"},
+		{http.MethodOptions, "/blog/123", "https://reviews.example.com", http.StatusNoContent, "https://reviews.example.com", "GET, DELETE"},
+		{http.MethodOptions, "/nope", "https://reviews.example.com", http.StatusNotFound, "https://reviews.example.com", ""},
+		{http.MethodOptions, "/blog", "https://evil.example.com", http.StatusForbidden, "", ""},
+		//actual requests only get CORS headers for allowed origins
+		{http.MethodGet, "/blog", "https://reviews.example.com", http.StatusOK, "https://reviews.example.com", ""},
+		{http.MethodGet, "/blog", "https://evil.example.com", http.StatusOK, "", ""},
+		{http.MethodGet, "/blog", "", http.StatusOK, "", ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if c.method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d for %s %s from %q, got %d", c.expectedStatusCode, c.method, c.path, c.origin, rec.Code)
+		}
+		if actual := rec.Header().Get("Access-Control-Allow-Origin"); actual != c.expectedAllowOrigin {
+			t.Errorf("Expected allowed origin %q for %s %s from %q, got %q", c.expectedAllowOrigin, c.method, c.path, c.origin, actual)
+		}
+		if actual := rec.Header().Get("Access-Control-Allow-Methods"); actual != c.expectedAllowedMethods {
+			t.Errorf("Expected allowed methods %q for %s %s, got %q", c.expectedAllowedMethods, c.method, c.path, actual)
+		}
+		//whether or not the request had an Origin, so shared caches keep the responses apart
+		if vary := rec.Header()["Vary"]; !containsString(vary, "Origin") {
+			t.Errorf("Expected Vary: Origin for %s %s from %q, got %q", c.method, c.path, c.origin, vary)
+		}
+		if c.expectedAllowOrigin != "" && rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Errorf("Expected credentials to be allowed for %s", c.origin)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"CSRFToken"`
+}
+
+const csrfCookieName = "csrf_token"
+const csrfHeader = "X-CSRF-Token"
+
+func newCSRFToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	_, err := rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+//setCSRFCookie stores token in a cookie scripts can read, so they can repeat it in the X-CSRF-Token header. An empty token clears it
+func setCSRFCookie(w http.ResponseWriter, req *http.Request, token string) {
+	cookie := &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(currentConfig(req).SessionTTL.Duration),
+		Secure:   currentConfig(req).Features.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.Expires = time.Time{}
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+//csrfMiddleware makes mutating requests that carry a session cookie repeat the CSRF cookie in the X-CSRF-Token header.
+//Other sites can get a browser to send our cookies, but can't read them to set the header. Bearer token and API key requests don't carry cookies, so aren't checked
+func csrfMiddleware(next http.Handler) http.Handler {
+	const funcname = "csrfMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, req)
+			return
+		}
+		if _, err := req.Cookie(sessionCookieName); err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		cookie, err := req.Cookie(csrfCookieName)
+		header := req.Header.Get(csrfHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+			err = fmt.Errorf("Missing or invalid CSRF token, send the %s cookie in the %s header", csrfCookieName, csrfHeader)
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusForbidden, err)
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+//csrfTokenHandler gives the CSRF token to frontends on other origins, which can't read our cookies themselves
+func csrfTokenHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "csrfTokenHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	var token string
+	if cookie, err := req.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		token = cookie.Value
+	} else {
+		token, err = newCSRFToken()
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error generating CSRF token"))
+			return
+		}
+		setCSRFCookie(w, req, token)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: CSRFTokenResponse{CSRFToken: token}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
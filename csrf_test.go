@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+)
+
+func Test_CSRFMiddleware(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	_, err := db.RegisterAPIKey(context.Background(), inMemDB, db.SystemActor, "Review Importer", "eak_importer", []string{db.ScopePostsWrite}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := sessionMiddleware(csrfMiddleware(apiKeyMiddleware(http.HandlerFunc(createBlogPostHandler))))
+	sessionCookie := loginAs(t, "Dr. Eggman")
+
+	//frontends on other origins ask for the token
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/auth/csrf", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	http.HandlerFunc(csrfTokenHandler).ServeHTTP(rec, req)
+	var tokenResponse struct {
+		Data CSRFTokenResponse `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &tokenResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	csrfToken := tokenResponse.Data.CSRFToken
+	if csrfToken == "" || len(rec.Result().Cookies()) != 1 || rec.Result().Cookies()[0].Value != csrfToken {
+		t.Fatalf("Expected a CSRF token matching the cookie, got %s and %#v", csrfToken, rec.Result().Cookies())
+	}
+	csrfCookie := rec.Result().Cookies()[0]
+
+	cases := []struct {
+		cookies            []*http.Cookie
+		headers            map[string]string
+		expectedStatusCode int
+	}{
+		{[]*http.Cookie{sessionCookie}, nil, http.StatusForbidden},
+		{[]*http.Cookie{sessionCookie, csrfCookie}, nil, http.StatusForbidden},
+		{[]*http.Cookie{sessionCookie, csrfCookie}, map[string]string{csrfHeader: "forged"}, http.StatusForbidden},
+		{[]*http.Cookie{sessionCookie, csrfCookie}, map[string]string{csrfHeader: csrfToken}, http.StatusOK},
+		//no cookies, nothing for another site to abuse
+		{nil, map[string]string{apiKeyHeader: "eak_importer"}, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		for _, cookie := range c.cookies {
+			req.AddCookie(cookie)
+		}
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d with %d cookies and headers %v, got %d", c.expectedStatusCode, len(c.cookies), c.headers, rec.Code)
+		}
+	}
+}
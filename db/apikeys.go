@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+//Scopes an APIKey can be granted
+const (
+	ScopeRead             = "read"
+	ScopePostsWrite       = "posts:write"
+	ScopeCommentsWrite    = "comments:write"
+	ScopeCommentsModerate = "comments:moderate"
+	ScopeAdmin            = "admin"
+)
+
+//apiKeyPrefix makes API keys recognisable, eg in secret scanners and logs
+const apiKeyPrefix = "eak_"
+
+//APIKey is a long-lived credential for integrations. Only a hash of the key is stored, the key itself is shown once when minted
+type APIKey struct {
+	ID         string     `json:"ID"`
+	Name       string     `json:"Name"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"Scopes"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+	ExpiresAt  *time.Time `json:"ExpiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"LastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"RevokedAt,omitempty"`
+}
+
+//Checks if scope is valid
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopePostsWrite, ScopeCommentsWrite, ScopeCommentsModerate, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+//HasScope checks if the key was granted scope. The admin scope grants everything
+func (key APIKey) HasScope(scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+//Mints a new API key named name with scopes, expiring after ttl (never if 0). The key is returned only this once
+func CreateAPIKey(ctx context.Context, inMemDB *DB, actor Actor, name string, scopes []string, ttl time.Duration) (apiKey *APIKey, key string, err error) {
+	ctx, span := startSpan(ctx, "CreateAPIKey")
+	defer endSpan(span, &err)
+
+	keyBytes := make([]byte, 32)
+	_, err = rand.Read(keyBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(keyBytes)
+
+	apiKey, err = RegisterAPIKey(ctx, inMemDB, actor, name, key, scopes, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+//Stores an API key chosen by the caller, eg a bootstrap admin key from the environment
+func RegisterAPIKey(ctx context.Context, inMemDB *DB, actor Actor, name, key string, scopes []string, ttl time.Duration) (apiKey *APIKey, err error) {
+	_, span := startSpan(ctx, "RegisterAPIKey")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	createdAt := now()
+	newKey := APIKey{ID: ksuid.New().String(), Name: name, KeyHash: hashToken(key), Scopes: scopes, CreatedAt: createdAt}
+	if ttl > 0 {
+		expiresAt := createdAt.Add(ttl)
+		newKey.ExpiresAt = &expiresAt
+	}
+	err = txn.Insert(APIKeysTable, newKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = commitAudited(txn, actor, "RegisterAPIKey")
+	if err != nil {
+		return nil, err
+	}
+	return &newKey, nil
+}
+
+//Gets all API keys, revoked ones included, oldest first
+func GetAPIKeys(ctx context.Context, inMemDB *DB) (apiKeys []APIKey, err error) {
+	_, span := startSpan(ctx, "GetAPIKeys")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	result, err := txn.Get(APIKeysTable, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys = []APIKey{}
+	for foundObj := result.Next(); foundObj != nil; foundObj = result.Next() {
+		apiKeys = append(apiKeys, foundObj.(APIKey))
+	}
+	sort.SliceStable(apiKeys, func(i, j int) bool {
+		return apiKeys[i].CreatedAt.Before(apiKeys[j].CreatedAt)
+	})
+
+	return apiKeys, nil
+}
+
+//Looks up the API key key, recording that it was used. apiKey is nil if it doesn't exist, was revoked or has expired
+func AuthenticateAPIKey(ctx context.Context, inMemDB *DB, key string) (apiKey *APIKey, err error) {
+	_, span := startSpan(ctx, "AuthenticateAPIKey")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, true)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(APIKeysTable, "keyhash", hashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if foundObj == nil {
+		return nil, nil
+	}
+
+	foundKey := foundObj.(APIKey)
+	usedAt := now()
+	if foundKey.RevokedAt != nil || (foundKey.ExpiresAt != nil && usedAt.After(*foundKey.ExpiresAt)) {
+		return nil, nil
+	}
+
+	foundKey.LastUsedAt = &usedAt
+	err = txn.Insert(APIKeysTable, foundKey)
+	if err != nil {
+		return nil, err
+	}
+
+	txn.Commit()
+	return &foundKey, nil
+}
+
+//Revokes an API key so it can no longer be used. It is kept so it still shows up when listing keys. exists indicates if err is 404 or something else
+func RevokeAPIKey(ctx context.Context, inMemDB *DB, actor Actor, keyID string) (exists bool, err error) {
+	_, span := startSpan(ctx, "RevokeAPIKey")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(APIKeysTable, "id", keyID)
+	if err != nil {
+		return false, err
+	}
+	if foundObj == nil {
+		return false, nil
+	}
+
+	foundKey := foundObj.(APIKey)
+	if foundKey.RevokedAt == nil {
+		revokedAt := now()
+		foundKey.RevokedAt = &revokedAt
+		err = txn.Insert(APIKeysTable, foundKey)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	err = commitAudited(txn, actor, "RevokeAPIKey")
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
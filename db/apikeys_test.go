@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_APIKeys(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	mintedAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(mintedAt)
+	defer restoreClock()
+
+	apiKey, key, err := CreateAPIKey(context.Background(), db, SystemActor, "review importer", []string{ScopeRead, ScopePostsWrite}, time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || apiKey.KeyHash == key {
+		t.Errorf("Expected a prefixed key stored hashed, got %s", key)
+	}
+	if apiKey.ExpiresAt == nil || !apiKey.ExpiresAt.Equal(mintedAt.Add(time.Hour)) {
+		t.Errorf("Expected key to expire an hour after minting, got %v", apiKey.ExpiresAt)
+	}
+	if !apiKey.HasScope(ScopePostsWrite) || apiKey.HasScope(ScopeCommentsModerate) {
+		t.Errorf("Expected key to have exactly its granted scopes, got %v", apiKey.Scopes)
+	}
+
+	found, err := AuthenticateAPIKey(context.Background(), db, "eak_guessed")
+	if err != nil {
+		t.Error(err)
+	}
+	if found != nil {
+		t.Errorf("Expected unknown key to be rejected, got %#v", *found)
+	}
+
+	usedAt := mintedAt.Add(time.Minute)
+	fixClock(usedAt)
+	found, err = AuthenticateAPIKey(context.Background(), db, key)
+	if err != nil {
+		t.Error(err)
+	}
+	if found == nil || found.ID != apiKey.ID {
+		t.Fatalf("Expected to authenticate as key %s, got %#v", apiKey.ID, found)
+	}
+	apiKeys, err := GetAPIKeys(context.Background(), db)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(apiKeys) != 1 || apiKeys[0].LastUsedAt == nil || !apiKeys[0].LastUsedAt.Equal(usedAt) {
+		t.Errorf("Expected last use to be recorded, got %#v", apiKeys)
+	}
+
+	fixClock(mintedAt.Add(2 * time.Hour))
+	found, err = AuthenticateAPIKey(context.Background(), db, key)
+	if err != nil {
+		t.Error(err)
+	}
+	if found != nil {
+		t.Error("Expected expired key to be rejected")
+	}
+
+	fixClock(mintedAt)
+	apiKey, key, err = CreateAPIKey(context.Background(), db, SystemActor, "ci bot", []string{ScopeAdmin}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	exists, err := RevokeAPIKey(context.Background(), db, SystemActor, apiKey.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Error("Expected key to exist")
+	}
+	found, err = AuthenticateAPIKey(context.Background(), db, key)
+	if err != nil {
+		t.Error(err)
+	}
+	if found != nil {
+		t.Error("Expected revoked key to be rejected")
+	}
+
+	exists, err = RevokeAPIKey(context.Background(), db, SystemActor, "nope")
+	if err != nil {
+		t.Error(err)
+	}
+	if exists {
+		t.Error("Expected unknown key to not exist")
+	}
+}
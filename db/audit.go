@@ -0,0 +1,247 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+//Actor is who made a change, for the audit log. Name is empty for anonymous requests
+type Actor struct {
+	Name string `json:"Name"`
+	Role string `json:"Role,omitempty"`
+	IP   string `json:"IP,omitempty"`
+}
+
+//SystemActor makes changes on behalf of the server itself, eg delivering notifications
+var SystemActor = Actor{Name: "system"}
+
+//Audit actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+//AuditEntry records a single object changing. One operation, eg DeleteBlogPost, can change many objects
+type AuditEntry struct {
+	ID        string    `json:"ID"`
+	At        time.Time `json:"At"`
+	Actor     Actor     `json:"Actor"`
+	Operation string    `json:"Operation"`
+	Action    string    `json:"Action"`
+	Table     string    `json:"Table"`
+	TargetID  string    `json:"TargetID"`
+	ArticleID string    `json:"ArticleID,omitempty"`
+	CommentID string    `json:"CommentID,omitempty"`
+	//the object as JSON before and after the change, null when it was created or deleted
+	Before json.RawMessage `json:"Before"`
+	After  json.RawMessage `json:"After"`
+}
+
+//AuditFilter narrows down audit entries. Empty fields match everything
+type AuditFilter struct {
+	ActorName string
+	Action    string
+	Table     string
+	TargetID  string
+	ArticleID string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (filter AuditFilter) matches(entry AuditEntry) bool {
+	return (filter.ActorName == "" || entry.Actor.Name == filter.ActorName) &&
+		(filter.Action == "" || entry.Action == filter.Action) &&
+		(filter.Table == "" || entry.Table == filter.Table) &&
+		(filter.TargetID == "" || entry.TargetID == filter.TargetID) &&
+		(filter.ArticleID == "" || entry.ArticleID == filter.ArticleID) &&
+		(filter.Since.IsZero() || !entry.At.Before(filter.Since)) &&
+		(filter.Until.IsZero() || entry.At.Before(filter.Until))
+}
+
+//AuditWriter persists audit entries so they outlive the process
+type AuditWriter interface {
+	Append(entries []AuditEntry) error
+}
+
+//AuditFile appends audit entries as lines of JSON to the file at Path, syncing after every write
+type AuditFile struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (f *AuditFile) Append(entries []AuditEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	enc := json.NewEncoder(file)
+	for _, entry := range entries {
+		err = enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+//LoadAuditLog reads the entries an AuditFile wrote at path back into inMemDB, eg after a restart. A missing file is fine
+func LoadAuditLog(ctx context.Context, inMemDB *DB, path string) (loaded int, err error) {
+	_, span := startSpan(ctx, "LoadAuditLog")
+	defer endSpan(span, &err)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	txn := beginTxn(inMemDB, true)
+	defer txn.Abort()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return 0, err
+		}
+		err = txn.Insert(AuditLogTable, entry)
+		if err != nil {
+			return 0, err
+		}
+		loaded++
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	txn.Commit()
+	return loaded, nil
+}
+
+//beginAudited starts a write transaction whose changes get audited by commitAudited
+func beginAudited(inMemDB *DB) *timedTxn {
+	txn := beginTxn(inMemDB, true)
+	txn.TrackChanges()
+	return txn
+}
+
+//auditTargets works out which post and comment a changed object belongs to
+func auditTargets(obj interface{}) (targetID, articleID, commentID string) {
+	switch o := obj.(type) {
+	case BlogPost:
+		return o.ID, o.ID, ""
+	case BlogComment:
+		return o.ID, o.ArticleID, o.ID
+	case CommentRevision:
+		return o.ID, "", o.CommentID
+	case CommentFlag:
+		return o.ID, o.ArticleID, o.CommentID
+	case User:
+		return o.ID, "", ""
+	case APIKey:
+		return o.ID, "", ""
+	}
+	return "", "", ""
+}
+
+//commitAudited records every change made in txn as an AuditEntry, then commits it.
+//Entries are written out first, so nothing is committed without being audited
+func commitAudited(txn *timedTxn, actor Actor, operation string) error {
+	at := now()
+	entries := []AuditEntry{}
+	for _, change := range txn.Changes() {
+		//mentions queued by a comment are outbox records, the comment itself is what gets audited
+		if change.Table == NotificationsTable {
+			continue
+		}
+		entry := AuditEntry{ID: ksuid.New().String(), At: at, Actor: actor, Operation: operation, Table: change.Table}
+		obj := change.After
+		switch {
+		case change.Created():
+			entry.Action = AuditActionCreate
+		case change.Deleted():
+			entry.Action = AuditActionDelete
+			obj = change.Before
+		default:
+			entry.Action = AuditActionUpdate
+		}
+		entry.TargetID, entry.ArticleID, entry.CommentID = auditTargets(obj)
+
+		var err error
+		entry.Before, err = json.Marshal(change.Before)
+		if err != nil {
+			return err
+		}
+		entry.After, err = json.Marshal(change.After)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries {
+		err := txn.Insert(AuditLogTable, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	if txn.db.AuditWriter != nil {
+		err := txn.db.AuditWriter.Append(entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	txn.Commit()
+	return nil
+}
+
+//Gets a page of the audit entries matching filter, newest first. total is how many match altogether
+func GetAuditEntries(ctx context.Context, inMemDB *DB, filter AuditFilter, offset, limit int) (entries []AuditEntry, total int, err error) {
+	_, span := startSpan(ctx, "GetAuditEntries")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(AuditLogTable, "id")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matching := []AuditEntry{}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		entry := obj.(AuditEntry)
+		if filter.matches(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].At.Equal(matching[j].At) {
+			return matching[i].ID > matching[j].ID
+		}
+		return matching[i].At.After(matching[j].At)
+	})
+
+	start, end := pageBounds(len(matching), offset, limit)
+	return matching[start:end], len(matching), nil
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failingAuditWriter struct{}
+
+func (failingAuditWriter) Append(entries []AuditEntry) error {
+	return fmt.Errorf("disk full")
+}
+
+func Test_AuditLog(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(createdAt)
+	defer restoreClock()
+
+	eggman := Actor{Name: "Dr. Eggman", Role: RoleAuthor, IP: "10.0.0.1"}
+	sonic := Actor{Name: "Sonic", IP: "10.0.0.2"}
+	articleID, err := CreateBlogPost(context.Background(), db, eggman, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixClock(createdAt.Add(time.Minute))
+	commentID, err := CreateBlogComment(context.Background(), db, sonic, BlogComment{ArticleID: articleID, AuthorName: "Sonic", CommentText: "you're too slow"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixClock(createdAt.Add(2 * time.Minute))
+	_, err = DeleteBlogPost(context.Background(), db, eggman, articleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, total, err := GetAuditEntries(context.Background(), db, AuditFilter{}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 4 || len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d of %d: %#v", len(entries), total, entries)
+	}
+	newest := entries[0]
+	if newest.Operation != "DeleteBlogPost" || newest.Action != AuditActionDelete || newest.Actor != eggman {
+		t.Errorf("Expected the post deletion first, got %#v", newest)
+	}
+	if string(newest.After) != "null" || len(newest.Before) == 0 {
+		t.Errorf("Expected a deletion to keep only the before state, got before %s after %s", newest.Before, newest.After)
+	}
+	oldest := entries[3]
+	if oldest.Action != AuditActionCreate || oldest.Table != BlogPostTable || oldest.TargetID != articleID || string(oldest.Before) != "null" {
+		t.Errorf("Expected the post creation last, got %#v", oldest)
+	}
+
+	entries, total, err = GetAuditEntries(context.Background(), db, AuditFilter{ActorName: "Sonic"}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 1 || entries[0].CommentID != commentID || entries[0].ArticleID != articleID || entries[0].Actor.IP != "10.0.0.2" {
+		t.Errorf("Expected only Sonic's comment, got %d: %#v", total, entries)
+	}
+	_, total, err = GetAuditEntries(context.Background(), db, AuditFilter{Table: CommentsTable, Action: AuditActionDelete}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 1 {
+		t.Errorf("Expected the comment deleted along with its post, got %d entries", total)
+	}
+	_, total, err = GetAuditEntries(context.Background(), db, AuditFilter{Since: createdAt.Add(time.Minute), Until: createdAt.Add(2 * time.Minute)}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 1 {
+		t.Errorf("Expected 1 entry between since and until, got %d", total)
+	}
+	entries, total, err = GetAuditEntries(context.Background(), db, AuditFilter{}, 3, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 4 || len(entries) != 1 {
+		t.Errorf("Expected the last page to have 1 of 4 entries, got %d of %d", len(entries), total)
+	}
+}
+
+func Test_AuditFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	loaded, err := LoadAuditLog(context.Background(), db, path)
+	if err != nil || loaded != 0 {
+		t.Errorf("Expected a missing audit file to load nothing, got %d, %v", loaded, err)
+	}
+
+	db.AuditWriter = &AuditFile{Path: path}
+	_, err = CreateUser(context.Background(), db, SystemActor, "eggman", "Dr. Eggman", "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SetUserRole(context.Background(), db, Actor{Name: "admin", Role: RoleAdmin}, "eggman", RoleEditor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//pretend the server restarted
+	restarted, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	loaded, err = LoadAuditLog(context.Background(), restarted, path)
+	if err != nil {
+		t.Error(err)
+	}
+	if loaded != 2 {
+		t.Errorf("Expected 2 audit entries to be reloaded, got %d", loaded)
+	}
+	entries, _, err := GetAuditEntries(context.Background(), restarted, AuditFilter{Action: AuditActionUpdate}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 1 || entries[0].Operation != "SetUserRole" || entries[0].Actor.Name != "admin" {
+		t.Errorf("Expected the role change to be reloaded, got %#v", entries)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+	}
+	if strings.Contains(string(raw), "PasswordHash") {
+		t.Errorf("Expected password hashes to be left out of the audit log")
+	}
+
+	//if the audit entry can't be written, the change shouldn't happen either
+	db.AuditWriter = failingAuditWriter{}
+	exists, err := SetUserRole(context.Background(), db, SystemActor, "eggman", RoleAdmin)
+	if !exists || err == nil {
+		t.Errorf("Expected an error when the audit log can't be written, got %v", err)
+	}
+	user, err := GetUserByDisplayName(context.Background(), db, "Dr. Eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.Role != RoleEditor {
+		t.Errorf("Expected the role change to be rolled back, got %#v", user)
+	}
+}
+
+func Test_AuditLog_LeavesOut(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	db.AuditWriter = &AuditFile{Path: path}
+
+	userID, err := CreateUser(context.Background(), db, SystemActor, "eggman", "Dr. Eggman", "walnut moon base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := CreateSession(context.Background(), db, userID, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DeleteSession(context.Background(), db, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Dr. Eggman", OwnerID: "user:" + userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Sonic", CommentText: "@Dr. Eggman you're too slow", PendingEmail: "sonic@example.com"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = VerifyCommentEmail(context.Background(), db, SystemActor, commentID, "sonic@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := GetUndeliveredNotifications(context.Background(), db)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("Expected the mention to be queued, got %#v", pending)
+	}
+	_, err = MarkNotificationDelivered(context.Background(), db, pending[0].ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	//logging in and out and the notification outbox aren't audited
+	for _, table := range []string{SessionsTable, NotificationsTable} {
+		_, total, err := GetAuditEntries(context.Background(), db, AuditFilter{Table: table}, 0, 10)
+		if err != nil {
+			t.Error(err)
+		}
+		if total != 0 {
+			t.Errorf("Expected nothing audited from %s, got %d entries", table, total)
+		}
+	}
+	entries, _, err := GetAuditEntries(context.Background(), db, AuditFilter{TargetID: commentID, Action: AuditActionUpdate}, 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(entries) != 1 || entries[0].Operation != "VerifyCommentEmail" {
+		t.Errorf("Expected the comment being published to be audited, got %#v", entries)
+	}
+
+	//nor is the email a comment was verified with, or the session token
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+	}
+	for _, secret := range []string{"sonic@example.com", token, hashToken(token)} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("Expected %q to be left out of the audit log", secret)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+//AuthorStats summarises someone's activity across posts and comments
+type AuthorStats struct {
+	AuthorName    string    `json:"AuthorName"`
+	PostCount     int       `json:"PostCount"`
+	CommentCount  int       `json:"CommentCount"`
+	FirstActivity time.Time `json:"FirstActivity"`
+	LastActivity  time.Time `json:"LastActivity"`
+}
+
+func (stats *AuthorStats) addActivity(at time.Time) {
+	if stats.FirstActivity.IsZero() || at.Before(stats.FirstActivity) {
+		stats.FirstActivity = at
+	}
+	if at.After(stats.LastActivity) {
+		stats.LastActivity = at
+	}
+}
+
+//parent should already grab a transaction handler already
+//Walks the distinct values of the authorname index of table, jumping over each author's rows once one readers can see is found
+func collectAuthorNamesWithTxn(txn *timedTxn, table string, names map[string]bool) error {
+	it, err := txn.LowerBound(table, "authorname", "")
+	if err != nil {
+		return err
+	}
+
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		var name string
+		switch row := obj.(type) {
+		case BlogPost:
+			name = row.AuthorName
+		case BlogComment:
+			if !row.Visible() {
+				//hidden and pending comments don't count, so keep looking through this author's comments
+				continue
+			}
+			name = row.AuthorName
+		}
+		names[name] = true
+
+		//index keys are the name followed by \x00, so this seeks past every row by this author
+		it, err = txn.LowerBound(table, "authorname", name+"\x01")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Returns the names of everyone who has posted or has a comment readers can see, sorted
+func GetAuthorNames(ctx context.Context, inMemDB *DB) (names []string, err error) {
+	_, span := startSpan(ctx, "GetAuthorNames")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	found := map[string]bool{}
+	for _, table := range []string{BlogPostTable, CommentsTable} {
+		err = collectAuthorNamesWithTxn(txn, table, found)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+//Gets an author's activity summary. stats is nil if they have no posts or visible comments
+func GetAuthorStats(ctx context.Context, inMemDB *DB, authorName string) (stats *AuthorStats, err error) {
+	_, span := startSpan(ctx, "GetAuthorStats")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	stats = &AuthorStats{AuthorName: authorName}
+
+	it, err := txn.Get(BlogPostTable, "authorname", authorName)
+	if err != nil {
+		return nil, err
+	}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		stats.PostCount++
+		stats.addActivity(obj.(BlogPost).CreatedAt)
+	}
+
+	it, err = txn.Get(CommentsTable, "authorname", authorName)
+	if err != nil {
+		return nil, err
+	}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		comment := obj.(BlogComment)
+		if !comment.Visible() {
+			continue
+		}
+		stats.CommentCount++
+		stats.addActivity(comment.CreatedAt)
+		if comment.EditedAt != nil {
+			stats.addActivity(*comment.EditedAt)
+		}
+	}
+
+	if stats.PostCount == 0 && stats.CommentCount == 0 {
+		return nil, nil
+	}
+	return stats, nil
+}
+
+//Returns a page of an author's posts, newest first, along with how many posts they have in total
+func GetAuthorPosts(ctx context.Context, inMemDB *DB, authorName string, offset, limit int) (posts []BlogPost, total int, err error) {
+	_, span := startSpan(ctx, "GetAuthorPosts")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(BlogPostTable, "authorname", authorName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var all []BlogPost
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		all = append(all, obj.(BlogPost))
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+
+	start, end := pageBounds(len(all), offset, limit)
+	return all[start:end], len(all), nil
+}
+
+//Returns a page of an author's visible comments, newest first, along with how many they have in total
+func GetAuthorComments(ctx context.Context, inMemDB *DB, authorName string, offset, limit int) (comments []BlogComment, total int, err error) {
+	_, span := startSpan(ctx, "GetAuthorComments")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(CommentsTable, "authorname", authorName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var all []BlogComment
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		comment := obj.(BlogComment)
+		if comment.Visible() {
+			all = append(all, comment)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+
+	start, end := pageBounds(len(all), offset, limit)
+	return all[start:end], len(all), nil
+}
+
+//clamps offset and limit to a slice of length n
+func pageBounds(n, offset, limit int) (start, end int) {
+	start = offset
+	if start > n {
+		start = n
+	}
+	end = start + limit
+	if end > n {
+		end = n
+	}
+	return start, end
+}
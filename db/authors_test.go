@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_AuthorActivity(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	start := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(start)
+	defer restoreClock()
+
+	var postIDs []string
+	for i, author := range []string{"Dr. Eggman", "Sonic", "Dr. Eggman"} {
+		fixClock(start.Add(time.Duration(i) * time.Hour))
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title", ArticleText: "Test Body", AuthorName: author})
+		if err != nil {
+			t.Error(err)
+		}
+		postIDs = append(postIDs, id)
+	}
+	fixClock(start.Add(5 * time.Hour))
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: postIDs[1], AuthorName: "Dr. Eggman", CommentText: "you're too slow"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: postIDs[0], AuthorName: "Anony Mouse", CommentText: "this review sucks"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	//readers can't see these, so their authors aren't listed
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: postIDs[0], AuthorName: "Spammer", CommentText: "one weird trick", Hidden: true}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: postIDs[0], AuthorName: "Unverified", CommentText: "first", PendingEmail: "unverified@example.com"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	names, err := GetAuthorNames(context.Background(), db)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedNames := []string{"Anony Mouse", "Dr. Eggman", "Sonic"}
+	if !reflect.DeepEqual(expectedNames, names) {
+		t.Errorf("Expected authors %#v, got %#v", expectedNames, names)
+	}
+
+	stats, err := GetAuthorStats(context.Background(), db, "Dr. Eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	expectedStats := AuthorStats{AuthorName: "Dr. Eggman", PostCount: 2, CommentCount: 1, FirstActivity: start, LastActivity: start.Add(5 * time.Hour)}
+	if stats == nil || *stats != expectedStats {
+		t.Errorf("Expected stats %#v, got %#v", expectedStats, stats)
+	}
+
+	stats, err = GetAuthorStats(context.Background(), db, "Knuckles")
+	if err != nil {
+		t.Error(err)
+	}
+	if stats != nil {
+		t.Errorf("Expected no stats for someone who never posted, got %#v", *stats)
+	}
+
+	posts, total, err := GetAuthorPosts(context.Background(), db, "Dr. Eggman", 0, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 2 || len(posts) != 1 || posts[0].ID != postIDs[2] {
+		t.Errorf("Expected the newest of 2 posts, got %d posts of %d: %#v", len(posts), total, posts)
+	}
+
+	posts, _, err = GetAuthorPosts(context.Background(), db, "Dr. Eggman", 1, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(posts) != 1 || posts[0].ID != postIDs[0] {
+		t.Errorf("Expected the oldest post on the second page, got %#v", posts)
+	}
+
+	posts, _, err = GetAuthorPosts(context.Background(), db, "Dr. Eggman", 5, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(posts) != 0 {
+		t.Errorf("Expected no posts past the end, got %#v", posts)
+	}
+
+	comments, total, err := GetAuthorComments(context.Background(), db, "Anony Mouse", 0, 10)
+	if err != nil {
+		t.Error(err)
+	}
+	if total != 1 || len(comments) != 1 || comments[0].ArticleID != postIDs[0] {
+		t.Errorf("Expected a single comment on %s, got %#v", postIDs[0], comments)
+	}
+}
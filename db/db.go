@@ -1,7 +1,13 @@
 package db
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/hashicorp/go-memdb"
 	"github.com/segmentio/ksuid"
@@ -9,22 +15,121 @@ import (
 
 //BlogPost represents a single blog post
 type BlogPost struct {
-	ID          string `json:"ID"`
-	Title       string `json:"Title"`
-	ArticleText string `json:"ArticleText"`
-	AuthorName  string `json:"AuthorName"`
+	ID          string    `json:"ID"`
+	Title       string    `json:"Title" validate:"required,max=200"`
+	ArticleText string    `json:"ArticleText" validate:"required,max=50000,multiline"`
+	AuthorName  string    `json:"AuthorName" validate:"max=100"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	//one of CommentStateOpen or CommentStateLocked, empty is treated as open
+	CommentState string `json:"CommentState,omitempty"`
+	//comments close this many days after CreatedAt. 0 falls back to the server-wide setting
+	CommentsCloseAfterDays int `json:"CommentsCloseAfterDays,omitempty"`
+	//when the comment settings last changed, zero if they never have
+	UpdatedAt time.Time `json:"-"`
+	//who posted it, as an identity that can't be posted under like AuthorName can. Empty for anonymous posts
+	OwnerID string `json:"-"`
+}
+
+//LastModified is when the post last changed
+func (post BlogPost) LastModified() time.Time {
+	if post.UpdatedAt.After(post.CreatedAt) {
+		return post.UpdatedAt
+	}
+	return post.CreatedAt
+}
+
+//Comment states of a BlogPost
+const (
+	CommentStateOpen   = "open"
+	CommentStateLocked = "locked"
+	//never stored, only returned by CommentsStatus once a post is past its comment age limit
+	CommentStateClosed = "closed"
+)
+
+//CommentsStatus works out whether the post currently accepts comments, returning one of the CommentState constants.
+//defaultCloseAfter applies when the post doesn't set CommentsCloseAfterDays, and 0 means never close
+func (post BlogPost) CommentsStatus(now time.Time, defaultCloseAfter time.Duration) string {
+	if post.CommentState == CommentStateLocked {
+		return CommentStateLocked
+	}
+
+	closeAfter := defaultCloseAfter
+	if post.CommentsCloseAfterDays > 0 {
+		closeAfter = time.Duration(post.CommentsCloseAfterDays) * 24 * time.Hour
+	}
+	if closeAfter > 0 && now.Sub(post.CreatedAt) > closeAfter {
+		return CommentStateClosed
+	}
+
+	return CommentStateOpen
 }
 
 //BlogComment represents a comment on a BlogPost
 type BlogComment struct {
-	ID          string `json:"ID"`
-	ArticleID   string `json:"ArticleID"`
-	CommentText string `json:"CommentText"`
-	AuthorName  string `json:"AuthorName"`
+	ID          string    `json:"ID"`
+	ArticleID   string    `json:"ArticleID"`
+	CommentText string    `json:"CommentText" validate:"required,max=5000,multiline"`
+	AuthorName  string    `json:"AuthorName" validate:"max=100"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	//nil if the comment has never been edited
+	EditedAt *time.Time `json:"EditedAt,omitempty"`
+	//hidden from readers until a moderator deals with it
+	Hidden bool `json:"Hidden,omitempty"`
+	//set while an anonymous comment waits for its author to verify this email address, hiding it from readers
+	PendingEmail string `json:"-"`
+	//who posted the comment, as an identity that can't be posted under like AuthorName can. Empty for anonymous comments
+	OwnerID string `json:"-"`
+	//hash of the token that lets whoever posted an anonymous comment edit it
+	EditTokenHash string `json:"-"`
+}
+
+//NewEditToken makes the token that lets whoever posts an anonymous comment edit it, keeping only its hash on comment
+func (comment *BlogComment) NewEditToken() (token string, err error) {
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(tokenBytes)
+	comment.EditTokenHash = hashToken(token)
+	return token, nil
+}
+
+//CanEditWith is whether token is the comment's edit token
+func (comment BlogComment) CanEditWith(token string) bool {
+	return comment.EditTokenHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(comment.EditTokenHash)) == 1
+}
+
+//LastModified is when the comment last changed, as far as readers can see
+func (comment BlogComment) LastModified() time.Time {
+	if comment.EditedAt != nil {
+		return *comment.EditedAt
+	}
+	return comment.CreatedAt
+}
+
+//Visible is whether readers can see the comment
+func (comment BlogComment) Visible() bool {
+	return !comment.Hidden && comment.PendingEmail == ""
+}
+
+//CommentRevision is a previous text of an edited BlogComment
+type CommentRevision struct {
+	ID          string    `json:"ID"`
+	CommentID   string    `json:"CommentID"`
+	CommentText string    `json:"CommentText"`
+	ReplacedAt  time.Time `json:"ReplacedAt"`
 }
 
 const BlogPostTable = "BlogPost"
 const CommentsTable = "Comments"
+const CommentRevisionsTable = "CommentRevisions"
+const NotificationsTable = "Notifications"
+const CommentFlagsTable = "CommentFlags"
+const UsersTable = "Users"
+const SessionsTable = "Sessions"
+const APIKeysTable = "APIKeys"
+const AuditLogTable = "AuditLog"
 
 //InMemSchema is the schema for the in-memory database
 var InMemSchema = &memdb.DBSchema{
@@ -79,22 +184,156 @@ var InMemSchema = &memdb.DBSchema{
 				},
 			},
 		},
+		"CommentRevisions": &memdb.TableSchema{
+			Name: CommentRevisionsTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"commentid": &memdb.IndexSchema{
+					Name:    "commentid",
+					Unique:  false,
+					Indexer: &memdb.StringFieldIndex{Field: "CommentID"},
+				},
+			},
+		},
+		"Notifications": &memdb.TableSchema{
+			Name: NotificationsTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"recipient": &memdb.IndexSchema{
+					Name:    "recipient",
+					Unique:  false,
+					Indexer: &memdb.StringFieldIndex{Field: "RecipientID"},
+				},
+				"delivered": &memdb.IndexSchema{
+					Name:    "delivered",
+					Unique:  false,
+					Indexer: &memdb.BoolFieldIndex{Field: "Delivered"},
+				},
+			},
+		},
+		"CommentFlags": &memdb.TableSchema{
+			Name: CommentFlagsTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"commentid": &memdb.IndexSchema{
+					Name:    "commentid",
+					Unique:  false,
+					Indexer: &memdb.StringFieldIndex{Field: "CommentID"},
+				},
+				"commentreporter": &memdb.IndexSchema{
+					Name:   "commentreporter",
+					Unique: true,
+					Indexer: &memdb.CompoundIndex{
+						Indexes: []memdb.Indexer{
+							&memdb.StringFieldIndex{Field: "CommentID"},
+							&memdb.StringFieldIndex{Field: "ReporterID"},
+						},
+					},
+				},
+			},
+		},
+		"Users": &memdb.TableSchema{
+			Name: UsersTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"username": &memdb.IndexSchema{
+					Name:    "username",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "Username", Lowercase: true},
+				},
+				"displayname": &memdb.IndexSchema{
+					Name:    "displayname",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "DisplayName"},
+				},
+			},
+		},
+		"Sessions": &memdb.TableSchema{
+			Name: SessionsTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"userid": &memdb.IndexSchema{
+					Name:    "userid",
+					Unique:  false,
+					Indexer: &memdb.StringFieldIndex{Field: "UserID"},
+				},
+			},
+		},
+		"APIKeys": &memdb.TableSchema{
+			Name: APIKeysTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+				"keyhash": &memdb.IndexSchema{
+					Name:    "keyhash",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "KeyHash"},
+				},
+			},
+		},
+		"AuditLog": &memdb.TableSchema{
+			Name: AuditLogTable,
+			Indexes: map[string]*memdb.IndexSchema{
+				"id": &memdb.IndexSchema{
+					Name:    "id",
+					Unique:  true,
+					Indexer: &memdb.StringFieldIndex{Field: "ID"},
+				},
+			},
+		},
 	},
 }
 
+//timestamps are stored in UTC. Overridden in tests to get predictable timestamps
+var now = func() time.Time {
+	return time.Now().UTC()
+}
+
+//DB is an in-memory database, and where what happens to it is reported. Set those before using it
+type DB struct {
+	*memdb.MemDB
+	//told about every transaction once it ends. nil doesn't report them
+	TxnObserver TxnObserver
+	//every audited change is also written here. nil only keeps them in memory
+	AuditWriter AuditWriter
+}
+
 //Initialise the in-memory database
-func CreateDB() (*memdb.MemDB, error) {
+func CreateDB() (*DB, error) {
 	// Create a new data base
 	db, err := memdb.NewMemDB(InMemSchema)
 	if err != nil {
 		return nil, err
 	}
 
-	return db, nil
+	return &DB{MemDB: db}, nil
 }
 
 //parent should already grab a transaction handler already
-func getBlogPostWithTxn(txn *memdb.Txn, articleID string) (post *BlogPost, err error) {
+func getBlogPostWithTxn(txn *timedTxn, articleID string) (post *BlogPost, err error) {
 	foundObj, err := txn.First(BlogPostTable, "id", articleID)
 	if err != nil {
 		return nil, err
@@ -108,7 +347,7 @@ func getBlogPostWithTxn(txn *memdb.Txn, articleID string) (post *BlogPost, err e
 }
 
 //parent should already grab a transaction handler already
-func getBlogCommentWithTxn(txn *memdb.Txn, commentID string) (comment *BlogComment, err error) {
+func getBlogCommentWithTxn(txn *timedTxn, commentID string) (comment *BlogComment, err error) {
 	foundObj, err := txn.First(CommentsTable, "id", commentID)
 	if err != nil {
 		return nil, err
@@ -122,13 +361,13 @@ func getBlogCommentWithTxn(txn *memdb.Txn, commentID string) (comment *BlogComme
 }
 
 //parent should already grab a transaction handler already
-func getBlogCommentIDsWithTxn(txn *memdb.Txn, articleID string) (ids []string, err error) {
+func getBlogCommentIDsWithTxn(txn *timedTxn, articleID string) (ids []string, err error) {
 	post, err := getBlogPostWithTxn(txn, articleID)
 	if err != nil {
 		return nil, err
 	}
 	if post == nil {
-		return nil, fmt.Errorf("No such blog post %s", articleID)
+		return nil, fmt.Errorf("%w %s", ErrPostNotFound, articleID)
 	}
 
 	it, err := txn.Get(CommentsTable, "articleid", articleID)
@@ -145,13 +384,13 @@ func getBlogCommentIDsWithTxn(txn *memdb.Txn, articleID string) (ids []string, e
 }
 
 //parent should already grab a transaction handler already
-func deleteBlogCommentIDsWithTxn(txn *memdb.Txn, articleID, commentID string) (exists bool, err error) {
+func deleteBlogCommentIDsWithTxn(txn *timedTxn, articleID, commentID string) (exists bool, err error) {
 	blogPost, err := getBlogPostWithTxn(txn, articleID)
 	if err != nil {
 		return false, err
 	}
 	if blogPost == nil {
-		return false, fmt.Errorf("No such blog post %s", articleID)
+		return false, fmt.Errorf("%w %s", ErrPostNotFound, articleID)
 	}
 
 	toDeleteObject, err := getBlogCommentWithTxn(txn, commentID)
@@ -159,7 +398,7 @@ func deleteBlogCommentIDsWithTxn(txn *memdb.Txn, articleID, commentID string) (e
 		return false, err
 	}
 	if toDeleteObject == nil {
-		return false, fmt.Errorf("No such comment %s", commentID)
+		return false, fmt.Errorf("%w %s", ErrCommentNotFound, commentID)
 	}
 
 	err = txn.Delete(CommentsTable, toDeleteObject)
@@ -167,13 +406,26 @@ func deleteBlogCommentIDsWithTxn(txn *memdb.Txn, articleID, commentID string) (e
 		return true, err
 	}
 
+	_, err = txn.DeleteAll(CommentRevisionsTable, "commentid", commentID)
+	if err != nil {
+		return true, err
+	}
+
+	_, err = txn.DeleteAll(CommentFlagsTable, "commentid", commentID)
+	if err != nil {
+		return true, err
+	}
+
 	return true, nil
 }
 
 //Returns a list of all blog IDs
 //TODO: pagination?
-func GetBlogIDs(inMemDB *memdb.MemDB) (ids []string, err error) {
-	txn := inMemDB.Txn(false)
+func GetBlogIDs(ctx context.Context, inMemDB *DB) (ids []string, err error) {
+	_, span := startSpan(ctx, "GetBlogIDs")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
 	defer txn.Abort()
 
 	it, err := txn.Get(BlogPostTable, "id")
@@ -189,34 +441,68 @@ func GetBlogIDs(inMemDB *memdb.MemDB) (ids []string, err error) {
 	return ids, nil
 }
 
+//Counts every stored post and comment, including hidden comments
+func CountBlogPostsAndComments(ctx context.Context, inMemDB *DB) (posts, comments int, err error) {
+	_, span := startSpan(ctx, "CountBlogPostsAndComments")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	for table, count := range map[string]*int{BlogPostTable: &posts, CommentsTable: &comments} {
+		it, err := txn.Get(table, "id")
+		if err != nil {
+			return 0, 0, err
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			*count++
+		}
+	}
+
+	return posts, comments, nil
+}
+
 //Gets a single post. post is nil if such post is not found
-func GetBlogPost(inMemDB *memdb.MemDB, articleID string) (post *BlogPost, err error) {
-	txn := inMemDB.Txn(false)
+func GetBlogPost(ctx context.Context, inMemDB *DB, articleID string) (post *BlogPost, err error) {
+	_, span := startSpan(ctx, "GetBlogPost")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
 	defer txn.Abort()
 
 	return getBlogPostWithTxn(txn, articleID)
 }
 
 //Inserts a new post, generating a unique ID for it and returning that
-func CreateBlogPost(inMemDB *memdb.MemDB, post BlogPost) (id string, err error) {
-	txn := inMemDB.Txn(true)
+func CreateBlogPost(ctx context.Context, inMemDB *DB, actor Actor, post BlogPost) (id string, err error) {
+	_, span := startSpan(ctx, "CreateBlogPost")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
 	defer txn.Abort()
 
 	id = ksuid.New().String()
 	post.ID = id
+	post.CreatedAt = now()
 	err = txn.Insert(BlogPostTable, post)
 
 	if err != nil {
 		return
 	}
 
-	txn.Commit()
+	err = commitAudited(txn, actor, "CreateBlogPost")
+	if err != nil {
+		return "", err
+	}
 	return id, nil
 }
 
 //Deletes a single post and its attendant comments. exists indicates if err is 404 or something else
-func DeleteBlogPost(inMemDB *memdb.MemDB, articleID string) (exists bool, err error) {
-	txn := inMemDB.Txn(true)
+func DeleteBlogPost(ctx context.Context, inMemDB *DB, actor Actor, articleID string) (exists bool, err error) {
+	_, span := startSpan(ctx, "DeleteBlogPost")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
 	defer txn.Abort()
 
 	toDeleteObject, err := getBlogPostWithTxn(txn, articleID)
@@ -247,22 +533,81 @@ func DeleteBlogPost(inMemDB *memdb.MemDB, articleID string) (exists bool, err er
 		return true, err
 	}
 
-	txn.Commit()
+	err = commitAudited(txn, actor, "DeleteBlogPost")
+	if err != nil {
+		return true, err
+	}
 	return true, nil
 }
 
-//Returns a list of all comment IDs on the given articleID
+//Sets the comment state and age limit of a post. exists indicates if err is 404 or something else
+func SetCommentState(ctx context.Context, inMemDB *DB, actor Actor, articleID, state string, closeAfterDays int) (exists bool, err error) {
+	_, span := startSpan(ctx, "SetCommentState")
+	defer endSpan(span, &err)
+
+	if state != CommentStateOpen && state != CommentStateLocked {
+		return true, fmt.Errorf("Invalid comment state %s", state)
+	}
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	post, err := getBlogPostWithTxn(txn, articleID)
+	if err != nil {
+		return false, err
+	}
+	if post == nil {
+		return false, nil
+	}
+
+	post.CommentState = state
+	post.CommentsCloseAfterDays = closeAfterDays
+	post.UpdatedAt = now()
+	err = txn.Insert(BlogPostTable, *post)
+	if err != nil {
+		return true, err
+	}
+
+	err = commitAudited(txn, actor, "SetCommentState")
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+//Returns a list of all comment IDs on the given articleID, leaving out hidden comments
 //TODO: pagination?
-func GetCommentIDs(inMemDB *memdb.MemDB, articleID string) (ids []string, err error) {
-	txn := inMemDB.Txn(false)
+func GetCommentIDs(ctx context.Context, inMemDB *DB, articleID string) (ids []string, err error) {
+	_, span := startSpan(ctx, "GetCommentIDs")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
 	defer txn.Abort()
 
-	return getBlogCommentIDsWithTxn(txn, articleID)
+	allIDs, err := getBlogCommentIDsWithTxn(txn, articleID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range allIDs {
+		comment, err := getBlogCommentWithTxn(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		if comment.Visible() {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
 }
 
-//Gets a single comment. comment is nil if such comment is not found
-func GetBlogComment(inMemDB *memdb.MemDB, articleID, commentID string) (comment *BlogComment, err error) {
-	txn := inMemDB.Txn(false)
+//Gets a single comment. comment is nil if such comment is not found on the post
+func GetBlogComment(ctx context.Context, inMemDB *DB, articleID, commentID string) (comment *BlogComment, err error) {
+	_, span := startSpan(ctx, "GetBlogComment")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
 	defer txn.Abort()
 
 	post, err := getBlogPostWithTxn(txn, articleID)
@@ -270,15 +615,23 @@ func GetBlogComment(inMemDB *memdb.MemDB, articleID, commentID string) (comment
 		return nil, err
 	}
 	if post == nil {
-		return nil, fmt.Errorf("No such blog post")
+		return nil, fmt.Errorf("%w %s", ErrPostNotFound, articleID)
 	}
 
-	return getBlogCommentWithTxn(txn, commentID)
+	comment, err = getBlogCommentWithTxn(txn, commentID)
+	if err != nil || comment == nil || comment.ArticleID != articleID {
+		return nil, err
+	}
+	return comment, nil
 }
 
-//Inserts a new comment, generating a unique ID for it and returning that
-func CreateBlogComment(inMemDB *memdb.MemDB, comment BlogComment) (id string, err error) {
-	txn := inMemDB.Txn(true)
+//Inserts a new comment, generating a unique ID for it and returning that.
+//Fails with ErrCommentsLocked or ErrCommentsClosed if the post doesn't take comments, defaultCloseAfter being as in CommentsStatus
+func CreateBlogComment(ctx context.Context, inMemDB *DB, actor Actor, comment BlogComment, defaultCloseAfter time.Duration) (id string, err error) {
+	_, span := startSpan(ctx, "CreateBlogComment")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
 	defer txn.Abort()
 
 	post, err := getBlogPostWithTxn(txn, comment.ArticleID)
@@ -286,24 +639,47 @@ func CreateBlogComment(inMemDB *memdb.MemDB, comment BlogComment) (id string, er
 		return "", err
 	}
 	if post == nil {
-		return "", fmt.Errorf("No such blog post")
+		return "", fmt.Errorf("%w %s", ErrPostNotFound, comment.ArticleID)
+	}
+	createdAt := now()
+	//checked in the same transaction as the insert, so a post can't be locked in between
+	switch post.CommentsStatus(createdAt, defaultCloseAfter) {
+	case CommentStateLocked:
+		return "", fmt.Errorf("%w on post %s", ErrCommentsLocked, comment.ArticleID)
+	case CommentStateClosed:
+		return "", fmt.Errorf("%w on post %s", ErrCommentsClosed, comment.ArticleID)
 	}
 
 	id = ksuid.New().String()
 	comment.ID = id
+	comment.CreatedAt = createdAt
 	err = txn.Insert(CommentsTable, comment)
 
 	if err != nil {
 		return "", err
 	}
 
-	txn.Commit()
+	//pending comments mention people once they are published
+	if comment.PendingEmail == "" {
+		err = queueMentionNotificationsWithTxn(txn, *post, comment)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = commitAudited(txn, actor, "CreateBlogComment")
+	if err != nil {
+		return "", err
+	}
 	return id, nil
 }
 
 //Deletes a single comment. exists indicates if err is 404 or something else
-func DeleteBlogComment(inMemDB *memdb.MemDB, articleID, commentID string) (exists bool, err error) {
-	txn := inMemDB.Txn(true)
+func DeleteBlogComment(ctx context.Context, inMemDB *DB, actor Actor, articleID, commentID string) (exists bool, err error) {
+	_, span := startSpan(ctx, "DeleteBlogComment")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
 	defer txn.Abort()
 
 	exists, err = deleteBlogCommentIDsWithTxn(txn, articleID, commentID)
@@ -313,6 +689,77 @@ func DeleteBlogComment(inMemDB *memdb.MemDB, articleID, commentID string) (exist
 	if !exists {
 		return exists, err
 	}
-	txn.Commit()
+	err = commitAudited(txn, actor, "DeleteBlogComment")
+	if err != nil {
+		return true, err
+	}
 	return exists, err
 }
+
+//Replaces the text of a comment, keeping the old text as a CommentRevision. exists indicates if err is 404 or something else
+func EditBlogComment(ctx context.Context, inMemDB *DB, actor Actor, articleID, commentID, commentText string) (exists bool, err error) {
+	_, span := startSpan(ctx, "EditBlogComment")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	comment, err := getBlogCommentWithTxn(txn, commentID)
+	if err != nil {
+		return false, err
+	}
+	if comment == nil || comment.ArticleID != articleID {
+		return false, nil
+	}
+
+	editedAt := now()
+	revision := CommentRevision{ID: ksuid.New().String(), CommentID: commentID, CommentText: comment.CommentText, ReplacedAt: editedAt}
+	err = txn.Insert(CommentRevisionsTable, revision)
+	if err != nil {
+		return true, err
+	}
+
+	comment.CommentText = commentText
+	comment.EditedAt = &editedAt
+	err = txn.Insert(CommentsTable, *comment)
+	if err != nil {
+		return true, err
+	}
+
+	err = commitAudited(txn, actor, "EditBlogComment")
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+//Returns the previous texts of a comment, oldest first
+func GetCommentRevisions(ctx context.Context, inMemDB *DB, articleID, commentID string) (revisions []CommentRevision, err error) {
+	_, span := startSpan(ctx, "GetCommentRevisions")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	comment, err := getBlogCommentWithTxn(txn, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil || comment.ArticleID != articleID {
+		return nil, fmt.Errorf("%w %s", ErrCommentNotFound, commentID)
+	}
+
+	it, err := txn.Get(CommentRevisionsTable, "commentid", commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		revisions = append(revisions, obj.(CommentRevision))
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].ReplacedAt.Before(revisions[j].ReplacedAt)
+	})
+
+	return revisions, nil
+}
@@ -1,11 +1,23 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 )
 
+//pins the clock used for timestamps, returning a func that restores it
+func fixClock(fixed time.Time) func() {
+	oldNow := now
+	now = func() time.Time { return fixed }
+	return func() {
+		now = oldNow
+	}
+}
+
 func Test_Schema(t *testing.T) {
 	err := InMemSchema.Validate()
 	if err != nil {
@@ -25,10 +37,12 @@ func Test_CreateBlogPost(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	defer fixClock(createdAt)()
 
-	expected := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
+	expected := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1", CreatedAt: createdAt}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2", CreatedAt: createdAt}}
 	for i := range expected {
-		id, err := CreateBlogPost(db, expected[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, expected[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -61,14 +75,14 @@ func Test_GetBlogIDs(t *testing.T) {
 	sampleBlogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	expected := []string{}
 	for i := range sampleBlogPosts {
-		id, err := CreateBlogPost(db, sampleBlogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, sampleBlogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
 		expected = append(expected, id)
 	}
 
-	actual, err := GetBlogIDs(db)
+	actual, err := GetBlogIDs(context.Background(), db)
 	if err != nil {
 		t.Error(err)
 	}
@@ -90,7 +104,7 @@ func Test_GetBlogIDs_NoPosts(t *testing.T) {
 		t.Error(err)
 	}
 
-	actual, err := GetBlogIDs(db)
+	actual, err := GetBlogIDs(context.Background(), db)
 	if err != nil {
 		t.Error(err)
 	}
@@ -111,16 +125,18 @@ func Test_GetBlogPost(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	defer fixClock(createdAt)()
 
-	expected := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
+	expected := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1", CreatedAt: createdAt}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2", CreatedAt: createdAt}}
 	for i := range expected {
-		id, err := CreateBlogPost(db, expected[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, expected[i])
 		if err != nil {
 			t.Error(err)
 		}
 		expected[i].ID = id
 
-		post, err := GetBlogPost(db, id)
+		post, err := GetBlogPost(context.Background(), db, id)
 		if err != nil {
 			t.Error(err)
 		}
@@ -136,7 +152,7 @@ func Test_GetBlogPost_Nonexistent(t *testing.T) {
 		t.Error(err)
 	}
 
-	post, err := GetBlogPost(db, "this_id_doesnt_exist")
+	post, err := GetBlogPost(context.Background(), db, "this_id_doesnt_exist")
 	if err != nil {
 		t.Error(err)
 	}
@@ -153,7 +169,7 @@ func Test_DeleteBlogPost(t *testing.T) {
 
 	expected := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range expected {
-		id, err := CreateBlogPost(db, expected[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, expected[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -161,7 +177,7 @@ func Test_DeleteBlogPost(t *testing.T) {
 	}
 
 	for i := range expected {
-		ex, err := DeleteBlogPost(db, expected[i].ID)
+		ex, err := DeleteBlogPost(context.Background(), db, SystemActor, expected[i].ID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -189,10 +205,12 @@ func Test_CreateBlogComment(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	defer fixClock(createdAt)()
 
 	blogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range blogPosts {
-		id, err := CreateBlogPost(db, blogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, blogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -201,12 +219,12 @@ func Test_CreateBlogComment(t *testing.T) {
 
 	expectedComments := []BlogComment{}
 	for i := range blogPosts {
-		expectedComments = append(expectedComments, BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "firstposter", CommentText: "First!"},
-			BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!"})
+		expectedComments = append(expectedComments, BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "firstposter", CommentText: "First!", CreatedAt: createdAt},
+			BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!", CreatedAt: createdAt})
 	}
 
 	for i, comment := range expectedComments {
-		id, err := CreateBlogComment(db, comment)
+		id, err := CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -235,10 +253,12 @@ func Test_GetBlogComment(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	defer fixClock(createdAt)()
 
 	blogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range blogPosts {
-		id, err := CreateBlogPost(db, blogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, blogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -247,12 +267,12 @@ func Test_GetBlogComment(t *testing.T) {
 
 	expectedComments := []BlogComment{}
 	for i := range blogPosts {
-		expectedComments = append(expectedComments, BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "firstposter", CommentText: "First!"},
-			BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!"})
+		expectedComments = append(expectedComments, BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "firstposter", CommentText: "First!", CreatedAt: createdAt},
+			BlogComment{ArticleID: blogPosts[i].ID, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!", CreatedAt: createdAt})
 	}
 
 	for i, comment := range expectedComments {
-		id, err := CreateBlogComment(db, comment)
+		id, err := CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -260,7 +280,7 @@ func Test_GetBlogComment(t *testing.T) {
 	}
 
 	for _, comment := range expectedComments {
-		actualComment, err := GetBlogComment(db, comment.ArticleID, comment.ID)
+		actualComment, err := GetBlogComment(context.Background(), db, comment.ArticleID, comment.ID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -268,6 +288,12 @@ func Test_GetBlogComment(t *testing.T) {
 			t.Errorf("Expected returned comment to be %#v, got %#v", comment, actualComment)
 		}
 	}
+
+	//comments can't be fetched through another post
+	actualComment, err := GetBlogComment(context.Background(), db, blogPosts[1].ID, expectedComments[0].ID)
+	if err != nil || actualComment != nil {
+		t.Errorf("Expected no comment through the wrong post, got %#v, %v", actualComment, err)
+	}
 }
 
 func Test_GetBlogCommentIDs(t *testing.T) {
@@ -278,7 +304,7 @@ func Test_GetBlogCommentIDs(t *testing.T) {
 
 	blogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range blogPosts {
-		id, err := CreateBlogPost(db, blogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, blogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -292,7 +318,7 @@ func Test_GetBlogCommentIDs(t *testing.T) {
 	}
 
 	for i, comment := range expectedComments {
-		id, err := CreateBlogComment(db, comment)
+		id, err := CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -301,7 +327,7 @@ func Test_GetBlogCommentIDs(t *testing.T) {
 
 	for _, post := range blogPosts {
 		articleID := post.ID
-		actualCommentIDs, err := GetCommentIDs(db, articleID)
+		actualCommentIDs, err := GetCommentIDs(context.Background(), db, articleID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -335,7 +361,7 @@ func Test_DeleteBlogComment(t *testing.T) {
 
 	blogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range blogPosts {
-		id, err := CreateBlogPost(db, blogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, blogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -349,7 +375,7 @@ func Test_DeleteBlogComment(t *testing.T) {
 	}
 
 	for i, comment := range expectedComments {
-		id, err := CreateBlogComment(db, comment)
+		id, err := CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -357,7 +383,7 @@ func Test_DeleteBlogComment(t *testing.T) {
 	}
 
 	for _, comment := range expectedComments {
-		exists, err := DeleteBlogComment(db, comment.ArticleID, comment.ID)
+		exists, err := DeleteBlogComment(context.Background(), db, SystemActor, comment.ArticleID, comment.ID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -367,7 +393,7 @@ func Test_DeleteBlogComment(t *testing.T) {
 	}
 
 	for _, comment := range expectedComments {
-		actualComment, err := GetBlogComment(db, comment.ArticleID, comment.ID)
+		actualComment, err := GetBlogComment(context.Background(), db, comment.ArticleID, comment.ID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -385,7 +411,7 @@ func Test_DeleteBlogPost_WithComments(t *testing.T) {
 
 	expectedBlogPosts := []BlogPost{BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"}, BlogPost{Title: "Test Title 2", ArticleText: "Test Body 2", AuthorName: "Test Author Name 2"}}
 	for i := range expectedBlogPosts {
-		id, err := CreateBlogPost(db, expectedBlogPosts[i])
+		id, err := CreateBlogPost(context.Background(), db, SystemActor, expectedBlogPosts[i])
 		if err != nil {
 			t.Error(err)
 		}
@@ -399,7 +425,7 @@ func Test_DeleteBlogPost_WithComments(t *testing.T) {
 	}
 
 	for i, comment := range expectedComments {
-		id, err := CreateBlogComment(db, comment)
+		id, err := CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
 		if err != nil {
 			t.Error(err)
 		}
@@ -407,7 +433,7 @@ func Test_DeleteBlogPost_WithComments(t *testing.T) {
 	}
 
 	for i := range expectedBlogPosts {
-		ex, err := DeleteBlogPost(db, expectedBlogPosts[i].ID)
+		ex, err := DeleteBlogPost(context.Background(), db, SystemActor, expectedBlogPosts[i].ID)
 		if err != nil {
 			t.Error(err)
 		}
@@ -430,9 +456,9 @@ func Test_DeleteBlogPost_WithComments(t *testing.T) {
 	}
 
 	for _, comment := range expectedComments {
-		actualComment, err := GetBlogComment(db, comment.ArticleID, comment.ID)
-		if err == nil {
-			t.Errorf("Expected error when getting comments whose parent blog post have been deleted, %#v", comment)
+		actualComment, err := GetBlogComment(context.Background(), db, comment.ArticleID, comment.ID)
+		if !errors.Is(err, ErrPostNotFound) {
+			t.Errorf("Expected ErrPostNotFound when getting comments whose parent blog post have been deleted, got %v for %#v", err, comment)
 		}
 		if actualComment != nil {
 			t.Errorf("Expected comment to have been deleted, got %#v", *actualComment)
@@ -453,3 +479,207 @@ func Test_DeleteBlogPost_WithComments(t *testing.T) {
 		}
 	}
 }
+
+func Test_SetCommentState(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	exists, err := SetCommentState(context.Background(), db, SystemActor, id, CommentStateLocked, 7)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Errorf("Expected post to have existed, got %v", exists)
+	}
+
+	post, err := GetBlogPost(context.Background(), db, id)
+	if err != nil {
+		t.Error(err)
+	}
+	if post.CommentState != CommentStateLocked || post.CommentsCloseAfterDays != 7 {
+		t.Errorf("Expected comment state to be %s after 7 days, got %s after %d days", CommentStateLocked, post.CommentState, post.CommentsCloseAfterDays)
+	}
+
+	exists, err = SetCommentState(context.Background(), db, SystemActor, "this_id_doesnt_exist", CommentStateOpen, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if exists {
+		t.Errorf("Expected post to not exist, got %v", exists)
+	}
+
+	_, err = SetCommentState(context.Background(), db, SystemActor, id, "ajar", 0)
+	if err == nil {
+		t.Error("Expected invalid comment state to be rejected, got nil")
+	}
+}
+
+func Test_CreateBlogComment_CommentState(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(createdAt)
+	defer restoreClock()
+
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+	if err != nil {
+		t.Error(err)
+	}
+	comment := BlogComment{ArticleID: articleID, AuthorName: "firstposter", CommentText: "Frist!"}
+
+	fixClock(createdAt.Add(48 * time.Hour))
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, comment, 24*time.Hour)
+	if !errors.Is(err, ErrCommentsClosed) {
+		t.Errorf("Expected comments to be closed a day after posting, got %v", err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
+	if err != nil {
+		t.Errorf("Expected comments never to close by default, got %v", err)
+	}
+
+	_, err = SetCommentState(context.Background(), db, SystemActor, articleID, CommentStateLocked, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, comment, 0)
+	if !errors.Is(err, ErrCommentsLocked) {
+		t.Errorf("Expected comments to be locked, got %v", err)
+	}
+}
+
+func Test_CommentsStatus(t *testing.T) {
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	day := 24 * time.Hour
+
+	cases := []struct {
+		post              BlogPost
+		now               time.Time
+		defaultCloseAfter time.Duration
+		expected          string
+	}{
+		{BlogPost{CreatedAt: createdAt}, createdAt.Add(365 * day), 0, CommentStateOpen},
+		{BlogPost{CreatedAt: createdAt, CommentState: CommentStateOpen}, createdAt.Add(day), 7 * day, CommentStateOpen},
+		{BlogPost{CreatedAt: createdAt}, createdAt.Add(8 * day), 7 * day, CommentStateClosed},
+		{BlogPost{CreatedAt: createdAt, CommentsCloseAfterDays: 30}, createdAt.Add(8 * day), 7 * day, CommentStateOpen},
+		{BlogPost{CreatedAt: createdAt, CommentsCloseAfterDays: 2}, createdAt.Add(3 * day), 0, CommentStateClosed},
+		{BlogPost{CreatedAt: createdAt, CommentState: CommentStateLocked}, createdAt, 0, CommentStateLocked},
+	}
+
+	for _, c := range cases {
+		actual := c.post.CommentsStatus(c.now, c.defaultCloseAfter)
+		if actual != c.expected {
+			t.Errorf("Expected comment status of %#v to be %s, got %s", c.post, c.expected, actual)
+		}
+	}
+}
+
+func Test_EditBlogComment(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	createdAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(createdAt)
+	defer restoreClock()
+
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "firstposter", CommentText: "Frist!"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	editTexts := []string{"First!", "First!!"}
+	for i, text := range editTexts {
+		fixClock(createdAt.Add(time.Duration(i+1) * time.Minute))
+		exists, err := EditBlogComment(context.Background(), db, SystemActor, articleID, commentID, text)
+		if err != nil {
+			t.Error(err)
+		}
+		if !exists {
+			t.Errorf("Expected comment to have existed, got %v", exists)
+		}
+	}
+
+	comment, err := GetBlogComment(context.Background(), db, articleID, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+	if comment.CommentText != "First!!" {
+		t.Errorf("Expected comment text to be First!!, got %s", comment.CommentText)
+	}
+	if comment.EditedAt == nil || !comment.EditedAt.Equal(createdAt.Add(2*time.Minute)) {
+		t.Errorf("Expected comment to be marked as edited at %s, got %v", createdAt.Add(2*time.Minute), comment.EditedAt)
+	}
+
+	revisions, err := GetCommentRevisions(context.Background(), db, articleID, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].CommentText != "Frist!" || revisions[1].CommentText != "First!" {
+		t.Errorf("Expected revisions to be Frist! then First!, got %#v", revisions)
+	}
+
+	exists, err := EditBlogComment(context.Background(), db, SystemActor, "wrong_article", commentID, "hijacked")
+	if err != nil {
+		t.Error(err)
+	}
+	if exists {
+		t.Errorf("Expected comment to not be found under another post, got %v", exists)
+	}
+
+	_, err = DeleteBlogComment(context.Background(), db, SystemActor, articleID, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	txn := db.Txn(false)
+	defer txn.Abort()
+	revision, err := txn.First(CommentRevisionsTable, "commentid", commentID)
+	if err != nil {
+		t.Error(err)
+	}
+	if revision != nil {
+		t.Errorf("Expected revisions to be deleted with the comment, got %#v", revision)
+	}
+}
+
+func Test_CountBlogPostsAndComments(t *testing.T) {
+	inMemDB, err := CreateDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		articleID, err := CreateBlogPost(context.Background(), inMemDB, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CreateBlogComment(context.Background(), inMemDB, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Test Author Name 2", CommentText: "Test Comment 1"}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	posts, comments, err := CountBlogPostsAndComments(context.Background(), inMemDB)
+	if err != nil {
+		t.Error(err)
+	}
+	if posts != 2 || comments != 2 {
+		t.Errorf("Expected 2 posts and 2 comments, got %d and %d", posts, comments)
+	}
+}
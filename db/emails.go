@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+//Publishes the comment if it is waiting on its author to verify email, returning whether it was.
+//Fails with ErrCommentNotFound if there is no such comment
+func VerifyCommentEmail(ctx context.Context, inMemDB *DB, actor Actor, commentID, email string) (published bool, err error) {
+	_, span := startSpan(ctx, "VerifyCommentEmail")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(CommentsTable, "id", commentID)
+	if err != nil {
+		return false, err
+	}
+	if foundObj == nil {
+		return false, fmt.Errorf("%w %s", ErrCommentNotFound, commentID)
+	}
+	comment := foundObj.(BlogComment)
+	if comment.PendingEmail == "" || !strings.EqualFold(comment.PendingEmail, email) {
+		return false, nil
+	}
+
+	comment.PendingEmail = ""
+	err = txn.Insert(CommentsTable, comment)
+	if err != nil {
+		return false, err
+	}
+	post, err := getBlogPostWithTxn(txn, comment.ArticleID)
+	if err != nil {
+		return false, err
+	}
+	if post != nil {
+		err = queueMentionNotificationsWithTxn(txn, *post, comment)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = commitAudited(txn, actor, "VerifyCommentEmail")
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func Test_VerifyCommentEmail(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Dr. Eggman", OwnerID: "user:eggman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Sonic", CommentText: "@Dr. Eggman you're too slow", PendingEmail: "sonic@example.com"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := GetCommentIDs(context.Background(), db, articleID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("Expected the pending comment to be left out, got %v", ids)
+	}
+	notifications, err := GetNotifications(context.Background(), db, "user:eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(notifications) != 0 {
+		t.Errorf("Expected no mentions until the comment is published, got %#v", notifications)
+	}
+	//only the email the comment is waiting on publishes it
+	published, err := VerifyCommentEmail(context.Background(), db, SystemActor, commentID, "tails@example.com")
+	if err != nil || published {
+		t.Errorf("Expected another email not to publish the comment, got %t, %v", published, err)
+	}
+
+	published, err = VerifyCommentEmail(context.Background(), db, SystemActor, commentID, "Sonic@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published {
+		t.Errorf("Expected comment %s to be published", commentID)
+	}
+	ids, err = GetCommentIDs(context.Background(), db, articleID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ids) != 1 {
+		t.Errorf("Expected the published comment to be listed, got %v", ids)
+	}
+	notifications, err = GetNotifications(context.Background(), db, "user:eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(notifications) != 1 || notifications[0].CommentID != commentID {
+		t.Errorf("Expected a mention once published, got %#v", notifications)
+	}
+
+	//verifying again is harmless
+	published, err = VerifyCommentEmail(context.Background(), db, SystemActor, commentID, "sonic@example.com")
+	if err != nil || published {
+		t.Errorf("Expected nothing more to publish, got %t, %v", published, err)
+	}
+	_, err = VerifyCommentEmail(context.Background(), db, SystemActor, "nonexistent", "sonic@example.com")
+	if !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("Expected ErrCommentNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package db
+
+import "errors"
+
+//Errors returned, possibly wrapped, so callers can tell what went wrong with errors.Is
+var (
+	//the blog post an operation needs doesn't exist
+	ErrPostNotFound = errors.New("No such blog post")
+	//the comment an operation needs doesn't exist, or isn't on the given post
+	ErrCommentNotFound = errors.New("No such comment")
+	//the change clashes with what is already stored, like a username that is taken
+	ErrConflict = errors.New("Conflict")
+	//the post doesn't take comments because a moderator locked them
+	ErrCommentsLocked = errors.New("Comments are locked")
+	//the post doesn't take comments because it is past its comment age limit
+	ErrCommentsClosed = errors.New("Comments are closed")
+)
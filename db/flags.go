@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+//Reasons for flagging a comment
+const (
+	FlagReasonSpam       = "spam"
+	FlagReasonHarassment = "harassment"
+	FlagReasonSpoilers   = "spoilers"
+)
+
+//CommentFlag is a single reader's report of a comment
+type CommentFlag struct {
+	ID        string `json:"ID"`
+	ArticleID string `json:"ArticleID"`
+	CommentID string `json:"CommentID"`
+	//who flagged it, by login or IP address rather than a name anyone could give
+	ReporterID string    `json:"ReporterID"`
+	Reason     string    `json:"Reason"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+}
+
+//FlaggedComment is a comment along with how many readers flagged it, and why
+type FlaggedComment struct {
+	Comment   BlogComment    `json:"Comment"`
+	FlagCount int            `json:"FlagCount"`
+	Reasons   map[string]int `json:"Reasons"`
+}
+
+//IsValidFlagReason reports whether reason is one of the FlagReason constants
+func IsValidFlagReason(reason string) bool {
+	switch reason {
+	case FlagReasonSpam, FlagReasonHarassment, FlagReasonSpoilers:
+		return true
+	}
+	return false
+}
+
+//Flags a comment on behalf of reporterID. Each reporter only counts once per comment, and only comments readers can see can be flagged.
+//Once hideThreshold distinct flags are reached the comment is hidden, and hideThreshold 0 never hides.
+//exists indicates if err is 404 or something else, hidden is whether the comment is now hidden
+func FlagBlogComment(ctx context.Context, inMemDB *DB, actor Actor, articleID, commentID, reporterID, reason string, hideThreshold int) (exists bool, hidden bool, err error) {
+	_, span := startSpan(ctx, "FlagBlogComment")
+	defer endSpan(span, &err)
+
+	if !IsValidFlagReason(reason) {
+		return true, false, fmt.Errorf("Invalid flag reason %s", reason)
+	}
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	comment, err := getBlogCommentWithTxn(txn, commentID)
+	if err != nil {
+		return false, false, err
+	}
+	if comment == nil || comment.ArticleID != articleID || !comment.Visible() {
+		return false, false, nil
+	}
+
+	existingFlag, err := txn.First(CommentFlagsTable, "commentreporter", commentID, reporterID)
+	if err != nil {
+		return true, comment.Hidden, err
+	}
+	if existingFlag != nil {
+		return true, comment.Hidden, nil
+	}
+
+	flag := CommentFlag{ID: ksuid.New().String(), ArticleID: articleID, CommentID: commentID, ReporterID: reporterID, Reason: reason, CreatedAt: now()}
+	err = txn.Insert(CommentFlagsTable, flag)
+	if err != nil {
+		return true, comment.Hidden, err
+	}
+
+	if !comment.Hidden && hideThreshold > 0 {
+		flagCount := 0
+		it, err := txn.Get(CommentFlagsTable, "commentid", commentID)
+		if err != nil {
+			return true, false, err
+		}
+		for obj := it.Next(); obj != nil; obj = it.Next() {
+			flagCount++
+		}
+
+		if flagCount >= hideThreshold {
+			comment.Hidden = true
+			err = txn.Insert(CommentsTable, *comment)
+			if err != nil {
+				return true, false, err
+			}
+		}
+	}
+
+	err = commitAudited(txn, actor, "FlagBlogComment")
+	if err != nil {
+		return true, false, err
+	}
+	return true, comment.Hidden, nil
+}
+
+//Returns flagged comments, most flagged first. limit 0 returns all of them
+func GetFlaggedComments(ctx context.Context, inMemDB *DB, limit int) (flagged []FlaggedComment, err error) {
+	_, span := startSpan(ctx, "GetFlaggedComments")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(CommentFlagsTable, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	byComment := map[string]*FlaggedComment{}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		flag := obj.(CommentFlag)
+		entry, ok := byComment[flag.CommentID]
+		if !ok {
+			comment, err := getBlogCommentWithTxn(txn, flag.CommentID)
+			if err != nil {
+				return nil, err
+			}
+			if comment == nil {
+				continue
+			}
+			entry = &FlaggedComment{Comment: *comment, Reasons: map[string]int{}}
+			byComment[flag.CommentID] = entry
+		}
+		entry.FlagCount++
+		entry.Reasons[flag.Reason]++
+	}
+
+	for _, entry := range byComment {
+		flagged = append(flagged, *entry)
+	}
+	sort.Slice(flagged, func(i, j int) bool {
+		if flagged[i].FlagCount != flagged[j].FlagCount {
+			return flagged[i].FlagCount > flagged[j].FlagCount
+		}
+		return flagged[i].Comment.ID < flagged[j].Comment.ID
+	})
+
+	if limit > 0 && len(flagged) > limit {
+		flagged = flagged[:limit]
+	}
+	return flagged, nil
+}
+
+//Dismisses all flags on a comment and shows it again. exists indicates if err is 404 or something else
+func ClearCommentFlags(ctx context.Context, inMemDB *DB, actor Actor, articleID, commentID string) (exists bool, err error) {
+	_, span := startSpan(ctx, "ClearCommentFlags")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	comment, err := getBlogCommentWithTxn(txn, commentID)
+	if err != nil {
+		return false, err
+	}
+	if comment == nil || comment.ArticleID != articleID {
+		return false, nil
+	}
+
+	_, err = txn.DeleteAll(CommentFlagsTable, "commentid", commentID)
+	if err != nil {
+		return true, err
+	}
+
+	if comment.Hidden {
+		comment.Hidden = false
+		err = txn.Insert(CommentsTable, *comment)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	err = commitAudited(txn, actor, "ClearCommentFlags")
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
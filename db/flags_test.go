@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_FlagBlogComment(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+	if err != nil {
+		t.Error(err)
+	}
+	spamID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	spoilerID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "spoiler", CommentText: "the walnut was the moon all along"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	flags := []struct {
+		commentID      string
+		reporter       string
+		reason         string
+		expectedHidden bool
+	}{
+		{spamID, "reader1", FlagReasonSpam, false},
+		//the same reader flagging again doesn't count
+		{spamID, "reader1", FlagReasonHarassment, false},
+		{spamID, "reader2", FlagReasonSpam, true},
+		{spoilerID, "reader1", FlagReasonSpoilers, false},
+	}
+	for _, flag := range flags {
+		exists, hidden, err := FlagBlogComment(context.Background(), db, SystemActor, articleID, flag.commentID, flag.reporter, flag.reason, 2)
+		if err != nil {
+			t.Error(err)
+		}
+		if !exists {
+			t.Errorf("Expected comment %s to have existed, got %v", flag.commentID, exists)
+		}
+		if hidden != flag.expectedHidden {
+			t.Errorf("Expected comment %s hidden to be %v after %s flagged it, got %v", flag.commentID, flag.expectedHidden, flag.reporter, hidden)
+		}
+	}
+
+	_, _, err = FlagBlogComment(context.Background(), db, SystemActor, articleID, spamID, "reader3", "too long", 2)
+	if err == nil {
+		t.Error("Expected invalid flag reason to be rejected, got nil")
+	}
+
+	//hidden comments can't be flagged any more
+	exists, _, err := FlagBlogComment(context.Background(), db, SystemActor, articleID, spamID, "reader3", FlagReasonSpam, 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if exists {
+		t.Error("Expected the hidden comment not to be found for flagging")
+	}
+
+	ids, err := GetCommentIDs(context.Background(), db, articleID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ids) != 1 || ids[0] != spoilerID {
+		t.Errorf("Expected only the spoiler comment to be listed, got %#v", ids)
+	}
+
+	flagged, err := GetFlaggedComments(context.Background(), db, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(flagged) != 2 {
+		t.Fatalf("Expected 2 flagged comments, got %d", len(flagged))
+	}
+	if flagged[0].Comment.ID != spamID || flagged[0].FlagCount != 2 || flagged[0].Reasons[FlagReasonSpam] != 2 || !flagged[0].Comment.Hidden {
+		t.Errorf("Expected the hidden spam comment to be the most flagged, got %#v", flagged[0])
+	}
+
+	flagged, err = GetFlaggedComments(context.Background(), db, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(flagged) != 1 {
+		t.Errorf("Expected limit to cap the flagged comments at 1, got %d", len(flagged))
+	}
+
+	exists, err = ClearCommentFlags(context.Background(), db, SystemActor, articleID, spamID)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Errorf("Expected comment to have existed, got %v", exists)
+	}
+
+	comment, err := GetBlogComment(context.Background(), db, articleID, spamID)
+	if err != nil {
+		t.Error(err)
+	}
+	if comment.Hidden {
+		t.Error("Expected comment to be shown again after clearing its flags")
+	}
+
+	flagged, err = GetFlaggedComments(context.Background(), db, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(flagged) != 1 || flagged[0].Comment.ID != spoilerID {
+		t.Errorf("Expected only the spoiler comment to still be flagged, got %#v", flagged)
+	}
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/segmentio/ksuid"
+)
+
+//Kinds of Notification
+const (
+	NotificationKindMention = "mention"
+)
+
+//Notification is an outbox record telling Recipient that something happened. It stays in the outbox until delivered
+type Notification struct {
+	ID string `json:"ID"`
+	//who the notification is for, as the OwnerID of their posts and comments. Recipient is only the name they were mentioned by
+	RecipientID string    `json:"RecipientID"`
+	Recipient   string    `json:"Recipient"`
+	Kind        string    `json:"Kind"`
+	ArticleID   string    `json:"ArticleID"`
+	CommentID   string    `json:"CommentID"`
+	ActorName   string    `json:"ActorName"`
+	CreatedAt   time.Time `json:"CreatedAt"`
+	Delivered   bool      `json:"Delivered"`
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+//Finds which of the candidate names are @mentioned in text. Names may contain spaces, so the longest matching candidate wins
+func findMentions(text string, candidates []string) (mentioned []string) {
+	sorted := append([]string(nil), candidates...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	seen := map[string]bool{}
+	for i := strings.IndexByte(text, '@'); i >= 0; {
+		//ignore things like email addresses
+		prev, _ := utf8.DecodeLastRuneInString(text[:i])
+		rest := text[i+1:]
+		if i == 0 || !isNameRune(prev) {
+			for _, name := range sorted {
+				if name == "" || len(rest) < len(name) || !strings.EqualFold(rest[:len(name)], name) {
+					continue
+				}
+				next, _ := utf8.DecodeRuneInString(rest[len(name):])
+				if len(rest) > len(name) && isNameRune(next) {
+					continue
+				}
+				if !seen[name] {
+					seen[name] = true
+					mentioned = append(mentioned, name)
+				}
+				break
+			}
+		}
+
+		next := strings.IndexByte(rest, '@')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+
+	return mentioned
+}
+
+//parent should already grab a transaction handler already
+//Only the post author and people with visible comments on the post can be mentioned.
+//Anonymous posters have no OwnerID to read notifications under, so they aren't notified
+func queueMentionNotificationsWithTxn(txn *timedTxn, post BlogPost, comment BlogComment) error {
+	if !strings.Contains(comment.CommentText, "@") {
+		return nil
+	}
+
+	//the owners that went by each name
+	owners := map[string][]string{}
+	addCandidate := func(name, ownerID string) {
+		if ownerID == "" {
+			return
+		}
+		for _, id := range owners[name] {
+			if id == ownerID {
+				return
+			}
+		}
+		owners[name] = append(owners[name], ownerID)
+	}
+	addCandidate(post.AuthorName, post.OwnerID)
+	it, err := txn.Get(CommentsTable, "articleid", post.ID)
+	if err != nil {
+		return err
+	}
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		if other := obj.(BlogComment); other.Visible() {
+			addCandidate(other.AuthorName, other.OwnerID)
+		}
+	}
+	candidates := make([]string, 0, len(owners))
+	for name := range owners {
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+
+	for _, recipient := range findMentions(comment.CommentText, candidates) {
+		for _, recipientID := range owners[recipient] {
+			if recipientID == comment.OwnerID {
+				continue
+			}
+			notification := Notification{
+				ID:          ksuid.New().String(),
+				RecipientID: recipientID,
+				Recipient:   recipient,
+				Kind:        NotificationKindMention,
+				ArticleID:   comment.ArticleID,
+				CommentID:   comment.ID,
+				ActorName:   comment.AuthorName,
+				CreatedAt:   comment.CreatedAt,
+			}
+			err = txn.Insert(NotificationsTable, notification)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func sortNotifications(notifications []Notification) {
+	sort.SliceStable(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+}
+
+//Returns all notifications for recipientID, oldest first
+func GetNotifications(ctx context.Context, inMemDB *DB, recipientID string) (notifications []Notification, err error) {
+	_, span := startSpan(ctx, "GetNotifications")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(NotificationsTable, "recipient", recipientID)
+	if err != nil {
+		return nil, err
+	}
+
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		notifications = append(notifications, obj.(Notification))
+	}
+	sortNotifications(notifications)
+
+	return notifications, nil
+}
+
+//Returns the notifications still waiting in the outbox, oldest first
+func GetUndeliveredNotifications(ctx context.Context, inMemDB *DB) (notifications []Notification, err error) {
+	_, span := startSpan(ctx, "GetUndeliveredNotifications")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	it, err := txn.Get(NotificationsTable, "delivered", false)
+	if err != nil {
+		return nil, err
+	}
+
+	for obj := it.Next(); obj != nil; obj = it.Next() {
+		notifications = append(notifications, obj.(Notification))
+	}
+	sortNotifications(notifications)
+
+	return notifications, nil
+}
+
+//Takes a notification out of the outbox. exists indicates if err is 404 or something else.
+//The outbox isn't content anyone changed, so this isn't audited
+func MarkNotificationDelivered(ctx context.Context, inMemDB *DB, notificationID string) (exists bool, err error) {
+	_, span := startSpan(ctx, "MarkNotificationDelivered")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, true)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(NotificationsTable, "id", notificationID)
+	if err != nil {
+		return false, err
+	}
+	if foundObj == nil {
+		return false, nil
+	}
+
+	notification := foundObj.(Notification)
+	notification.Delivered = true
+	err = txn.Insert(NotificationsTable, notification)
+	if err != nil {
+		return true, err
+	}
+
+	txn.Commit()
+	return true, nil
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_FindMentions(t *testing.T) {
+	candidates := []string{"Dr. Eggman", "Dr", "Anony Mouse", "Sonic"}
+
+	cases := []struct {
+		text     string
+		expected []string
+	}{
+		{"no mentions here", nil},
+		{"@Sonic gotta go fast", []string{"Sonic"}},
+		{"hey @dr. eggman, @Anony Mouse is right", []string{"Dr. Eggman", "Anony Mouse"}},
+		{"@Dr what do you think", []string{"Dr"}},
+		{"@Sonic @Sonic @Sonic", []string{"Sonic"}},
+		{"@Sonics aren't real", nil},
+		{"email sonic@Sonic.com", nil},
+		{"@Knuckles isn't here", nil},
+	}
+
+	for _, c := range cases {
+		actual := findMentions(c.text, candidates)
+		if !reflect.DeepEqual(c.expected, actual) {
+			t.Errorf("Expected mentions in %q to be %#v, got %#v", c.text, c.expected, actual)
+		}
+	}
+}
+
+func Test_CreateBlogComment_Mentions(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	articleID, err := CreateBlogPost(context.Background(), db, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Dr. Eggman", OwnerID: "user:eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Anony Mouse", CommentText: "this review sucks", OwnerID: "user:anony"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	//neither a hidden comment, one still waiting on its email, nor one posted anonymously makes its author mentionable
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Knuckles", CommentText: "spam", OwnerID: "user:knuckles", Hidden: true}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Tails", CommentText: "me too", OwnerID: "user:tails", PendingEmail: "tails@example.com"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Amy", CommentText: "first"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := CreateBlogComment(context.Background(), db, SystemActor, BlogComment{ArticleID: articleID, AuthorName: "Sonic", CommentText: "@Dr. Eggman @Anony Mouse @Sonic @Knuckles @Tails @Amy agreed", OwnerID: "user:sonic"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for recipientID, recipient := range map[string]string{"user:eggman": "Dr. Eggman", "user:anony": "Anony Mouse"} {
+		notifications, err := GetNotifications(context.Background(), db, recipientID)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(notifications) != 1 {
+			t.Fatalf("Expected 1 notification for %s, got %d", recipient, len(notifications))
+		}
+		n := notifications[0]
+		if n.Kind != NotificationKindMention || n.ArticleID != articleID || n.CommentID != commentID || n.ActorName != "Sonic" || n.Recipient != recipient || n.Delivered {
+			t.Errorf("Expected an undelivered mention of %s by Sonic on comment %s, got %#v", recipient, commentID, n)
+		}
+	}
+
+	//a name isn't an identity, so nothing is kept under it
+	byName, err := GetNotifications(context.Background(), db, "Dr. Eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(byName) != 0 {
+		t.Errorf("Expected no notifications under a display name, got %#v", byName)
+	}
+
+	for _, recipientID := range []string{"user:sonic", "user:knuckles", "user:tails", ""} {
+		notifications, err := GetNotifications(context.Background(), db, recipientID)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(notifications) != 0 {
+			t.Errorf("Expected no notifications for %q, got %#v", recipientID, notifications)
+		}
+	}
+
+	pending, err := GetUndeliveredNotifications(context.Background(), db)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 notifications in the outbox, got %d", len(pending))
+	}
+
+	exists, err := MarkNotificationDelivered(context.Background(), db, pending[0].ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Errorf("Expected notification to have existed, got %v", exists)
+	}
+
+	pending, err = GetUndeliveredNotifications(context.Background(), db)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(pending) != 1 {
+		t.Errorf("Expected 1 notification left in the outbox, got %d", len(pending))
+	}
+}
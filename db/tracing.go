@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//the instrumentation name db spans are recorded under
+const tracerName = "github.com/aschereT/ea-gaming-review/db"
+
+//startSpan traces a db call named name, as a child of the span in ctx. The returned context is for db calls nested in this one.
+//Spans go to the provider of the span they're in, so each server's spans are exported with its requests', and to the global provider otherwise
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	tracer := otel.Tracer(tracerName)
+	if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+		tracer = parent.TracerProvider().Tracer(tracerName)
+	}
+	return tracer.Start(ctx, "db."+name)
+}
+
+//endSpan ends span, marking it failed if *err is set by the time the db call returns
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func Test_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	_, _, err = CreateAPIKey(context.Background(), db, SystemActor, "review importer", []string{ScopeRead}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = CreateUser(context.Background(), db, SystemActor, "eggman", "Dr. Eggman", "walnut moon")
+	}
+	if err == nil {
+		t.Error("Expected the taken username to be rejected")
+	}
+
+	//the last span of each name, which for CreateUser is the failed one
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	create, register, createUser := spans["db.CreateAPIKey"], spans["db.RegisterAPIKey"], spans["db.CreateUser"]
+	if create == nil || register == nil || createUser == nil {
+		t.Fatalf("Expected spans for every db call, got %v", spans)
+	}
+	//db calls made from another one are its children
+	if register.Parent().SpanID() != create.SpanContext().SpanID() {
+		t.Errorf("Expected RegisterAPIKey to be a child of CreateAPIKey, got parent %s", register.Parent().SpanID())
+	}
+	if create.Status().Code != codes.Unset {
+		t.Errorf("Expected CreateAPIKey to succeed, got %#v", create.Status())
+	}
+	if createUser.Status().Code != codes.Error || len(createUser.Events()) != 1 {
+		t.Errorf("Expected the CreateUser span to record its error, got %#v", createUser.Status())
+	}
+}
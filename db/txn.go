@@ -0,0 +1,45 @@
+package db
+
+import (
+	"time"
+
+	"github.com/hashicorp/go-memdb"
+)
+
+//TxnObserver is told about every transaction once it ends: whether it could write, whether it was committed and how long it was open
+type TxnObserver func(write, committed bool, took time.Duration)
+
+//timedTxn is a memdb transaction that reports to its store's TxnObserver when it ends
+type timedTxn struct {
+	*memdb.Txn
+	//the store the transaction is on
+	db    *DB
+	write bool
+	start time.Time
+	ended bool
+}
+
+func beginTxn(inMemDB *DB, write bool) *timedTxn {
+	return &timedTxn{Txn: inMemDB.Txn(write), db: inMemDB, write: write, start: time.Now()}
+}
+
+func (t *timedTxn) Commit() {
+	t.Txn.Commit()
+	t.end(t.write)
+}
+
+//Abort is safe to defer even after Commit, only the first of them is reported
+func (t *timedTxn) Abort() {
+	t.Txn.Abort()
+	t.end(false)
+}
+
+func (t *timedTxn) end(committed bool) {
+	if t.ended {
+		return
+	}
+	t.ended = true
+	if t.db.TxnObserver != nil {
+		t.db.TxnObserver(t.write, committed, time.Since(t.start))
+	}
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_TxnObserver(t *testing.T) {
+	inMemDB, err := CreateDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type observation struct {
+		write, committed bool
+	}
+	var observed []observation
+	inMemDB.TxnObserver = func(write, committed bool, took time.Duration) {
+		if took < 0 {
+			t.Errorf("Expected a transaction to take some time, got %s", took)
+		}
+		observed = append(observed, observation{write, committed})
+	}
+
+	articleID, err := CreateBlogPost(context.Background(), inMemDB, SystemActor, BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Test Author Name 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = GetBlogPost(context.Background(), inMemDB, articleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nothing to delete, so this one is aborted
+	_, err = DeleteBlogComment(context.Background(), inMemDB, SystemActor, articleID, "nonexistent")
+	if err == nil {
+		t.Fatal("Expected deleting a nonexistent comment to fail")
+	}
+
+	expected := []observation{{true, true}, {false, false}, {true, false}}
+	if len(observed) != len(expected) {
+		t.Fatalf("Expected transactions %v, got %v", expected, observed)
+	}
+	for i := range expected {
+		if observed[i] != expected[i] {
+			t.Errorf("Expected transactions %v, got %v", expected, observed)
+			break
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//Roles a User can have
+const (
+	//can do everything, including managing users and API keys
+	RoleAdmin = "admin"
+	//can edit, delete and moderate anyone's posts and comments
+	RoleEditor = "editor"
+	//can post, and edit, delete and moderate comments on their own posts
+	RoleAuthor = "author"
+	//can only comment
+	RoleCommenter = "commenter"
+)
+
+//DefaultRole is the role newly registered users get
+const DefaultRole = RoleAuthor
+
+//User is a registered account. DisplayName is what gets stamped onto their posts and comments
+type User struct {
+	ID           string    `json:"ID"`
+	Username     string    `json:"Username"`
+	DisplayName  string    `json:"DisplayName"`
+	Role         string    `json:"Role"`
+	PasswordHash []byte    `json:"-"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+//Checks if role is valid
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleEditor, RoleAuthor, RoleCommenter:
+		return true
+	}
+	return false
+}
+
+//Session is a logged in User. ID is a hash of the session token, the token itself is only known to the client
+type Session struct {
+	ID        string    `json:"ID"`
+	UserID    string    `json:"UserID"`
+	CreatedAt time.Time `json:"CreatedAt"`
+	ExpiresAt time.Time `json:"ExpiresAt"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+//parent should already grab a transaction handler already
+func getUserWithTxn(txn *timedTxn, index, value string) (user *User, err error) {
+	foundObj, err := txn.First(UsersTable, index, value)
+	if err != nil {
+		return nil, err
+	}
+	if foundObj == nil {
+		return nil, nil
+	}
+
+	foundUser := foundObj.(User)
+	return &foundUser, nil
+}
+
+//Registers a new user, hashing their password. err wraps ErrConflict if the username or display name is already in use
+func CreateUser(ctx context.Context, inMemDB *DB, actor Actor, username, displayName, password string) (id string, err error) {
+	_, span := startSpan(ctx, "CreateUser")
+	defer endSpan(span, &err)
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	for index, value := range map[string]string{"username": username, "displayname": displayName} {
+		existing, err := getUserWithTxn(txn, index, value)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			return "", fmt.Errorf("%w, %s %s is already taken", ErrConflict, index, value)
+		}
+	}
+
+	id = ksuid.New().String()
+	err = txn.Insert(UsersTable, User{ID: id, Username: username, DisplayName: displayName, Role: DefaultRole, PasswordHash: passwordHash, CreatedAt: now()})
+	if err != nil {
+		return "", err
+	}
+
+	err = commitAudited(txn, actor, "CreateUser")
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+//Gets a user by ID. user is nil if not found
+func GetUser(ctx context.Context, inMemDB *DB, userID string) (user *User, err error) {
+	_, span := startSpan(ctx, "GetUser")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	return getUserWithTxn(txn, "id", userID)
+}
+
+//Gets a user by display name. user is nil if nobody has registered that name
+func GetUserByDisplayName(ctx context.Context, inMemDB *DB, displayName string) (user *User, err error) {
+	_, span := startSpan(ctx, "GetUserByDisplayName")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	return getUserWithTxn(txn, "displayname", displayName)
+}
+
+//Changes the role of the user with username. exists indicates if err is 404 or something else
+func SetUserRole(ctx context.Context, inMemDB *DB, actor Actor, username, role string) (exists bool, err error) {
+	_, span := startSpan(ctx, "SetUserRole")
+	defer endSpan(span, &err)
+
+	txn := beginAudited(inMemDB)
+	defer txn.Abort()
+
+	user, err := getUserWithTxn(txn, "username", username)
+	if err != nil {
+		return false, err
+	}
+	if user == nil {
+		return false, nil
+	}
+
+	user.Role = role
+	err = txn.Insert(UsersTable, *user)
+	if err != nil {
+		return true, err
+	}
+
+	err = commitAudited(txn, actor, "SetUserRole")
+	if err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+//Checks a username and password. user is nil if either is wrong
+func AuthenticateUser(ctx context.Context, inMemDB *DB, username, password string) (user *User, err error) {
+	_, span := startSpan(ctx, "AuthenticateUser")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	user, err = getUserWithTxn(txn, "username", username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+//Starts a session for userID lasting ttl, returning the token the client should present.
+//Sessions come and go with every login, so they aren't audited
+func CreateSession(ctx context.Context, inMemDB *DB, userID string, ttl time.Duration) (token string, err error) {
+	_, span := startSpan(ctx, "CreateSession")
+	defer endSpan(span, &err)
+
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	txn := beginTxn(inMemDB, true)
+	defer txn.Abort()
+
+	createdAt := now()
+	err = txn.Insert(SessionsTable, Session{ID: hashToken(token), UserID: userID, CreatedAt: createdAt, ExpiresAt: createdAt.Add(ttl)})
+	if err != nil {
+		return "", err
+	}
+
+	txn.Commit()
+	return token, nil
+}
+
+//Gets the user a session token belongs to. user is nil if the session doesn't exist or has expired
+func GetSessionUser(ctx context.Context, inMemDB *DB, token string) (user *User, err error) {
+	_, span := startSpan(ctx, "GetSessionUser")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, false)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(SessionsTable, "id", hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if foundObj == nil {
+		return nil, nil
+	}
+
+	session := foundObj.(Session)
+	if now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	return getUserWithTxn(txn, "id", session.UserID)
+}
+
+//Ends a session. exists indicates if err is 404 or something else
+func DeleteSession(ctx context.Context, inMemDB *DB, token string) (exists bool, err error) {
+	_, span := startSpan(ctx, "DeleteSession")
+	defer endSpan(span, &err)
+
+	txn := beginTxn(inMemDB, true)
+	defer txn.Abort()
+
+	foundObj, err := txn.First(SessionsTable, "id", hashToken(token))
+	if err != nil {
+		return false, err
+	}
+	if foundObj == nil {
+		return false, nil
+	}
+
+	err = txn.Delete(SessionsTable, foundObj)
+	if err != nil {
+		return true, err
+	}
+
+	txn.Commit()
+	return true, nil
+}
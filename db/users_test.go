@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_Users(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, err := CreateUser(context.Background(), db, SystemActor, "eggman", "Dr. Eggman", "walnut moon base")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, names := range [][]string{{"EGGMAN", "Eggman 2"}, {"robotnik", "Dr. Eggman"}} {
+		_, err = CreateUser(context.Background(), db, SystemActor, names[0], names[1], "walnut moon base")
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected %s/%s to clash with the existing user, got %v", names[0], names[1], err)
+		}
+	}
+
+	user, err := AuthenticateUser(context.Background(), db, "eggman", "hedgehog")
+	if err != nil {
+		t.Error(err)
+	}
+	if user != nil {
+		t.Errorf("Expected wrong password to be rejected, got %#v", *user)
+	}
+
+	user, err = AuthenticateUser(context.Background(), db, "Eggman", "walnut moon base")
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.ID != id {
+		t.Fatalf("Expected to authenticate as %s, got %#v", id, user)
+	}
+	if string(user.PasswordHash) == "walnut moon base" {
+		t.Error("Expected password to be stored hashed")
+	}
+
+	user, err = GetUserByDisplayName(context.Background(), db, "Dr. Eggman")
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.ID != id {
+		t.Fatalf("Expected to find user %s by display name, got %#v", id, user)
+	}
+	if user.Role != DefaultRole {
+		t.Errorf("Expected new users to have role %s, got %s", DefaultRole, user.Role)
+	}
+
+	exists, err := SetUserRole(context.Background(), db, SystemActor, "EGGMAN", RoleEditor)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Error("Expected user to exist")
+	}
+	user, err = GetUser(context.Background(), db, id)
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.Role != RoleEditor {
+		t.Errorf("Expected user to now be an editor, got %#v", user)
+	}
+
+	exists, err = SetUserRole(context.Background(), db, SystemActor, "robotnik", RoleAdmin)
+	if err != nil {
+		t.Error(err)
+	}
+	if exists {
+		t.Error("Expected unknown user to not exist")
+	}
+}
+
+func Test_Sessions(t *testing.T) {
+	db, err := CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+	loggedInAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	restoreClock := fixClock(loggedInAt)
+	defer restoreClock()
+
+	id, err := CreateUser(context.Background(), db, SystemActor, "eggman", "Dr. Eggman", "walnut moon base")
+	if err != nil {
+		t.Error(err)
+	}
+
+	token, err := CreateSession(context.Background(), db, id, time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+
+	txn := db.Txn(false)
+	stored, err := txn.First(SessionsTable, "id", token)
+	txn.Abort()
+	if err != nil {
+		t.Error(err)
+	}
+	if stored != nil {
+		t.Error("Expected session tokens to not be stored as is")
+	}
+
+	user, err := GetSessionUser(context.Background(), db, token)
+	if err != nil {
+		t.Error(err)
+	}
+	if user == nil || user.ID != id {
+		t.Errorf("Expected session to belong to %s, got %#v", id, user)
+	}
+
+	fixClock(loggedInAt.Add(2 * time.Hour))
+	user, err = GetSessionUser(context.Background(), db, token)
+	if err != nil {
+		t.Error(err)
+	}
+	if user != nil {
+		t.Errorf("Expected session to have expired, got %#v", *user)
+	}
+
+	exists, err := DeleteSession(context.Background(), db, token)
+	if err != nil {
+		t.Error(err)
+	}
+	if !exists {
+		t.Errorf("Expected session to have existed, got %v", exists)
+	}
+}
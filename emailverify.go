@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/logging"
+	"github.com/aschereT/ea-gaming-review/mailer"
+)
+
+//remembers which email the browser verified, so later comments from it with that email aren't held
+const verifiedEmailCookieName = "verified_email"
+
+type VerifyEmailResponse struct {
+	Email string `json:"Email"`
+	//ID of the comment the link was for if it was waiting on this email and is now visible, otherwise empty
+	Published []string `json:"Published"`
+}
+
+func newMailer(cfg config.Mail) (mailer.Mailer, error) {
+	switch cfg.Mailer {
+	case config.MailerLog:
+		return mailer.LogMailer{Logger: logger}, nil
+	case config.MailerFile:
+		return &mailer.FileMailer{Path: cfg.File}, nil
+	case config.MailerSMTP:
+		host := strings.Split(cfg.SMTPAddr, ":")[0]
+		var auth smtp.Auth
+		if cfg.SMTPUsername != "" {
+			auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, host)
+		}
+		return mailer.SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.From, Auth: auth}, nil
+	default:
+		return nil, fmt.Errorf("Unknown mailer %s", cfg.Mailer)
+	}
+}
+
+//newEmailTokenSecret is secret to sign tokens with, or a random secret if it's empty
+func newEmailTokenSecret(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	random := make([]byte, 32)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	return random, nil
+}
+
+//checks that email is a bare address, without a display name
+func isEmailAddress(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+func emailTokenSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//signEmailToken makes a token signed with secret proving its holder received mail at email, until expires.
+//Tokens in verification links are for the comment they publish, tokens in the verified email cookie have no commentID
+func signEmailToken(secret []byte, email, commentID string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + base64.RawURLEncoding.EncodeToString([]byte(commentID)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + emailTokenSignature(secret, payload)
+}
+
+//verifyEmailToken checks a token from signEmailToken, returning the email and comment it was for
+func verifyEmailToken(secret []byte, token string, now time.Time) (email, commentID string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return "", "", fmt.Errorf("Invalid verification token")
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(emailTokenSignature(secret, payload))) {
+		return "", "", fmt.Errorf("Invalid verification token")
+	}
+
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid verification token")
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return "", "", fmt.Errorf("Verification token has expired, comment again to get a new one")
+	}
+	rawEmail, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid verification token")
+	}
+	rawCommentID, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid verification token")
+	}
+	return string(rawEmail), string(rawCommentID), nil
+}
+
+//sendVerificationEmail mails email a link that publishes comment commentID
+func (s *Server) sendVerificationEmail(email, commentID string) error {
+	ttl := s.Config.EmailVerification.TokenTTL.Duration
+	token := signEmailToken(s.emailTokenSecret, email, commentID, time.Now().Add(ttl))
+	link := strings.TrimSuffix(s.Config.PublicURL, "/") + "/v1/auth/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email to publish your comment",
+		Body:    fmt.Sprintf("Open this link within %s to publish your comment:\n\n%s\n\nIf you didn't comment, you can ignore this email.", ttl, link),
+	})
+}
+
+//verifiedEmail is the email req's browser proved it receives mail at by opening a verification link, or empty if it hasn't
+func (s *Server) verifiedEmail(req *http.Request) string {
+	cookie, err := req.Cookie(verifiedEmailCookieName)
+	if err != nil {
+		return ""
+	}
+	email, commentID, err := verifyEmailToken(s.emailTokenSecret, cookie.Value, time.Now())
+	if err != nil || commentID != "" {
+		return ""
+	}
+	return email
+}
+
+func (s *Server) verifyEmailHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "verifyEmailHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	email, commentID, err := verifyEmailToken(s.emailTokenSecret, req.URL.Query().Get("token"), time.Now())
+	if err == nil && commentID == "" {
+		err = fmt.Errorf("Invalid verification token")
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	published, err := db.VerifyCommentEmail(req.Context(), s.DB, auditActor(req), commentID, email)
+	if errors.Is(err, db.ErrCommentNotFound) {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error verifying email"))
+		return
+	}
+	publishedIDs := []string{}
+	if published {
+		publishedIDs = append(publishedIDs, commentID)
+	}
+
+	//later comments from this browser with the same email go up straight away
+	http.SetCookie(w, &http.Cookie{
+		Name:     verifiedEmailCookieName,
+		Value:    signEmailToken(s.emailTokenSecret, email, "", time.Now().Add(s.Config.SessionTTL.Duration)),
+		Path:     "/",
+		Expires:  time.Now().Add(s.Config.SessionTTL.Duration),
+		HttpOnly: true,
+		Secure:   s.Config.Features.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	logAt(req.Context(), config.LogLevelInfo, funcname, "Verified email", logging.Fields{"email": email, "comment_id": commentID, "published": published})
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: VerifyEmailResponse{Email: email, Published: publishedIDs}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
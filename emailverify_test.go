@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/mailer"
+	"github.com/gorilla/mux"
+)
+
+//keeps sent mail in memory
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+type expectedResponseCreateComment struct {
+	Data  CreateBlogPostOrCommentResponse
+	Error string
+}
+
+type expectedResponseVerifyEmail struct {
+	Data  VerifyEmailResponse
+	Error string
+}
+
+func Test_EmailToken(t *testing.T) {
+	secret, err := newEmailTokenSecret("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	token := signEmailToken(secret, "sonic@example.com", "comment-1", issuedAt.Add(time.Hour))
+
+	email, commentID, err := verifyEmailToken(secret, token, issuedAt)
+	if err != nil || email != "sonic@example.com" || commentID != "comment-1" {
+		t.Errorf("Expected the token to be for sonic@example.com on comment-1, got %q, %q, %v", email, commentID, err)
+	}
+	_, _, err = verifyEmailToken(secret, token, issuedAt.Add(2*time.Hour))
+	if err == nil {
+		t.Errorf("Expected an expired token to be rejected")
+	}
+
+	forged := signEmailToken(secret, "tails@example.com", "comment-2", issuedAt.Add(time.Hour))
+	parts := strings.Split(token, ".")
+	forgedParts := strings.Split(forged, ".")
+	_, _, err = verifyEmailToken(secret, forgedParts[0]+"."+parts[1]+"."+parts[2]+"."+parts[3], issuedAt)
+	if err == nil {
+		t.Errorf("Expected a token with a swapped email to be rejected")
+	}
+	_, _, err = verifyEmailToken(secret, parts[0]+"."+forgedParts[1]+"."+parts[2]+"."+parts[3], issuedAt)
+	if err == nil {
+		t.Errorf("Expected a token with a swapped comment to be rejected")
+	}
+
+	otherSecret, err := newEmailTokenSecret("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = verifyEmailToken(otherSecret, token, issuedAt)
+	if err == nil {
+		t.Errorf("Expected a token signed with another secret to be rejected")
+	}
+}
+
+func Test_EmailVerification(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cfg := testConfig()
+	cfg.Features.RequireEmailVerification = true
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := &recordingMailer{}
+	server.mailer = mail
+	//the handlers use the server's store once it is serving them
+	inMemDB = server.DB
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/blog/{id}/comment", createBlogCommentHandler).Methods(http.MethodPost)
+	r.HandleFunc("/blog/{id}/comment", getBlogCommentsIDsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/v1/auth/verify-email", server.verifyEmailHandler).Methods(http.MethodGet)
+	handler := servedBy(server, r)
+
+	comment := func(body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog/"+id+"/comment", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	commentCount := func() int {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/blog/"+id+"/comment", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		handler.ServeHTTP(rec, req)
+		var actualResponse expectedResponseIDs
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		return len(actualResponse.Data.IDs)
+	}
+
+	rec := comment("{\"AuthorName\":\"Sonic\",\"CommentText\":\"you're too slow\"}")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without an email, got %d", http.StatusBadRequest, rec.Code)
+	}
+	rec = comment("{\"AuthorName\":\"Sonic\",\"CommentText\":\"you're too slow\",\"Email\":\"Sonic <sonic@example.com>\"}")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for an invalid email, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = comment("{\"AuthorName\":\"Sonic\",\"CommentText\":\"you're too slow\",\"Email\":\"Sonic@Example.com\"}")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status code %d for an unverified email, got %d", http.StatusAccepted, rec.Code)
+	}
+	var createResponse expectedResponseCreateComment
+	err = json.Unmarshal(rec.Body.Bytes(), &createResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if !createResponse.Data.Pending {
+		t.Errorf("Expected the comment to be pending")
+	}
+	if count := commentCount(); count != 0 {
+		t.Errorf("Expected the pending comment to be hidden, got %d comments", count)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].To != "sonic@example.com" {
+		t.Fatalf("Expected a verification email to sonic@example.com, got %#v", mail.sent)
+	}
+
+	link := mail.sent[0].Body[strings.Index(mail.sent[0].Body, "http"):]
+	link = strings.Fields(link)[0]
+	verifyURL, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, restore := captureLogs()
+	defer restore()
+	rec = httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, verifyURL.RequestURI(), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d verifying, got %d", http.StatusOK, rec.Code)
+	}
+	if strings.Contains(logs.String(), "sonic@example.com") {
+		t.Errorf("Expected the email to be redacted from the logs, got %s", logs.String())
+	}
+	var verifyResponse expectedResponseVerifyEmail
+	err = json.Unmarshal(rec.Body.Bytes(), &verifyResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(verifyResponse.Data.Published) != 1 || verifyResponse.Data.Published[0] != createResponse.Data.ID {
+		t.Errorf("Expected comment %s to be published, got %#v", createResponse.Data.ID, verifyResponse.Data)
+	}
+	if count := commentCount(); count != 1 {
+		t.Errorf("Expected the verified comment to show, got %d comments", count)
+	}
+
+	var verifiedCookie *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == verifiedEmailCookieName {
+			verifiedCookie = cookie
+		}
+	}
+	if verifiedCookie == nil || !verifiedCookie.HttpOnly {
+		t.Fatalf("Expected an HttpOnly %s cookie, got %v", verifiedEmailCookieName, rec.Result().Cookies())
+	}
+
+	//knowing a verified email isn't enough, it has to be verified from the same browser
+	rec = comment("{\"AuthorName\":\"Sonic\",\"CommentText\":\"gotta go fast\",\"Email\":\"sonic@example.com\"}")
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status code %d for someone else using a verified email, got %d", http.StatusAccepted, rec.Code)
+	}
+	rec = comment("{\"AuthorName\":\"Tails\",\"CommentText\":\"wait for me\",\"Email\":\"tails@example.com\"}", verifiedCookie)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("Expected status code %d for an email the browser didn't verify, got %d", http.StatusAccepted, rec.Code)
+	}
+	if count := commentCount(); count != 1 || len(mail.sent) != 3 {
+		t.Errorf("Expected 1 comment and 3 mails, got %d comments and %d mails", count, len(mail.sent))
+	}
+
+	//once verified, comments from the same browser show up straight away
+	rec = comment("{\"AuthorName\":\"Sonic\",\"CommentText\":\"gotta go fast\",\"Email\":\"sonic@example.com\"}", verifiedCookie)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for a verified email, got %d", http.StatusOK, rec.Code)
+	}
+	if count := commentCount(); count != 2 || len(mail.sent) != 3 {
+		t.Errorf("Expected 2 comments and no more mail, got %d comments and %d mails", count, len(mail.sent))
+	}
+
+	//a link only publishes the comment it was sent for, and the cookie isn't a link
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/v1/auth/verify-email?token="+url.QueryEscape(verifiedCookie.Value), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d verifying with the cookie, got %d", http.StatusBadRequest, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, verifyURL.RequestURI(), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	handler.ServeHTTP(rec, req)
+	verifyResponse = expectedResponseVerifyEmail{}
+	err = json.Unmarshal(rec.Body.Bytes(), &verifyResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if rec.Code != http.StatusOK || len(verifyResponse.Data.Published) != 0 || commentCount() != 2 {
+		t.Errorf("Expected reopening the link to publish nothing more, got %d, %#v", rec.Code, verifyResponse.Data)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aschereT/ea-gaming-review/db"
+)
+
+//Codes sent in Response.Code, so clients can tell errors apart without parsing Error. These never change once released
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidJSON      = "invalid_json"
+	codeInvalidBody      = "invalid_body"
+	codeValidationFailed = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codePostNotFound     = "post_not_found"
+	codeCommentNotFound  = "comment_not_found"
+	codeConflict         = "conflict"
+	codeRequestTooLarge  = "request_too_large"
+	codeNotAcceptable    = "not_acceptable"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeLocked           = "locked"
+	codeCommentsLocked   = "comments_locked"
+	codeCommentsClosed   = "comments_closed"
+	codeRateLimited      = "rate_limited"
+	codeInternal         = "internal_error"
+	//for statuses without a more specific code
+	codeUnknown = "error"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeBadRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusNotAcceptable:         codeNotAcceptable,
+	http.StatusConflict:              codeConflict,
+	http.StatusRequestEntityTooLarge: codeRequestTooLarge,
+	http.StatusUnsupportedMediaType:  codeUnsupportedMedia,
+	http.StatusLocked:                codeLocked,
+	http.StatusTooManyRequests:       codeRateLimited,
+	http.StatusInternalServerError:   codeInternal,
+}
+
+//errInvalidJSON is what a request body that can't be decoded is reported as
+var errInvalidJSON = errors.New("Error decoding request body")
+
+//errInvalidBody is what a request body in XML, MessagePack or CBOR that can't be decoded is reported as
+var errInvalidBody = errors.New("Error decoding request body")
+
+//apiError is an error for respondWithError with a message for clients, the error it is a kind of, and Details about it
+type apiError struct {
+	message string
+	//matched with errors.Is to pick the Code
+	kind    error
+	details map[string]interface{}
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.kind
+}
+
+func postNotFoundError(id string) error {
+	return &apiError{message: fmt.Sprintf("No post found with ID %s", id), kind: db.ErrPostNotFound, details: map[string]interface{}{"ID": id}}
+}
+
+func commentNotFoundError(commentID string) error {
+	return &apiError{message: fmt.Sprintf("No comment found with ID %s", commentID), kind: db.ErrCommentNotFound, details: map[string]interface{}{"CommentID": commentID}}
+}
+
+func commentsLockedError(id string) error {
+	return &apiError{message: fmt.Sprintf("Comments are locked on post %s", id), kind: db.ErrCommentsLocked, details: map[string]interface{}{"ID": id}}
+}
+
+func commentsClosedError(id string) error {
+	return &apiError{message: fmt.Sprintf("Comments are closed on post %s", id), kind: db.ErrCommentsClosed, details: map[string]interface{}{"ID": id}}
+}
+
+//invalidJSONError reports a request body decoding failed with err, which says where
+func invalidJSONError(err error) error {
+	return &apiError{message: errInvalidJSON.Error(), kind: errInvalidJSON, details: map[string]interface{}{"Reason": err.Error()}}
+}
+
+//invalidBodyError reports a request body in mediaType failed to decode with err
+func invalidBodyError(mediaType string, err error) error {
+	return &apiError{message: errInvalidBody.Error(), kind: errInvalidBody, details: map[string]interface{}{"ContentType": mediaType, "Reason": err.Error()}}
+}
+
+//errorCode picks the Code of an error response, from what err is a kind of if it is known, otherwise from its status
+func errorCode(statusCode int, err error) string {
+	switch {
+	case errors.Is(err, db.ErrPostNotFound):
+		return codePostNotFound
+	case errors.Is(err, db.ErrCommentNotFound):
+		return codeCommentNotFound
+	case errors.Is(err, db.ErrCommentsLocked):
+		return codeCommentsLocked
+	case errors.Is(err, db.ErrCommentsClosed):
+		return codeCommentsClosed
+	case errors.Is(err, db.ErrConflict):
+		return codeConflict
+	case errors.Is(err, errInvalidJSON):
+		return codeInvalidJSON
+	case errors.Is(err, errInvalidBody):
+		return codeInvalidBody
+	}
+	if code, ok := statusCodes[statusCode]; ok {
+		return code
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return codeInternal
+	}
+	return codeUnknown
+}
+
+//errorDetails are the Details of err, if it has any
+func errorDetails(err error) map[string]interface{} {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.details
+	}
+	return nil
+}
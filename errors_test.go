@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_ErrorResponses(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader(`{"Title":"Shenmue","ArticleText":"Forklifts","AuthorName":"Ryo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(rec, req)
+	var created struct {
+		Data CreateBlogPostOrCommentResponse
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postID := created.Data.ID
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		code               string
+		details            map[string]interface{}
+	}{
+		{http.MethodPost, "/blog", `{"Title":"Shenmue"`, http.StatusBadRequest, codeInvalidJSON, nil},
+		{http.MethodPost, "/blog", `{"Title":"Shenmue","Sailors":1}`, http.StatusBadRequest, codeInvalidJSON, map[string]interface{}{"Reason": "json: unknown field \"Sailors\""}},
+		{http.MethodPost, "/blog", `{"Title":"","ArticleText":"Forklifts"}`, http.StatusBadRequest, codeValidationFailed, nil},
+		{http.MethodPost, "/blog/" + postID + "/comment", `not json`, http.StatusBadRequest, codeInvalidJSON, nil},
+		{http.MethodGet, "/blog/missing", "", http.StatusNotFound, codePostNotFound, map[string]interface{}{"ID": "missing"}},
+		{http.MethodGet, "/blog/missing/comment", "", http.StatusNotFound, codePostNotFound, map[string]interface{}{"ID": "missing"}},
+		{http.MethodGet, "/blog/missing/comment/nope", "", http.StatusNotFound, codePostNotFound, nil},
+		{http.MethodGet, "/blog/" + postID + "/comment/nope", "", http.StatusNotFound, codeCommentNotFound, map[string]interface{}{"CommentID": "nope"}},
+		{http.MethodPost, "/blog/missing/comment", `{"CommentText":"Looking for sailors","AuthorName":"Ryo"}`, http.StatusNotFound, codePostNotFound, nil},
+		{http.MethodGet, "/authors/Nobody", "", http.StatusNotFound, codeNotFound, nil},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(requestIDHeader, "forklift-42")
+		server.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s %s: expected status code %d, got %d %s", c.method, c.path, c.status, rec.Code, rec.Body.String())
+			continue
+		}
+
+		var resp Response
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != c.code || resp.RequestID != "forklift-42" || resp.Error == "" {
+			t.Errorf("%s %s: expected code %s with the request ID, got %#v", c.method, c.path, c.code, resp)
+		}
+		for key, value := range c.details {
+			if resp.Details[key] != value {
+				t.Errorf("%s %s: expected %s to be %v in Details, got %#v", c.method, c.path, key, value, resp.Details)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+//HS256 secrets shorter than this are rejected
+const minSecretLength = 32
+
+//how far clocks are allowed to drift when checking exp and nbf
+const leeway = 30 * time.Second
+
+//Claims are the registered claims we understand, plus Name which is used as the display name and Role
+type Claims struct {
+	Subject   string `json:"sub"`
+	Name      string `json:"name,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+//Key is a signing or verification key, looked up by the kid in the token header.
+//HS256 keys use Secret, EdDSA keys use PublicKey to verify and PrivateKey to sign
+type Key struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PublicKey  ed25519.PublicKey
+	PrivateKey ed25519.PrivateKey
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid"`
+}
+
+//Keyset holds the keys tokens can be signed with. Keys can be added and removed while in use to rotate them
+type Keyset struct {
+	//if set, tokens must have a matching iss claim
+	Issuer string
+	//if set, tokens must have a matching aud claim
+	Audience string
+
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+func NewKeyset(keys ...Key) *Keyset {
+	ks := &Keyset{keys: map[string]Key{}}
+	for _, key := range keys {
+		ks.Add(key)
+	}
+	return ks
+}
+
+//Add starts accepting tokens signed with key, replacing any key with the same ID
+func (ks *Keyset) Add(key Key) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[key.ID] = key
+}
+
+//Remove stops accepting tokens signed with the key with ID kid
+func (ks *Keyset) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	delete(ks.keys, kid)
+}
+
+//Len returns how many keys are in the set
+func (ks *Keyset) Len() int {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return len(ks.keys)
+}
+
+func (ks *Keyset) key(kid string) (Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func sign(signingInput string, key Key) ([]byte, error) {
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case AlgorithmEdDSA:
+		if len(key.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("Key %s has no private key to sign with", key.ID)
+		}
+		return ed25519.Sign(key.PrivateKey, []byte(signingInput)), nil
+	default:
+		return nil, fmt.Errorf("Unsupported algorithm %s", key.Algorithm)
+	}
+}
+
+//Sign creates a compact JWT of claims signed with key
+func Sign(claims Claims, key Key) (string, error) {
+	headerSegment, err := encodeSegment(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsSegment, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := headerSegment + "." + claimsSegment
+	signature, err := sign(signingInput, key)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+//Verify checks the signature and validity period of token, returning its claims
+func (ks *Keyset) Verify(token string, now time.Time) (*Claims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("Token should have 3 segments, got %d", len(segments))
+	}
+
+	var h header
+	err := decodeSegment(segments[0], &h)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding token header: %w", err)
+	}
+	key, ok := ks.key(h.KeyID)
+	if !ok {
+		return nil, fmt.Errorf("Unknown key ID %q", h.KeyID)
+	}
+	//the key decides the algorithm, never the token, so an HS256 token can't be checked against a public key
+	if h.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("Token algorithm %s doesn't match key %s", h.Algorithm, key.ID)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(segments[2])
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding token signature: %w", err)
+	}
+	signingInput := segments[0] + "." + segments[1]
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		expected, err := sign(signingInput, key)
+		if err != nil {
+			return nil, err
+		}
+		ok = hmac.Equal(signature, expected)
+	case AlgorithmEdDSA:
+		ok = len(key.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(key.PublicKey, []byte(signingInput), signature)
+	default:
+		ok = false
+	}
+	if !ok {
+		return nil, fmt.Errorf("Invalid token signature")
+	}
+
+	var claims Claims
+	err = decodeSegment(segments[1], &claims)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding token claims: %w", err)
+	}
+
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("Token has no expiry")
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return nil, fmt.Errorf("Token has expired")
+	}
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, fmt.Errorf("Token is not valid yet")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("Token has no subject")
+	}
+	if ks.Issuer != "" && claims.Issuer != ks.Issuer {
+		return nil, fmt.Errorf("Unexpected token issuer %q", claims.Issuer)
+	}
+	if ks.Audience != "" && claims.Audience != ks.Audience {
+		return nil, fmt.Errorf("Unexpected token audience %q", claims.Audience)
+	}
+
+	return &claims, nil
+}
+
+//ParseKeys reads a comma separated list of kid:algorithm:base64key.
+//HS256 keys are the shared secret, EdDSA keys are a 32 byte public key or a 64 byte private key
+func ParseKeys(spec string) (keys []Key, err error) {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("Key should look like kid:algorithm:base64key, got %q", entry)
+		}
+		raw, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding key %s: %w", parts[0], err)
+		}
+
+		key := Key{ID: parts[0], Algorithm: parts[1]}
+		switch key.Algorithm {
+		case AlgorithmHS256:
+			if len(raw) < minSecretLength {
+				return nil, fmt.Errorf("HS256 key %s should be at least %d bytes", key.ID, minSecretLength)
+			}
+			key.Secret = raw
+		case AlgorithmEdDSA:
+			switch len(raw) {
+			case ed25519.PublicKeySize:
+				key.PublicKey = ed25519.PublicKey(raw)
+			case ed25519.PrivateKeySize:
+				key.PrivateKey = ed25519.PrivateKey(raw)
+				key.PublicKey = key.PrivateKey.Public().(ed25519.PublicKey)
+			default:
+				return nil, fmt.Errorf("EdDSA key %s should be %d or %d bytes", key.ID, ed25519.PublicKeySize, ed25519.PrivateKeySize)
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported algorithm %s for key %s", key.Algorithm, key.ID)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKeys(t *testing.T) (hsKey, edKey Key) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsKey = Key{ID: "hs-1", Algorithm: AlgorithmHS256, Secret: []byte(strings.Repeat("s", minSecretLength))}
+	edKey = Key{ID: "ed-1", Algorithm: AlgorithmEdDSA, PublicKey: publicKey, PrivateKey: privateKey}
+	return hsKey, edKey
+}
+
+func Test_SignVerify(t *testing.T) {
+	hsKey, edKey := testKeys(t)
+	now := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	claims := Claims{Subject: "user-1", Name: "Dr. Eggman", ExpiresAt: now.Add(time.Hour).Unix()}
+
+	//verifiers only get the public half of EdDSA keys
+	ks := NewKeyset(hsKey, Key{ID: edKey.ID, Algorithm: AlgorithmEdDSA, PublicKey: edKey.PublicKey})
+	for _, key := range []Key{hsKey, edKey} {
+		token, err := Sign(claims, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := ks.Verify(token, now)
+		if err != nil {
+			t.Errorf("Expected %s token to verify, got %s", key.Algorithm, err)
+			continue
+		}
+		if *actual != claims {
+			t.Errorf("Expected claims %#v, got %#v", claims, *actual)
+		}
+	}
+}
+
+func Test_Verify_Rejects(t *testing.T) {
+	hsKey, edKey := testKeys(t)
+	now := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	valid := Claims{Subject: "user-1", ExpiresAt: now.Add(time.Hour).Unix()}
+	ks := NewKeyset(hsKey, edKey)
+	ks.Issuer = "ea-gaming-review"
+
+	sign := func(claims Claims, key Key) string {
+		token, err := Sign(claims, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	issued := valid
+	issued.Issuer = "ea-gaming-review"
+	good := sign(issued, hsKey)
+	parts := strings.Split(good, ".")
+
+	//an HS256 token claiming to be signed by the EdDSA key, using its public key as the secret
+	confused := Key{ID: edKey.ID, Algorithm: AlgorithmHS256, Secret: edKey.PublicKey}
+
+	expired := issued
+	expired.ExpiresAt = now.Add(-time.Hour).Unix()
+	notYet := issued
+	notYet.NotBefore = now.Add(time.Hour).Unix()
+	noExpiry := issued
+	noExpiry.ExpiresAt = 0
+
+	cases := map[string]string{
+		"garbage":         "not.a.jwt.at.all",
+		"unknown kid":     sign(issued, Key{ID: "hs-2", Algorithm: AlgorithmHS256, Secret: hsKey.Secret}),
+		"tampered claims": parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999,"iss":"ea-gaming-review"}`)) + "." + parts[2],
+		"alg confusion":   sign(issued, confused),
+		"expired":         sign(expired, hsKey),
+		"not yet valid":   sign(notYet, hsKey),
+		"no expiry":       sign(noExpiry, hsKey),
+		"wrong issuer":    sign(valid, hsKey),
+	}
+	for name, token := range cases {
+		_, err := ks.Verify(token, now)
+		if err == nil {
+			t.Errorf("Expected %s token to be rejected, got nil", name)
+		}
+	}
+
+	_, err := ks.Verify(good, now)
+	if err != nil {
+		t.Errorf("Expected good token to verify, got %s", err)
+	}
+
+	//rotating the key out invalidates its tokens
+	ks.Remove(hsKey.ID)
+	_, err = ks.Verify(good, now)
+	if err == nil {
+		t.Error("Expected token signed with a removed key to be rejected, got nil")
+	}
+}
+
+func Test_ParseKeys(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("s", minSecretLength)))
+	spec := "hs-1:HS256:" + secret + ", ed-1:EdDSA:" + base64.StdEncoding.EncodeToString(publicKey) + ",ed-2:EdDSA:" + base64.StdEncoding.EncodeToString(privateKey)
+
+	keys, err := ParseKeys(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 keys, got %d", len(keys))
+	}
+	if !bytes.Equal(keys[2].PublicKey, publicKey) {
+		t.Error("Expected public key to be derived from the private key")
+	}
+
+	badSpecs := []string{
+		"hs-1:HS256:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"hs-1:RS256:" + secret,
+		"hs-1:" + secret,
+		"ed-1:EdDSA:" + base64.StdEncoding.EncodeToString([]byte("not a key")),
+	}
+	for _, spec := range badSpecs {
+		_, err = ParseKeys(spec)
+		if err == nil {
+			t.Errorf("Expected %q to be rejected, got nil", spec)
+		}
+	}
+
+	keys, err = ParseKeys("")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("Expected no keys from an empty spec, got %#v, %v", keys, err)
+	}
+}
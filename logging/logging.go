@@ -0,0 +1,173 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+)
+
+//Redacted replaces the values of sensitive fields
+const Redacted = "[REDACTED]"
+
+//Fields are the extra keys and values logged with a message
+type Fields map[string]interface{}
+
+//Logger writes messages at or above its level as lines of JSON
+type Logger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level string
+	now   func() time.Time
+}
+
+//New logs to out, skipping messages less severe than level
+func New(out io.Writer, level string) *Logger {
+	return &Logger{out: out, level: level, now: time.Now}
+}
+
+//SetLevel changes the least severe level logged
+func (l *Logger) SetLevel(level string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+//SetOutput changes where messages are written to
+func (l *Logger) SetOutput(out io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = out
+}
+
+//Enabled is whether messages at level are logged
+func (l *Logger) Enabled(level string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return config.LevelEnabled(l.level, level)
+}
+
+//Log writes msg and fields at level, redacting sensitive fields. time, level and msg can't be overridden by fields
+func (l *Logger) Log(level, msg string, fields Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	line := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		line[key] = redactValue(key, value)
+	}
+	line["time"] = l.now().UTC().Format(time.RFC3339Nano)
+	line["level"] = level
+	line["msg"] = msg
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]string{
+			"time":  line["time"].(string),
+			"level": level,
+			"msg":   msg,
+			"error": fmt.Sprintf("Error marshalling log fields: %s", err),
+		})
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(encoded, '\n'))
+}
+
+//sensitive key fragments, compared against keys lowercased and without separators
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "apikey", "email"}
+
+//IsSensitive is whether the value of a field called key shouldn't be logged
+func IsSensitive(key string) bool {
+	normalised := strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(key))
+	if normalised == "key" {
+		return true
+	}
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(normalised, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+//redactValue hides value if key is sensitive, and any sensitive fields inside it
+func redactValue(key string, value interface{}) interface{} {
+	if IsSensitive(key) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case nil, string, bool, int, int64, float64, time.Time, time.Duration:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	//structs, maps and slices are walked through their JSON form, so they are redacted by the names they are sent with
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	var decoded interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return redactJSON(decoded)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if IsSensitive(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactJSON(inner)
+			}
+		}
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactJSON(inner)
+		}
+	}
+	return value
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s"<>]+`)
+
+//RedactURLs is text with the values of sensitive query parameters hidden in any links in it
+func RedactURLs(text string) string {
+	return urlPattern.ReplaceAllStringFunc(text, func(link string) string {
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.RawQuery == "" {
+			return link
+		}
+		parsed.RawQuery = RedactQuery(parsed.Query())
+		return parsed.String()
+	})
+}
+
+//RedactQuery is query with the values of sensitive parameters hidden
+func RedactQuery(query url.Values) string {
+	redacted := url.Values{}
+	for key, values := range query {
+		for _, value := range values {
+			if IsSensitive(key) {
+				value = Redacted
+			}
+			redacted.Add(key, value)
+		}
+	}
+	return redacted.Encode()
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+)
+
+type account struct {
+	Username string `json:"Username"`
+	Password string `json:"Password"`
+	Sessions []struct {
+		Token string `json:"Token"`
+	} `json:"Sessions"`
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]interface{}
+		err := dec.Decode(&line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func Test_Log(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, config.LogLevelInfo)
+	logger.now = func() time.Time {
+		return time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	logger.Log(config.LogLevelDebug, "skipped", nil)
+	logger.Log(config.LogLevelError, "Something broke", Fields{"func": "Test_Log", "error": fmt.Errorf("on fire"), "msg": "not the message"})
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the error to be logged, got %#v", lines)
+	}
+	expected := map[string]interface{}{
+		"time":  "2020-04-01T12:00:00Z",
+		"level": "error",
+		"msg":   "Something broke",
+		"func":  "Test_Log",
+		"error": "on fire",
+	}
+	if fmt.Sprint(lines[0]) != fmt.Sprint(expected) {
+		t.Errorf("Expected %#v, got %#v", expected, lines[0])
+	}
+
+	logger.SetLevel(config.LogLevelDebug)
+	logger.Log(config.LogLevelDebug, "now logged", nil)
+	if len(decodeLines(t, buf)) != 1 {
+		t.Errorf("Expected debug messages to be logged after lowering the level")
+	}
+}
+
+func Test_Log_Redaction(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := New(buf, config.LogLevelInfo)
+
+	acc := account{Username: "sonic", Password: "chilidogs"}
+	acc.Sessions = append(acc.Sessions, struct {
+		Token string `json:"Token"`
+	}{Token: "abc"})
+	logger.Log(config.LogLevelInfo, "Registered", Fields{"account": acc, "csrf_token": "def", "X-API-Key": "ghi", "title": "Sonic Adventure"})
+
+	line := buf.String()
+	for _, secret := range []string{"chilidogs", "abc", "def", "ghi"} {
+		if bytes.Contains([]byte(line), []byte(`"`+secret+`"`)) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, line)
+		}
+	}
+	for _, kept := range []string{"sonic", "Sonic Adventure"} {
+		if !bytes.Contains([]byte(line), []byte(`"`+kept+`"`)) {
+			t.Errorf("Expected %q to be logged, got %s", kept, line)
+		}
+	}
+}
+
+func Test_RedactQuery(t *testing.T) {
+	query := url.Values{"token": {"secret"}, "limit": {"5"}}
+	expected := "limit=5&token=%5BREDACTED%5D"
+	if actual := RedactQuery(query); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func Test_RedactURLs(t *testing.T) {
+	text := "Open this link:\n\nhttps://reviews.example.com/v1/auth/verify-email?token=abc.def\n\nor http://localhost:8080/blog?limit=5"
+	expected := "Open this link:\n\nhttps://reviews.example.com/v1/auth/verify-email?token=%5BREDACTED%5D\n\nor http://localhost:8080/blog?limit=5"
+	if actual := RedactURLs(text); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
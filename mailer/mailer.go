@@ -0,0 +1,101 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/logging"
+)
+
+//Message is a plain text email
+type Message struct {
+	To      string `json:"To"`
+	Subject string `json:"Subject"`
+	Body    string `json:"Body"`
+}
+
+//Mailer sends a single email
+type Mailer interface {
+	Send(msg Message) error
+}
+
+//LogMailer logs each email to Logger instead of sending it, for local use. The recipient and any tokens in links are redacted
+type LogMailer struct {
+	Logger *logging.Logger
+}
+
+func (m LogMailer) Send(msg Message) error {
+	m.Logger.Log(config.LogLevelInfo, "Logged email instead of sending it", logging.Fields{"func": "LogMailer.Send", "email": msg.To, "subject": msg.Subject, "body": logging.RedactURLs(msg.Body)})
+	return nil
+}
+
+//FileMailer appends each email as a line of JSON to the file at Path, for local use and tests
+type FileMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//SMTPMailer sends email through the SMTP server at Addr (host:port) from From. Auth can be nil if the server doesn't need it
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (m SMTPMailer) Send(msg Message) error {
+	raw, err := formatMessage(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, raw)
+}
+
+//formatMessage builds the RFC 5322 message for msg, refusing header injection through the addresses
+func formatMessage(from string, msg Message, date time.Time) ([]byte, error) {
+	for _, address := range []string{from, msg.To} {
+		if strings.ContainsAny(address, "\r\n") {
+			return nil, fmt.Errorf("Invalid email address %q", address)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
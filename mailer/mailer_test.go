@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/logging"
+)
+
+func Test_FileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mail.jsonl")
+
+	m := &FileMailer{Path: path}
+	sent := []Message{
+		{To: "sonic@example.com", Subject: "Verify your email", Body: "https://reviews.example.com/verify"},
+		{To: "tails@example.com", Subject: "Verify your email", Body: "https://reviews.example.com/verify"},
+	}
+	for _, msg := range sent {
+		err = m.Send(msg)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var received []Message
+	for scanner.Scan() {
+		var msg Message
+		err = json.Unmarshal(scanner.Bytes(), &msg)
+		if err != nil {
+			t.Error(err)
+		}
+		received = append(received, msg)
+	}
+	if len(received) != len(sent) || received[1] != sent[1] {
+		t.Errorf("Expected %#v, got %#v", sent, received)
+	}
+}
+
+func Test_LogMailer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := LogMailer{Logger: logging.New(buf, config.LogLevelInfo)}
+	err := m.Send(Message{To: "sonic@example.com", Subject: "Verify your email", Body: "Open https://reviews.example.com/v1/auth/verify-email?token=abc.def to publish"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var line map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("Expected a line of JSON, got %q: %v", buf.String(), err)
+	}
+	if line["subject"] != "Verify your email" || line["email"] != logging.Redacted {
+		t.Errorf("Expected the subject with the recipient redacted, got %v", line)
+	}
+	for _, secret := range []string{"sonic@example.com", "abc.def"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, buf.String())
+		}
+	}
+}
+
+func Test_FormatMessage(t *testing.T) {
+	date := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	raw, err := formatMessage("reviews@example.com", Message{To: "sonic@example.com", Subject: "Vérify", Body: "line one\nline two"}, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "From: reviews@example.com\r\nTo: sonic@example.com\r\nSubject: =?utf-8?q?V=C3=A9rify?=\r\nDate: Mon, 30 Mar 2020 07:34:23 +0000\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nline one\r\nline two\r\n"
+	if string(raw) != expected {
+		t.Errorf("Expected %q, got %q", expected, raw)
+	}
+
+	_, err = formatMessage("reviews@example.com", Message{To: "sonic@example.com\r\nBcc: everyone@example.com"}, date)
+	if err == nil || !strings.Contains(err.Error(), "Invalid email address") {
+		t.Errorf("Expected header injection to be refused, got %v", err)
+	}
+}
@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/aschereT/ea-gaming-review/config"
 	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/logging"
+	"github.com/aschereT/ea-gaming-review/notify"
+	"github.com/aschereT/ea-gaming-review/validate"
 	"github.com/gorilla/mux"
-	"github.com/hashicorp/go-memdb"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Response struct {
 	Data  interface{} `json:"Data,omitempty"`
 	Error string      `json:"Error,omitempty"`
+	//what kind of error it was, stable unlike Error. One of the code constants
+	Code string `json:"Code,omitempty"`
+	//every problem with the request's fields, when it failed validation
+	Errors validate.Errors `json:"Errors,omitempty"`
+	//more about the error, like the ID that wasn't found
+	Details map[string]interface{} `json:"Details,omitempty"`
+	//the X-Request-ID of the request that failed, to find it in the logs
+	RequestID string `json:"RequestID,omitempty"`
 }
 
 type CreateBlogPostOrCommentResponse struct {
 	ID string `json:"ID"`
+	//the comment is hidden until its author verifies their email
+	Pending bool `json:"Pending,omitempty"`
+	//lets whoever posted an anonymous comment edit it, only ever shown here
+	EditToken string `json:"EditToken,omitempty"`
+}
+
+type CreateBlogCommentRequest struct {
+	db.BlogComment
+	//anonymous commenters give an email to verify, when that is required
+	Email string `json:"Email" validate:"max=254"`
 }
 
 type GetBlogPostIDsResponse struct {
@@ -29,23 +58,100 @@ type GetBlogCommentsIDsResponse struct {
 	IDs        []string `json:"IDs"`
 }
 
+type EditBlogCommentRequest struct {
+	//the EditToken from creating the comment, for anonymous comments
+	EditToken   string `json:"EditToken" validate:"max=100"`
+	CommentText string `json:"CommentText" validate:"required,max=5000,multiline"`
+}
+
+type GetCommentRevisionsResponse struct {
+	CommentID string               `json:"CommentID"`
+	Revisions []db.CommentRevision `json:"Revisions"`
+}
+
+type FlagBlogCommentRequest struct {
+	Reason string `json:"Reason" validate:"max=20"`
+}
+
+type FlagBlogCommentResponse struct {
+	Hidden bool `json:"Hidden"`
+}
+
+type GetFlaggedCommentsResponse struct {
+	Comments []db.FlaggedComment `json:"Comments"`
+}
+
+type GetAuthorsResponse struct {
+	AuthorNames []string `json:"AuthorNames"`
+}
+
+type GetAuthorPostsResponse struct {
+	AuthorName string        `json:"AuthorName"`
+	Offset     int           `json:"Offset"`
+	Limit      int           `json:"Limit"`
+	Total      int           `json:"Total"`
+	Posts      []db.BlogPost `json:"Posts"`
+}
+
+type GetAuthorCommentsResponse struct {
+	AuthorName string           `json:"AuthorName"`
+	Offset     int              `json:"Offset"`
+	Limit      int              `json:"Limit"`
+	Total      int              `json:"Total"`
+	Comments   []db.BlogComment `json:"Comments"`
+}
+
+type GetNotificationsResponse struct {
+	Recipient     string            `json:"Recipient"`
+	Notifications []db.Notification `json:"Notifications"`
+}
+
+type SetCommentStateRequest struct {
+	//one of db.CommentStateOpen or db.CommentStateLocked
+	CommentState           string `json:"CommentState" validate:"required,oneof=open locked"`
+	CommentsCloseAfterDays int    `json:"CommentsCloseAfterDays" validate:"min=0"`
+}
+
 var (
-	inMemDB *memdb.MemDB
+	//the store handlers fall back to when not running inside a Server, eg when tests call them directly
+	inMemDB *db.DB
+	//writes every log line as JSON to stdout
+	logger = logging.New(os.Stdout, config.LogLevelInfo)
 )
 
 func healthCheckHandler(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(w, "server_up")
 }
 
-func logError(funcname string, err error) {
-	fmt.Printf("[%s] %s: %s\n", time.Now().String(), funcname, err)
+//logs err at error level, with the request ID from ctx if there is one
+func logError(ctx context.Context, funcname string, err error) {
+	logAt(ctx, config.LogLevelError, funcname, fmt.Sprint(err), nil)
+}
+
+//logs a at info level, with the request ID from ctx if there is one
+func log(ctx context.Context, funcname string, a ...interface{}) {
+	logAt(ctx, config.LogLevelInfo, funcname, strings.TrimSuffix(fmt.Sprintln(a...), "\n"), nil)
 }
 
-func log(funcname string, a ...interface{}) {
-	fmt.Println(fmt.Sprintf("[%s] %s:", time.Now().String(), funcname), a)
+//logs msg and fields at level, with the function it came from and the request and trace IDs from ctx if there are any
+func logAt(ctx context.Context, level, funcname, msg string, fields logging.Fields) {
+	if !logger.Enabled(level) {
+		return
+	}
+	line := logging.Fields{"func": funcname}
+	for key, value := range fields {
+		line[key] = value
+	}
+	if requestID := currentRequestID(ctx); requestID != "" {
+		line["request_id"] = requestID
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		line["trace_id"], line["span_id"] = sc.TraceID().String(), sc.SpanID().String()
+	}
+	logger.Log(level, msg, line)
 }
 
-func setupDB() *memdb.MemDB {
+func setupDB() *db.DB {
 	newDB, err := db.CreateDB()
 	if err != nil {
 		panic(err)
@@ -53,15 +159,90 @@ func setupDB() *memdb.MemDB {
 	return newDB
 }
 
+func newDeliverer(cfg config.Notifications) (notify.Deliverer, error) {
+	switch cfg.Delivery {
+	case config.DeliveryLog:
+		return notify.LogDeliverer{Logger: logger}, nil
+	case config.DeliveryFile:
+		return &notify.FileDeliverer{Path: cfg.File}, nil
+	default:
+		return nil, fmt.Errorf("Unknown notification delivery %s", cfg.Delivery)
+	}
+}
+
+//periodically drains the notification outbox until stop is closed, then drains it one last time so nothing queued is lost
+func (s *Server) runNotificationDispatcher(stop <-chan struct{}) {
+	const funcname = "runNotificationDispatcher"
+	ticker := time.NewTicker(s.Config.Notifications.Interval.Duration)
+	defer ticker.Stop()
+	for {
+		stopping := false
+		select {
+		case <-stop:
+			stopping = true
+		case <-ticker.C:
+		}
+
+		delivered, err := notify.DeliverPending(context.Background(), s.DB, s.deliverer)
+		if err != nil {
+			logError(context.Background(), funcname, err)
+		}
+		if delivered > 0 {
+			log(context.Background(), funcname, "Delivered", delivered, "notifications")
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+const defaultPageLimit = 20
+const maxPageLimit = 100
+
+//reads the offset and limit query parameters, defaulting to the first page
+func parsePagination(req *http.Request) (offset, limit int, err error) {
+	query := req.URL.Query()
+	limit = defaultPageLimit
+	if limitParam := query.Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit should be between 1 and %d", maxPageLimit)
+		}
+	}
+	if offsetParam := query.Get("offset"); offsetParam != "" {
+		offset, err = strconv.Atoi(offsetParam)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset should not be negative")
+		}
+	}
+	return offset, limit, nil
+}
+
 //immediately respond with Data nil: and Error: err
 func respondWithError(w http.ResponseWriter, statusCode int, err error) {
 	const funcname = "respondWithError"
 	w.Header().Set("Content-Type", "application/json")
 
 	w.WriteHeader(statusCode)
-	resp, jsonErr := json.Marshal(Response{Data: nil, Error: fmt.Sprint(err)})
+	resp, jsonErr := marshalResponse(w, Response{Error: fmt.Sprint(err), Code: errorCode(statusCode, err), Details: errorDetails(err), RequestID: w.Header().Get(requestIDHeader)})
+	if jsonErr != nil {
+		logError(context.Background(), funcname, fmt.Errorf("Error marshalling error response: %w", jsonErr))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(nil)
+	} else {
+		w.Write(resp)
+	}
+}
+
+//respondWithErrors responds with every problem found with a request's fields
+func respondWithErrors(w http.ResponseWriter, statusCode int, errs validate.Errors) {
+	const funcname = "respondWithErrors"
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(statusCode)
+	resp, jsonErr := marshalResponse(w, Response{Error: errs.Error(), Code: codeValidationFailed, Errors: errs, RequestID: w.Header().Get(requestIDHeader)})
 	if jsonErr != nil {
-		logError(funcname, fmt.Errorf("Error marshalling error response: %w", jsonErr))
+		logError(context.Background(), funcname, fmt.Errorf("Error marshalling error response: %w", jsonErr))
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(nil)
 	} else {
@@ -73,18 +254,18 @@ func getBlogPostsIDsHandler(w http.ResponseWriter, req *http.Request) {
 	const funcname = "getBlogPostsIDsHandler"
 	w.Header().Set("Content-Type", "application/json")
 
-	ids, err := db.GetBlogIDs(inMemDB)
+	ids, err := db.GetBlogIDs(req.Context(), currentDB(req))
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog IDs"))
 		return
 	}
 
-	log(funcname, "Got", len(ids), "blog IDs")
+	log(req.Context(), funcname, "Got", len(ids), "blog IDs")
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: GetBlogPostIDsResponse{IDs: ids}})
+	resp, err := marshalResponse(w, Response{Data: GetBlogPostIDsResponse{IDs: ids}})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling error response"))
 	} else {
 		w.Write(resp)
@@ -97,24 +278,25 @@ func getSingleBlogPostHandler(w http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	id := vars["id"]
-	post, err := db.GetBlogPost(inMemDB, id)
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
 		return
 	}
 	if post == nil {
-		err = fmt.Errorf("No post found with ID %s", id)
-		logError(funcname, err)
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusNotFound, err)
 		return
 	}
 
-	log(funcname, "Got blog post", id)
+	log(req.Context(), funcname, "Got blog post", id)
+	setLastModified(w, post.LastModified())
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: *post})
+	resp, err := marshalResponse(w, Response{Data: *post})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
@@ -131,51 +313,61 @@ func createBlogPostHandler(w http.ResponseWriter, req *http.Request) {
 	var newPost db.BlogPost
 	err := dec.Decode(&newPost)
 	if err != nil {
-		logError(funcname, err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error decoding request body"))
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
 		return
 	}
-
-	log(funcname, "Received request to create new blog post", fmt.Sprintf("%#v", newPost))
-	if newPost.Title == "" {
-		err := fmt.Errorf("Title should not be empty")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
+	if statusCode, err := authorize(req, actionCreatePost, nil, nil); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
 		return
 	}
-	if newPost.ArticleText == "" {
-		err := fmt.Errorf("ArticleText should not be empty")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
-		return
+
+	logAt(req.Context(), config.LogLevelDebug, funcname, "Received request to create new blog post", logging.Fields{"title": newPost.Title, "author_name": newPost.AuthorName, "article_length": len(newPost.ArticleText)})
+	errs := validate.Struct(&newPost)
+	if newPost.ID != "" {
+		//should be empty
+		errs.Add("ID", "ID should not be defined in new post requests")
 	}
-	if newPost.AuthorName == "" {
-		err := fmt.Errorf("AuthorName should not be empty")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
+	if !newPost.CreatedAt.IsZero() {
+		errs.Add("CreatedAt", "CreatedAt should not be defined in new post requests")
+	}
+	if newPost.CommentState != "" && newPost.CommentState != db.CommentStateOpen && newPost.CommentState != db.CommentStateLocked {
+		errs.Add("CommentState", "CommentState should be %s or %s", db.CommentStateOpen, db.CommentStateLocked)
+	}
+	if newPost.CommentsCloseAfterDays < 0 {
+		errs.Add("CommentsCloseAfterDays", "CommentsCloseAfterDays should not be negative")
+	}
+	authorName, statusCode, err := resolveAuthorName(req, "AuthorName", newPost.AuthorName)
+	if statusCode == http.StatusBadRequest {
+		errs.Add("AuthorName", err.Error())
+	}
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
 		return
 	}
-	if newPost.ID != "" {
-		//should be empty
-		err := fmt.Errorf("ID should not be defined in new post requests")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
 		return
 	}
-	log(funcname, "Request looks legit", fmt.Sprintf("%#v", newPost))
+	newPost.AuthorName = authorName
+	newPost.OwnerID = currentActor(req).ID
+	logAt(req.Context(), config.LogLevelDebug, funcname, "Request looks legit", logging.Fields{"author_name": newPost.AuthorName})
 
-	id, err := db.CreateBlogPost(inMemDB, newPost)
+	id, err := db.CreateBlogPost(req.Context(), currentDB(req), auditActor(req), newPost)
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error creating new blog post"))
 		return
 	}
 
-	log(funcname, "Created new blog post", id)
+	log(req.Context(), funcname, "Created new blog post", id)
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: CreateBlogPostOrCommentResponse{ID: id}})
+	resp, err := marshalResponse(w, Response{Data: CreateBlogPostOrCommentResponse{ID: id}})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
@@ -188,24 +380,108 @@ func deleteBlogPostHandler(w http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	id := vars["id"]
-	exists, err := db.DeleteBlogPost(inMemDB, id)
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
+		return
+	}
+	if post == nil {
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if statusCode, err := authorize(req, actionDeletePost, post, nil); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	exists, err := db.DeleteBlogPost(req.Context(), currentDB(req), auditActor(req), id)
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error deleting blog post"))
 		return
 	}
 	if !exists {
-		err = fmt.Errorf("No post found with ID %s", id)
-		logError(funcname, err)
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusNotFound, err)
 		return
 	}
 
-	log(funcname, "Deleted blog post", id)
+	log(req.Context(), funcname, "Deleted blog post", id)
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: "OK"})
+	resp, err := marshalResponse(w, Response{Data: "OK"})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func setCommentStateHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "setCommentStateHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var stateReq SetCommentStateRequest
+	err := dec.Decode(&stateReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	if errs := validate.Struct(&stateReq); len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
+		return
+	}
+	if post == nil {
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if statusCode, err := authorize(req, actionModerateComments, post, nil); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	exists, err := db.SetCommentState(req.Context(), currentDB(req), auditActor(req), id, stateReq.CommentState, stateReq.CommentsCloseAfterDays)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error setting comment state"))
+		return
+	}
+	if !exists {
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	log(req.Context(), funcname, "Set comment state of", id, "to", stateReq.CommentState)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: "OK"})
+	if err != nil {
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
@@ -218,18 +494,23 @@ func getBlogCommentsIDsHandler(w http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	id := vars["id"]
-	ids, err := db.GetCommentIDs(inMemDB, id)
+	ids, err := db.GetCommentIDs(req.Context(), currentDB(req), id)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(id))
+		return
+	}
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment IDs"))
 		return
 	}
 
-	log(funcname, "Got", len(ids), "comment IDs")
+	log(req.Context(), funcname, "Got", len(ids), "comment IDs")
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: GetBlogCommentsIDsResponse{IDs: ids, BlogPostID: id}})
+	resp, err := marshalResponse(w, Response{Data: GetBlogCommentsIDsResponse{IDs: ids, BlogPostID: id}})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling error response"))
 	} else {
 		w.Write(resp)
@@ -243,24 +524,30 @@ func getSingleBlogCommentHandler(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	id := vars["id"]
 	commentID := vars["commentID"]
-	comment, err := db.GetBlogComment(inMemDB, id, commentID)
+	comment, err := db.GetBlogComment(req.Context(), currentDB(req), id, commentID)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(id))
+		return
+	}
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
 		return
 	}
-	if comment == nil {
-		err = fmt.Errorf("No post found with ID %s", id)
-		logError(funcname, err)
+	if comment == nil || comment.ArticleID != id || !comment.Visible() {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusNotFound, err)
 		return
 	}
 
-	log(funcname, "Got blog post", id)
+	log(req.Context(), funcname, "Got blog post", id)
+	setLastModified(w, comment.LastModified())
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: *comment})
+	resp, err := marshalResponse(w, Response{Data: *comment})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
@@ -277,55 +564,422 @@ func createBlogCommentHandler(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 	dec := json.NewDecoder(req.Body)
 	dec.DisallowUnknownFields()
-	var newPost db.BlogComment
-	err := dec.Decode(&newPost)
+	var commentReq CreateBlogCommentRequest
+	err := dec.Decode(&commentReq)
 	if err != nil {
-		logError(funcname, err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error decoding request body"))
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
 		return
 	}
 
-	log(funcname, "Received request to create new blog post", fmt.Sprintf("%#v", newPost))
-	if newPost.CommentText == "" {
-		err := fmt.Errorf("CommentText should not be empty")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
-		return
-	}
-	if newPost.AuthorName == "" {
-		err := fmt.Errorf("AuthorName should not be empty")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
-		return
+	errs := validate.Struct(&commentReq)
+	newPost := commentReq.BlogComment
+	logAt(req.Context(), config.LogLevelDebug, funcname, "Received request to create new blog comment", logging.Fields{"article_id": articleID, "author_name": newPost.AuthorName, "comment_length": len(newPost.CommentText)})
+	needsVerification := currentConfig(req).Features.RequireEmailVerification && currentActor(req).Role == ""
+	email := strings.ToLower(commentReq.Email)
+	if needsVerification {
+		if email == "" {
+			errs.Add("Email", "Email is required to comment anonymously")
+		} else if !isEmailAddress(email) {
+			errs.Add("Email", "Email should be a valid email address")
+		}
 	}
 	if newPost.ArticleID != "" {
-		err := fmt.Errorf("ArticleID should not be defined in new post requests")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
-		return
+		errs.Add("ArticleID", "ArticleID should not be defined in new post requests")
 	}
 	if newPost.ID != "" {
 		//should be empty
-		err := fmt.Errorf("ID should not be defined in new post requests")
-		logError(funcname, err)
-		respondWithError(w, http.StatusBadRequest, err)
+		errs.Add("ID", "ID should not be defined in new post requests")
+	}
+	if newPost.EditedAt != nil {
+		errs.Add("EditedAt", "EditedAt should not be defined in new post requests")
+	}
+	if newPost.Hidden {
+		errs.Add("Hidden", "Hidden should not be defined in new post requests")
+	}
+	authorName, statusCode, err := resolveAuthorName(req, "AuthorName", newPost.AuthorName)
+	if statusCode == http.StatusBadRequest {
+		errs.Add("AuthorName", err.Error())
+	}
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
 		return
 	}
+	newPost.AuthorName = authorName
 	newPost.ArticleID = articleID
-	log(funcname, "Request looks legit", fmt.Sprintf("%#v", newPost))
+	newPost.OwnerID = currentActor(req).ID
+	logAt(req.Context(), config.LogLevelDebug, funcname, "Request looks legit", logging.Fields{"author_name": newPost.AuthorName})
+
+	var editToken string
+	if newPost.OwnerID == "" {
+		editToken, err = newPost.NewEditToken()
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error creating new blog post"))
+			return
+		}
+	}
 
-	commentID, err := db.CreateBlogComment(inMemDB, newPost)
+	//only a browser that opened a verification link for email is trusted with it, not anyone who knows the address
+	if needsVerification && currentServer(req).verifiedEmail(req) != email {
+		newPost.PendingEmail = email
+	}
+
+	commentID, err := db.CreateBlogComment(req.Context(), currentDB(req), auditActor(req), newPost, currentConfig(req).Comments.CloseAfter.Duration)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(articleID))
+		return
+	}
+	if errors.Is(err, db.ErrCommentsLocked) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusLocked, commentsLockedError(articleID))
+		return
+	}
+	if errors.Is(err, db.ErrCommentsClosed) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusForbidden, commentsClosedError(articleID))
+		return
+	}
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error creating new blog post"))
 		return
 	}
 
-	log(funcname, "Created new comment on", articleID, commentID)
+	statusCode = http.StatusOK
+	if newPost.PendingEmail != "" {
+		err = currentServer(req).sendVerificationEmail(email, commentID)
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			//nobody could ever verify it, so don't leave it lying around
+			_, err = db.DeleteBlogComment(req.Context(), currentDB(req), db.SystemActor, articleID, commentID)
+			if err != nil {
+				logError(req.Context(), funcname, err)
+			}
+			respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error sending verification email"))
+			return
+		}
+		log(req.Context(), funcname, "Comment", commentID, "is pending verification")
+		statusCode = http.StatusAccepted
+	}
+
+	log(req.Context(), funcname, "Created new comment on", articleID, commentID)
+	w.WriteHeader(statusCode)
+	resp, err := marshalResponse(w, Response{Data: CreateBlogPostOrCommentResponse{ID: commentID, Pending: newPost.PendingEmail != "", EditToken: editToken}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func editBlogCommentHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "editBlogCommentHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+	commentID := vars["commentID"]
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var editReq EditBlogCommentRequest
+	err := dec.Decode(&editReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	errs := validate.Struct(&editReq)
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	comment, err := db.GetBlogComment(req.Context(), currentDB(req), id, commentID)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(id))
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment"))
+		return
+	}
+	if comment == nil || comment.ArticleID != id {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	//whoever posted the comment while logged in, or anonymously with the token they were given then
+	a := currentActor(req)
+	if a.ID == "" && editReq.EditToken == "" {
+		err = fmt.Errorf("Log in or give the comment's EditToken to edit it")
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+	owns := comment.OwnerID != "" && comment.OwnerID == a.ID
+	if !owns && !(comment.OwnerID == "" && comment.CanEditWith(editReq.EditToken)) {
+		err = fmt.Errorf("Only the original author can edit this comment")
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusForbidden, err)
+		return
+	}
+	if editWindow := currentConfig(req).Comments.EditWindow.Duration; time.Since(comment.CreatedAt) > editWindow {
+		err = fmt.Errorf("Comments can only be edited within %s of posting", editWindow)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusForbidden, err)
+		return
+	}
+
+	exists, err := db.EditBlogComment(req.Context(), currentDB(req), auditActor(req), id, commentID, editReq.CommentText)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error editing comment"))
+		return
+	}
+	if !exists {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	comment, err = db.GetBlogComment(req.Context(), currentDB(req), id, commentID)
+	if err != nil || comment == nil {
+		logError(req.Context(), funcname, fmt.Errorf("Error getting edited comment %s: %v", commentID, err))
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment"))
+		return
+	}
+
+	log(req.Context(), funcname, "Edited comment", commentID, "on", id)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: *comment})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func getCommentRevisionsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getCommentRevisionsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+	commentID := vars["commentID"]
+
+	comment, err := db.GetBlogComment(req.Context(), currentDB(req), id, commentID)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(id))
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment"))
+		return
+	}
+	if comment == nil || comment.ArticleID != id {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
+		return
+	}
+	if statusCode, err := authorize(req, actionModerateComments, post, comment); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	revisions, err := db.GetCommentRevisions(req.Context(), currentDB(req), id, commentID)
+	if errors.Is(err, db.ErrCommentNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, commentNotFoundError(commentID))
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment revisions"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(revisions), "revisions of comment", commentID)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetCommentRevisionsResponse{CommentID: commentID, Revisions: revisions}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func flagBlogCommentHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "flagBlogCommentHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+	commentID := vars["commentID"]
+
+	defer req.Body.Close()
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	var flagReq FlagBlogCommentRequest
+	err := dec.Decode(&flagReq)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, invalidJSONError(err))
+		return
+	}
+
+	errs := validate.Struct(&flagReq)
+	if !db.IsValidFlagReason(flagReq.Reason) {
+		errs.Add("Reason", "Reason should be one of %s, %s or %s", db.FlagReasonSpam, db.FlagReasonHarassment, db.FlagReasonSpoilers)
+	}
+	if len(errs) > 0 {
+		logError(req.Context(), funcname, errs)
+		respondWithErrors(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	//readers count once each, by who they're logged in as or their IP when anonymous
+	reporterID := currentActor(req).ID
+	if reporterID == "" {
+		reporterID = "ip:" + clientIP(req)
+	}
+
+	exists, hidden, err := db.FlagBlogComment(req.Context(), currentDB(req), auditActor(req), id, commentID, reporterID, flagReq.Reason, currentConfig(req).Comments.FlagHideThreshold)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error flagging comment"))
+		return
+	}
+	if !exists {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	log(req.Context(), funcname, reporterID, "flagged comment", commentID, "as", flagReq.Reason, "hidden:", hidden)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: FlagBlogCommentResponse{Hidden: hidden}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func clearBlogCommentFlagsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "clearBlogCommentFlagsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+	commentID := vars["commentID"]
+
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
+		return
+	}
+	if post == nil {
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if statusCode, err := authorize(req, actionModerateComments, post, nil); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	exists, err := db.ClearCommentFlags(req.Context(), currentDB(req), auditActor(req), id, commentID)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error clearing comment flags"))
+		return
+	}
+	if !exists {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+
+	log(req.Context(), funcname, "Cleared flags on comment", commentID)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: "OK"})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func getFlaggedCommentsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getFlaggedCommentsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	if statusCode, err := authorize(req, actionModerateAll, nil, nil); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	limit := 50
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 1 {
+			err := fmt.Errorf("limit should be a positive number")
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit = parsed
+	}
+
+	flagged, err := db.GetFlaggedComments(req.Context(), currentDB(req), limit)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting flagged comments"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(flagged), "flagged comments")
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: CreateBlogPostOrCommentResponse{ID: commentID}})
+	resp, err := marshalResponse(w, Response{Data: GetFlaggedCommentsResponse{Comments: flagged}})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
@@ -339,54 +993,259 @@ func deleteBlogCommentHandler(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	id := vars["id"]
 	commentID := vars["commentID"]
-	exists, err := db.DeleteBlogComment(inMemDB, id, commentID)
+	post, err := db.GetBlogPost(req.Context(), currentDB(req), id)
 	if err != nil {
-		logError(funcname, err)
-		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error deleting blog post"))
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting blog post"))
+		return
+	}
+	if post == nil {
+		err = postNotFoundError(id)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	comment, err := db.GetBlogComment(req.Context(), currentDB(req), id, commentID)
+	if errors.Is(err, db.ErrPostNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, postNotFoundError(id))
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting comment"))
+		return
+	}
+	if comment == nil || comment.ArticleID != id {
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	if statusCode, err := authorize(req, actionDeleteComment, post, comment); err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, statusCode, err)
+		return
+	}
+
+	exists, err := db.DeleteBlogComment(req.Context(), currentDB(req), auditActor(req), id, commentID)
+	if errors.Is(err, db.ErrCommentNotFound) {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, commentNotFoundError(commentID))
+		return
+	}
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error deleting comment"))
 		return
 	}
 	if !exists {
-		err = fmt.Errorf("No post found with ID %s", id)
-		logError(funcname, err)
+		err = commentNotFoundError(commentID)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusNotFound, err)
 		return
 	}
 
-	log(funcname, "Deleted blog post", id)
+	log(req.Context(), funcname, "Deleted comment", commentID, "on", id)
 	w.WriteHeader(http.StatusOK)
-	resp, err := json.Marshal(Response{Data: "OK"})
+	resp, err := marshalResponse(w, Response{Data: "OK"})
 	if err != nil {
-		logError(funcname, err)
+		logError(req.Context(), funcname, err)
 		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
 	} else {
 		w.Write(resp)
 	}
 }
 
-func main() {
-	const funcname = "main"
-	r := mux.NewRouter()
-	r.HandleFunc("/health", healthCheckHandler).Methods(http.MethodGet)
+func getAuthorsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAuthorsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	names, err := db.GetAuthorNames(req.Context(), currentDB(req))
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting authors"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(names), "authors")
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetAuthorsResponse{AuthorNames: names}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func getAuthorHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAuthorHandler"
+	w.Header().Set("Content-Type", "application/json")
 
-	r.HandleFunc("/blog", getBlogPostsIDsHandler).Methods(http.MethodGet)
-	r.HandleFunc("/blog", createBlogPostHandler).Methods(http.MethodPost)
+	vars := mux.Vars(req)
+	name := vars["name"]
+	stats, err := db.GetAuthorStats(req.Context(), currentDB(req), name)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting author"))
+		return
+	}
+	if stats == nil {
+		err = fmt.Errorf("No author found with name %s", name)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusNotFound, err)
+		return
+	}
 
-	r.HandleFunc("/blog/{id}", getSingleBlogPostHandler).Methods(http.MethodGet)
-	r.HandleFunc("/blog/{id}", deleteBlogPostHandler).Methods(http.MethodDelete)
+	log(req.Context(), funcname, "Got author", name)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: *stats})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
 
-	r.HandleFunc("/blog/{id}/comment", getBlogCommentsIDsHandler).Methods(http.MethodGet)
-	r.HandleFunc("/blog/{id}/comment", createBlogCommentHandler).Methods(http.MethodPost)
+func getAuthorPostsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAuthorPostsHandler"
+	w.Header().Set("Content-Type", "application/json")
 
-	r.HandleFunc("/blog/{id}/comment/{commentID}", getSingleBlogCommentHandler).Methods(http.MethodGet)
-	r.HandleFunc("/blog/{id}/comment/{commentID}", deleteBlogCommentHandler).Methods(http.MethodDelete)
-	http.Handle("/", r)
+	vars := mux.Vars(req)
+	name := vars["name"]
+	offset, limit, err := parsePagination(req)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
 
-	inMemDB = setupDB()
+	posts, total, err := db.GetAuthorPosts(req.Context(), currentDB(req), name, offset, limit)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting author posts"))
+		return
+	}
 
-	const DefaultAddr = ":8080"
-	log(funcname, "server up, listening at :8080")
-	err := http.ListenAndServe(DefaultAddr, nil)
+	log(req.Context(), funcname, "Got", len(posts), "of", total, "posts by", name)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetAuthorPostsResponse{AuthorName: name, Offset: offset, Limit: limit, Total: total, Posts: posts}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func getAuthorCommentsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getAuthorCommentsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(req)
+	name := vars["name"]
+	offset, limit, err := parsePagination(req)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	comments, total, err := db.GetAuthorComments(req.Context(), currentDB(req), name, offset, limit)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting author comments"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(comments), "of", total, "comments by", name)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetAuthorCommentsResponse{AuthorName: name, Offset: offset, Limit: limit, Total: total, Comments: comments}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+//logged in users can only see their own notifications
+func getNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "getNotificationsHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	//notifications are for whoever is logged in, or the API key or bearer token subject, never just whoever goes by a name
+	a := currentActor(req)
+	if a.ID == "" {
+		err := fmt.Errorf("Log in to see notifications")
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusUnauthorized, err)
+		return
+	}
+	recipient := a.Name
+	if requested := req.URL.Query().Get("recipient"); requested != "" && requested != recipient {
+		err := fmt.Errorf("Cannot see notifications for %s", requested)
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusForbidden, err)
+		return
+	}
+
+	notifications, err := db.GetNotifications(req.Context(), currentDB(req), a.ID)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error getting notifications"))
+		return
+	}
+
+	log(req.Context(), funcname, "Got", len(notifications), "notifications for", recipient)
+	w.WriteHeader(http.StatusOK)
+	resp, err := marshalResponse(w, Response{Data: GetNotificationsResponse{Recipient: recipient, Notifications: notifications}})
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+	} else {
+		w.Write(resp)
+	}
+}
+
+func main() {
+	const funcname = "main"
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
 	if err != nil {
 		panic(err)
 	}
+	logger.SetLevel(cfg.LogLevel)
+	server, err := NewServer(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	server.Go(func(stop <-chan struct{}) {
+		server.runRateLimitEvictor(time.Minute, stop)
+	})
+	server.Go(server.runNotificationDispatcher)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err = <-serveErr:
+		panic(err)
+	case sig := <-signals:
+		log(context.Background(), funcname, "Received", sig, "draining for up to", cfg.ShutdownTimeout.Duration)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logError(context.Background(), funcname, err)
+		os.Exit(1)
+	}
+	log(context.Background(), funcname, "Shut down cleanly")
 }
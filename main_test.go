@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aschereT/ea-gaming-review/config"
 	"github.com/aschereT/ea-gaming-review/db"
 	"github.com/gorilla/mux"
 )
@@ -17,6 +21,7 @@ type expectedResponseCreateBlogPostOrComment struct {
 		ID string `json:"ID"`
 	} `json:"Data"`
 	Error string `json:"Error"`
+	Code  string `json:"Code"`
 }
 
 type expectedResponseIDs struct {
@@ -38,11 +43,18 @@ type expectedResponseGetPost struct {
 
 type expectedResponseGetComment struct {
 	Data struct {
-		ID          string `json:"ID"`
-		ArticleID   string `json:"ArticleID"`
-		CommentText string `json:"CommentText"`
-		AuthorName  string `json:"AuthorName"`
+		ID            string     `json:"ID"`
+		ArticleID     string     `json:"ArticleID"`
+		CommentText   string     `json:"CommentText" validate:"required,max=5000,multiline"`
+		AuthorName    string     `json:"AuthorName" validate:"max=100"`
+		CreatedAt     time.Time  `json:"CreatedAt"`
+		EditedAt      *time.Time `json:"EditedAt,omitempty"`
+		Hidden        bool       `json:"Hidden,omitempty"`
+		PendingEmail  string     `json:"-"`
+		OwnerID       string     `json:"-"`
+		EditTokenHash string     `json:"-"`
 	} `json:"Data"`
+	Error string `json:"Error"`
 }
 
 func Test_HealthCheck(t *testing.T) {
@@ -79,6 +91,7 @@ func Test_RespondWithError(t *testing.T) {
 	expectedStatusCode := http.StatusTeapot
 	expectedError := fmt.Errorf("error detected, self-terminating")
 	respondWithErrorHandler := func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(requestIDHeader, "self-destruct-sequence")
 		respondWithError(w, expectedStatusCode, expectedError)
 	}
 
@@ -97,7 +110,7 @@ func Test_RespondWithError(t *testing.T) {
 		t.Errorf("Expected Content-Type to be application/json, got %s", contentType)
 	}
 
-	expectedBody := "{\"Error\":\"error detected, self-terminating\"}"
+	expectedBody := "{\"Error\":\"error detected, self-terminating\",\"Code\":\"error\",\"RequestID\":\"self-destruct-sequence\"}"
 	actualBody := rec.Body.String()
 
 	if actualBody != expectedBody {
@@ -407,7 +420,16 @@ func Test_GetSingleBlogPost(t *testing.T) {
 	actual = rec.Result()
 	returnedBody := rec.Body.String()
 
-	expectedBody := "{\"Data\":{\"ID\":\"" + id + "\",\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}}"
+	storedPost, err := db.GetBlogPost(context.Background(), inMemDB, id)
+	if err != nil {
+		t.Error(err)
+	}
+	createdAt, err := json.Marshal(storedPost.CreatedAt)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectedBody := "{\"Data\":{\"ID\":\"" + id + "\",\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\",\"CreatedAt\":" + string(createdAt) + "}}"
 
 	if returnedBody != expectedBody {
 		t.Errorf("Expected actual body to match expected body, but differs: \nexpected: %s\nactual:   %s", expectedBody, returnedBody)
@@ -421,14 +443,16 @@ func Test_DeleteBlogPost(t *testing.T) {
 		inMemDB = nil
 	}()
 
-	//add a post
-	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}"))
+	//add a post, while logged in
+	authorCookie := loginAs(t, "Dr. Eggman")
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\"}"))
 	if err != nil {
 		t.Error(err)
 	}
+	req.AddCookie(authorCookie)
 
 	rec := httptest.NewRecorder()
-	handler := http.HandlerFunc(createBlogPostHandler)
+	handler := sessionMiddleware(http.HandlerFunc(createBlogPostHandler))
 	handler.ServeHTTP(rec, req)
 	actual := rec.Result()
 
@@ -444,8 +468,9 @@ func Test_DeleteBlogPost(t *testing.T) {
 
 	id := actualResponse.Data.ID
 
-	//try to delete it
+	//try to delete it, as the post's author
 	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
 	r.HandleFunc("/blog/{id}", deleteBlogPostHandler)
 
 	ts := httptest.NewServer(r)
@@ -455,6 +480,7 @@ func Test_DeleteBlogPost(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
+	req.AddCookie(authorCookie)
 
 	rec = httptest.NewRecorder()
 	r.ServeHTTP(rec, req)
@@ -506,7 +532,7 @@ func Test_DeleteBlogPost_DoesntExist(t *testing.T) {
 	r.ServeHTTP(rec, req)
 
 	returnedBody := rec.Body.String()
-	expectedBody := "{\"Error\":\"No post found with ID " + id + "\"}"
+	expectedBody := "{\"Error\":\"No post found with ID " + id + "\",\"Code\":\"post_not_found\",\"Details\":{\"ID\":\"" + id + "\"}}"
 
 	if returnedBody != expectedBody {
 		t.Errorf("Expected actual body to match expected body, but differs: \nexpected: %s\nactual:   %s", expectedBody, returnedBody)
@@ -790,6 +816,53 @@ func Test_CreateBlogComment_AddedArticleID(t *testing.T) {
 	}
 }
 
+func Test_CreateBlogComment_AddedModerationFields(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/blog/{id}/comment", createBlogCommentHandler)
+
+	cases := []struct {
+		field, body string
+	}{
+		{"EditedAt", "{\"AuthorName\": \"Anony Mouse\",\"CommentText\": \"this review sucks\",\"EditedAt\":\"2019-01-01T00:00:00Z\"}"},
+		{"Hidden", "{\"AuthorName\": \"Anony Mouse\",\"CommentText\": \"this review sucks\",\"Hidden\":true}"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog/"+id+"/comment", strings.NewReader(c.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", c.field, http.StatusBadRequest, rec.Code)
+		}
+
+		var actualResponse expectedResponseCreateBlogPostOrComment
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+
+		expectedError := c.field + " should not be defined in new post requests"
+		if actualResponse.Error != expectedError {
+			t.Errorf("Expected error to be %s, got %s", expectedError, actualResponse.Error)
+		}
+	}
+}
+
 func Test_CreateBlogComment_MissingAuthorName(t *testing.T) {
 	//set up in-mem db, and tear down after
 	inMemDB = setupDB()
@@ -1035,11 +1108,715 @@ func Test_GetBlogComment(t *testing.T) {
 		t.Error(err)
 	}
 
-	expectedComment := db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "this review sucks", ID: commentID}
+	storedComment, err := db.GetBlogComment(context.Background(), inMemDB, id, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectedComment := db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "this review sucks", ID: commentID, CreatedAt: storedComment.CreatedAt}
 
 	if actualResponse.Data != expectedComment {
 		t.Errorf("Expected response to be %#v, got %#v", expectedComment, actualResponse)
 	}
+
+	//the comment isn't on another post
+	otherID, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "Sonic Adventure", ArticleText: "gotta go fast", AuthorName: "Sonic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/blog/"+otherID+"/comment/"+commentID, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	var notFoundResponse Response
+	err = json.Unmarshal(rec.Body.Bytes(), &notFoundResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if rec.Code != http.StatusNotFound || notFoundResponse.Code != "comment_not_found" {
+		t.Errorf("Expected status code %d and comment_not_found getting the comment through another post, got %d, %#v", http.StatusNotFound, rec.Code, notFoundResponse)
+	}
+}
+
+func Test_DeleteBlogComment(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	authorCookie := loginAs(t, "Dr. Eggman")
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman", OwnerID: ownerIDOf(t, "Dr. Eggman")})
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "this review sucks"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.HandleFunc("/blog/{id}/comment/{commentID}", deleteBlogCommentHandler)
+
+	cases := []struct {
+		cookie             *http.Cookie
+		expectedStatusCode int
+	}{
+		{nil, http.StatusUnauthorized},
+		{loginAs(t, "Sonic"), http.StatusForbidden},
+		{authorCookie, http.StatusOK},
+		{loginAs(t, "Dr. Eggman 2"), http.StatusNotFound},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodDelete, "/blog/"+id+"/comment/"+commentID, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if c.cookie != nil {
+			req.AddCookie(c.cookie)
+		}
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d, got %d", c.expectedStatusCode, rec.Code)
+		}
+	}
+
+	comment, err := db.GetBlogComment(context.Background(), inMemDB, id, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+	if comment != nil {
+		t.Errorf("Expected comment to be deleted, got %#v", *comment)
+	}
+}
+
+func Test_CreateBlogComment_Locked(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	authorCookie := loginAs(t, "Dr. Eggman")
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman", OwnerID: ownerIDOf(t, "Dr. Eggman")})
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.HandleFunc("/blog/{id}/commentstate", setCommentStateHandler)
+	r.HandleFunc("/blog/{id}/comment", createBlogCommentHandler)
+
+	//lock the comments, as the post's author
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPut, "/blog/"+id+"/commentstate", strings.NewReader("{\"CommentState\":\"locked\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(authorCookie)
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	//try to comment on the post
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/blog/"+id+"/comment", strings.NewReader("{\"AuthorName\": \"Anony Mouse\",\"CommentText\": \"this review sucks\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusLocked {
+		t.Errorf("Expected status code %d, got %d", http.StatusLocked, rec.Code)
+	}
+
+	var actualResponse expectedResponseCreateBlogPostOrComment
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectedError := "Comments are locked on post " + id
+	if actualResponse.Error != expectedError {
+		t.Errorf("Expected error to be %s, got %s", expectedError, actualResponse.Error)
+	}
+	if actualResponse.Code != "comments_locked" {
+		t.Errorf("Expected code to be comments_locked, got %s", actualResponse.Code)
+	}
+}
+
+func Test_CreateBlogComment_AutoClosed(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cfg := testConfig()
+	cfg.Comments.CloseAfter = config.Duration{Duration: time.Nanosecond}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the handlers use the server's store once it is serving them
+	inMemDB = server.DB
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/blog/{id}/comment", createBlogCommentHandler)
+	handler := servedBy(server, r)
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog/"+id+"/comment", strings.NewReader("{\"AuthorName\": \"Anony Mouse\",\"CommentText\": \"this review sucks\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	var actualResponse expectedResponseCreateBlogPostOrComment
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectedError := "Comments are closed on post " + id
+	if actualResponse.Error != expectedError {
+		t.Errorf("Expected error to be %s, got %s", expectedError, actualResponse.Error)
+	}
+	if actualResponse.Code != "comments_closed" {
+		t.Errorf("Expected code to be comments_closed, got %s", actualResponse.Code)
+	}
+}
+
+func Test_EditBlogComment(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	authorCookie := loginAs(t, "Dr. Eggman")
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman", OwnerID: ownerIDOf(t, "Dr. Eggman")})
+	if err != nil {
+		t.Error(err)
+	}
+	comment := db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "this reveiw sucks"}
+	editToken, err := comment.NewEditToken()
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, comment, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.HandleFunc("/blog/{id}/comment/{commentID}", editBlogCommentHandler)
+	r.HandleFunc("/blog/{id}/comment/{commentID}/history", getCommentRevisionsHandler)
+
+	//someone else tries to edit it, claiming the name, logged in as someone else or guessing the token
+	for _, attempt := range []struct {
+		body   string
+		login  string
+		status int
+	}{
+		{"{\"CommentText\": \"this review rocks\"}", "", http.StatusUnauthorized},
+		{"{\"CommentText\": \"this review rocks\"}", "Anony Mouse", http.StatusForbidden},
+		{"{\"EditToken\": \"guess\",\"CommentText\": \"this review rocks\"}", "", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPatch, "/blog/"+id+"/comment/"+commentID, strings.NewReader(attempt.body))
+		if err != nil {
+			t.Error(err)
+		}
+		if attempt.login != "" {
+			req.AddCookie(loginAs(t, attempt.login))
+		}
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != attempt.status {
+			t.Errorf("Expected status code %d, got %d", attempt.status, rec.Code)
+		}
+	}
+
+	//the author fixes their typo
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPatch, "/blog/"+id+"/comment/"+commentID, strings.NewReader("{\"EditToken\": \""+editToken+"\",\"CommentText\": \"this review sucks\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var actualResponse expectedResponseGetComment
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if actualResponse.Data.CommentText != "this review sucks" {
+		t.Errorf("Expected comment text to be this review sucks, got %s", actualResponse.Data.CommentText)
+	}
+	if actualResponse.Data.EditedAt == nil {
+		t.Error("Expected comment to be marked as edited, got nil")
+	}
+
+	//readers can't see what it used to say
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/blog/"+id+"/comment/"+commentID+"/history", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	//but the post's author can
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/blog/"+id+"/comment/"+commentID+"/history", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(authorCookie)
+
+	r.ServeHTTP(rec, req)
+
+	var historyResponse struct {
+		Data GetCommentRevisionsResponse `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &historyResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(historyResponse.Data.Revisions) != 1 || historyResponse.Data.Revisions[0].CommentText != "this reveiw sucks" {
+		t.Errorf("Expected a single revision with the original text, got %#v", historyResponse.Data.Revisions)
+	}
 }
 
-//TODO: Test deleteBlogCommentHandler
\ No newline at end of file
+func Test_EditBlogComment_WindowExpired(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cfg := testConfig()
+	cfg.Comments.EditWindow = config.Duration{}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the handlers use the server's store once it is serving them
+	inMemDB = server.DB
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	comment := db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "this reveiw sucks"}
+	editToken, err := comment.NewEditToken()
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, comment, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/blog/{id}/comment/{commentID}", editBlogCommentHandler)
+	handler := servedBy(server, r)
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPatch, "/blog/"+id+"/comment/"+commentID, strings.NewReader("{\"EditToken\": \""+editToken+"\",\"CommentText\": \"this review sucks\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	stored, err := db.GetBlogComment(context.Background(), inMemDB, id, commentID)
+	if err != nil {
+		t.Error(err)
+	}
+	if stored.CommentText != "this reveiw sucks" || stored.EditedAt != nil {
+		t.Errorf("Expected comment to be left untouched, got %#v", *stored)
+	}
+}
+
+func Test_GetNotifications(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	sessionCookie := loginAs(t, "Dr. Eggman")
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman", OwnerID: ownerIDOf(t, "Dr. Eggman")})
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "Anony Mouse", CommentText: "@Dr. Eggman this review sucks"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = db.RegisterAPIKey(context.Background(), inMemDB, db.SystemActor, "Dr. Eggman", "eak_eggman", []string{db.ScopeRead}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := sessionMiddleware(apiKeyMiddleware(http.HandlerFunc(getNotificationsHandler)))
+
+	//have to log in
+	req, err := http.NewRequest(http.MethodGet, "/notifications", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "/notifications", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(sessionCookie)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var actualResponse struct {
+		Data GetNotificationsResponse `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+
+	notifications := actualResponse.Data.Notifications
+	if len(notifications) != 1 || notifications[0].CommentID != commentID || notifications[0].ActorName != "Anony Mouse" {
+		t.Errorf("Expected a single mention from Anony Mouse, got %#v", notifications)
+	}
+
+	//an API key going by the same name is a different identity, so it doesn't get the user's mentions
+	req, err = http.NewRequest(http.MethodGet, "/notifications", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set(apiKeyHeader, "eak_eggman")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), commentID) {
+		t.Errorf("Expected status code %d without the mention, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	//can't snoop on someone else's
+	req, err = http.NewRequest(http.MethodGet, "/notifications?recipient="+url.QueryEscape("Anony Mouse"), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(sessionCookie)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status code %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func Test_FlagBlogComment(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cfg := testConfig()
+	cfg.Comments.FlagHideThreshold = 2
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the handlers use the server's store once it is serving them
+	inMemDB = server.DB
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "spammer", CommentText: "Learn how to get hired with this one weird trick!"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.HandleFunc("/blog/{id}/comment/{commentID}", getSingleBlogCommentHandler).Methods(http.MethodGet)
+	r.HandleFunc("/blog/{id}/comment/{commentID}/flag", flagBlogCommentHandler).Methods(http.MethodPost)
+	r.HandleFunc("/moderation/flagged", getFlaggedCommentsHandler).Methods(http.MethodGet)
+	handler := servedBy(server, r)
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog/"+id+"/comment/"+commentID+"/flag", strings.NewReader("{\"Reason\": \"boring\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	//the same anonymous reader flagging twice only counts once, whatever name they give
+	flags := []struct {
+		remoteAddr   string
+		login        string
+		status       int
+		expectedBody string
+	}{
+		{"192.0.2.1:1234", "", http.StatusOK, "{\"Data\":{\"Hidden\":false}}"},
+		{"192.0.2.1:5678", "", http.StatusOK, "{\"Data\":{\"Hidden\":false}}"},
+		{"192.0.2.1:1234", "Sonic", http.StatusOK, "{\"Data\":{\"Hidden\":true}}"},
+		//hidden comments can't be flagged any more
+		{"192.0.2.2:1234", "", http.StatusNotFound, ""},
+	}
+	for _, flag := range flags {
+		rec = httptest.NewRecorder()
+		req, err = http.NewRequest(http.MethodPost, "/blog/"+id+"/comment/"+commentID+"/flag", strings.NewReader("{\"Reason\": \"spam\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		req.RemoteAddr = flag.remoteAddr
+		if flag.login != "" {
+			req.AddCookie(loginAs(t, flag.login))
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != flag.status {
+			t.Errorf("Expected status code %d, got %d", flag.status, rec.Code)
+		}
+		if flag.expectedBody != "" && rec.Body.String() != flag.expectedBody {
+			t.Errorf("Expected body to be %s, got %s", flag.expectedBody, rec.Body.String())
+		}
+	}
+
+	//readers can't see it anymore
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/blog/"+id+"/comment/"+commentID, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	//but moderators can
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/moderation/flagged", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	req.AddCookie(loginWithRole(t, "Moderator", db.RoleEditor))
+
+	handler.ServeHTTP(rec, req)
+
+	var flaggedResponse struct {
+		Data GetFlaggedCommentsResponse `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &flaggedResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	flagged := flaggedResponse.Data.Comments
+	if len(flagged) != 1 || flagged[0].Comment.ID != commentID || flagged[0].FlagCount != 2 {
+		t.Errorf("Expected the spam comment with 2 flags, got %#v", flagged)
+	}
+}
+
+func Test_GetAuthor(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "Dr. Eggman", CommentText: "first!"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/authors", getAuthorsHandler)
+	r.HandleFunc("/authors/{name}", getAuthorHandler)
+	r.HandleFunc("/authors/{name}/posts", getAuthorPostsHandler)
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/authors", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	expectedBody := "{\"Data\":{\"AuthorNames\":[\"Dr. Eggman\"]}}"
+	if rec.Body.String() != expectedBody {
+		t.Errorf("Expected body to be %s, got %s", expectedBody, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/authors/Dr.%20Eggman", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var statsResponse struct {
+		Data db.AuthorStats `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &statsResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if statsResponse.Data.PostCount != 1 || statsResponse.Data.CommentCount != 1 {
+		t.Errorf("Expected 1 post and 1 comment, got %#v", statsResponse.Data)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/authors/Knuckles", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/authors/Dr.%20Eggman/posts?limit=1000", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/authors/Dr.%20Eggman/posts?offset=0&limit=10", nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	r.ServeHTTP(rec, req)
+
+	var postsResponse struct {
+		Data GetAuthorPostsResponse `json:"Data"`
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &postsResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	if postsResponse.Data.Total != 1 || len(postsResponse.Data.Posts) != 1 || postsResponse.Data.Posts[0].ID != id {
+		t.Errorf("Expected post %s, got %#v", id, postsResponse.Data)
+	}
+}
+
+//keeps delivered notifications in memory
+type recordingDeliverer struct {
+	delivered []db.Notification
+}
+
+func (d *recordingDeliverer) Deliver(notification db.Notification) error {
+	d.delivered = append(d.delivered, notification)
+	return nil
+}
+
+func Test_RunNotificationDispatcher_FlushesOnStop(t *testing.T) {
+	cfg := testConfig()
+	//the interval is never reached, so only the final drain delivers anything
+	cfg.Notifications.Interval = config.Duration{Duration: time.Hour}
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverer := &recordingDeliverer{}
+	server.deliverer = deliverer
+	store := server.DB
+	id, err := db.CreateBlogPost(context.Background(), store, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman", OwnerID: "user:eggman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateBlogComment(context.Background(), store, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "Sonic", CommentText: "@Dr. Eggman you're too slow"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	server.runNotificationDispatcher(stop)
+	if len(deliverer.delivered) != 1 || deliverer.delivered[0].Recipient != "Dr. Eggman" {
+		t.Errorf("Expected the pending mention to be delivered on stop, got %#v", deliverer.delivered)
+	}
+}
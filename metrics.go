@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//requests that don't match any route are counted under this route
+const unmatchedRoute = "unmatched"
+
+//requests with any other method are counted under this method, so clients can't add label values at will
+const otherMethod = "OTHER"
+
+//methods counted under their own name
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+//observeDBTxn counts and times a transaction on s's store
+func (s *Server) observeDBTxn(write, committed bool, took time.Duration) {
+	mode := "read"
+	if write {
+		mode = "write"
+		if !committed {
+			s.dbAbortedTxns.Inc()
+		}
+	}
+	s.dbTxns.WithLabelValues(mode).Inc()
+	s.dbTxnDuration.WithLabelValues(mode).Observe(took.Seconds())
+}
+
+var (
+	blogPostsDesc    = prometheus.NewDesc("blog_posts", "Blog posts stored.", nil, nil)
+	blogCommentsDesc = prometheus.NewDesc("blog_comments", "Blog comments stored, including hidden ones.", nil, nil)
+)
+
+//blogCollector counts the posts and comments in a store each time metrics are gathered
+type blogCollector struct {
+	db *db.DB
+}
+
+func (c blogCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- blogPostsDesc
+	descs <- blogCommentsDesc
+}
+
+func (c blogCollector) Collect(metrics chan<- prometheus.Metric) {
+	posts, comments, err := db.CountBlogPostsAndComments(context.Background(), c.db)
+	if err != nil {
+		metrics <- prometheus.NewInvalidMetric(blogPostsDesc, err)
+		metrics <- prometheus.NewInvalidMetric(blogCommentsDesc, err)
+		return
+	}
+	metrics <- prometheus.MustNewConstMetric(blogPostsDesc, prometheus.GaugeValue, float64(posts))
+	metrics <- prometheus.MustNewConstMetric(blogCommentsDesc, prometheus.GaugeValue, float64(comments))
+}
+
+//setupMetrics registers the metrics s exposes at /metrics
+func (s *Server) setupMetrics() {
+	s.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	s.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "How long HTTP requests took to serve, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	s.dbTxns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "memdb_transactions_total",
+		Help: "memdb transactions, by whether they could write.",
+	}, []string{"mode"})
+	s.dbAbortedTxns = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "memdb_write_transactions_aborted_total",
+		Help: "memdb write transactions that were aborted instead of committed.",
+	})
+	s.dbTxnDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "memdb_transaction_duration_seconds",
+		Help:    "How long memdb transactions were open, by whether they could write.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"mode"})
+
+	s.Metrics = prometheus.NewRegistry()
+	s.Metrics.MustRegister(s.requests, s.requestDuration, blogCollector{db: s.DB}, s.dbTxns, s.dbAbortedTxns, s.dbTxnDuration)
+	s.DB.TxnObserver = s.observeDBTxn
+	//compressResponse already compresses big responses
+	s.metricsHandler = promhttp.HandlerFor(s.Metrics, promhttp.HandlerOpts{ErrorLog: metricsErrorLog{}, DisableCompression: true})
+}
+
+//methodLabel is the method req is counted under
+func methodLabel(req *http.Request) string {
+	if knownMethods[req.Method] {
+		return req.Method
+	}
+	return otherMethod
+}
+
+//routeTemplate is the path template of the route router would send req to, like /blog/{id}, so metrics aren't split by IDs
+func routeTemplate(router *mux.Router, req *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(req, &match) || match.Route == nil {
+		return unmatchedRoute
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
+
+//instrument counts and times every request by its method, route template and status
+func (s *Server) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		route := routeTemplate(s.Router, req)
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, req)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": methodLabel(req), "route": route, "status": strconv.Itoa(recorder.status)}
+		s.requests.With(labels).Inc()
+		s.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+//metricsErrorLog logs the errors promhttp runs into while gathering metrics
+type metricsErrorLog struct{}
+
+func (metricsErrorLog) Println(a ...interface{}) {
+	logError(context.Background(), "metricsHandler", errors.New(strings.TrimSuffix(fmt.Sprintln(a...), "\n")))
+}
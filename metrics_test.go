@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Metrics(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/blog", "{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}"},
+		{http.MethodGet, "/blog/missing", ""},
+		{http.MethodGet, "/blog/also-missing", ""},
+		{http.MethodPut, "/blog", ""},
+		{http.MethodGet, "/nowhere", ""},
+		//made up methods are all counted as OTHER
+		{"PURGE", "/blog", ""},
+		{"X-MADE-UP", "/blog", ""},
+	}
+	for _, r := range requests {
+		req, err := http.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		if err != nil {
+			t.Error(err)
+		}
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %s", contentType)
+	}
+
+	body := rec.Body.String()
+	for _, expected := range []string{
+		"http_requests_total{method=\"POST\",route=\"/blog\",status=\"200\"} 1\n",
+		"http_requests_total{method=\"GET\",route=\"/blog/{id}\",status=\"404\"} 2\n",
+		"http_requests_total{method=\"PUT\",route=\"unmatched\",status=\"405\"} 1\n",
+		"http_requests_total{method=\"GET\",route=\"unmatched\",status=\"404\"} 1\n",
+		"http_requests_total{method=\"OTHER\",route=\"unmatched\",status=\"405\"} 2\n",
+		"http_request_duration_seconds_count{method=\"GET\",route=\"/blog/{id}\",status=\"404\"} 2\n",
+		"blog_posts 1\n",
+		"blog_comments 0\n",
+		"memdb_transactions_total{mode=\"write\"}",
+		"memdb_transaction_duration_seconds_bucket{mode=\"read\",le=\"+Inf\"}",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got\n%s", expected, body)
+		}
+	}
+}
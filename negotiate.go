@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aschereT/ea-gaming-review/codec"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/mux"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+//Media types requests and responses can be in besides JSON. Handlers read request bodies as JSON, which the others are converted to,
+//and responses are encoded in the negotiated format straight from the handler's Response
+const (
+	mediaTypeJSON    = "application/json"
+	mediaTypeXML     = "application/xml"
+	mediaTypeMsgpack = "application/msgpack"
+	mediaTypeCBOR    = "application/cbor"
+)
+
+//request bodies nested deeper than this are rejected
+const maxBodyDepth = 100
+
+//format is a media type the API speaks
+type format struct {
+	mediaType string
+	//what responses in it are sent as
+	contentType string
+	//other names clients use for it
+	aliases []string
+	//binary formats aren't text, their decoders check the strings in them are valid UTF-8 instead
+	binary bool
+	//marshal encodes a Response
+	marshal func(value interface{}) ([]byte, error)
+	//toJSON converts a request body to JSON for the handlers. XML bodies are converted by xmlToJSON instead, which needs the route's schema
+	toJSON func(data []byte) ([]byte, error)
+}
+
+//in the order they are preferred when a client accepts several equally
+var formats = []*format{
+	{mediaType: mediaTypeJSON, contentType: mediaTypeJSON, aliases: []string{"text/json"}, marshal: json.Marshal},
+	{mediaType: mediaTypeXML, contentType: mediaTypeXML + "; charset=utf-8", aliases: []string{"text/xml"}, marshal: marshalXML},
+	{mediaType: mediaTypeMsgpack, contentType: mediaTypeMsgpack, aliases: []string{"application/x-msgpack", "application/vnd.msgpack"}, binary: true, marshal: marshalMsgpack, toJSON: msgpackToJSON},
+	{mediaType: mediaTypeCBOR, contentType: mediaTypeCBOR, binary: true, marshal: cborEncoding.Marshal, toJSON: cborToJSON},
+}
+
+//marshalXML writes value through its JSON form, since encoding/xml can't write the maps and interface values in responses
+func marshalXML(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := codec.ParseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.MarshalXML(tree, "Response")
+}
+
+//xmlToJSON gives the text read from XML the types schema says it should have
+func xmlToJSON(data []byte, schema *openAPISchema) ([]byte, error) {
+	value, err := codec.UnmarshalXML(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.MarshalJSON(coerceToSchema(value, schema))
+}
+
+//CBOR and MessagePack use the json tags, so every format has the same field names. Times are written as their native timestamps
+var cborEncoding, cborDecoding = func() (cbor.EncMode, cbor.DecMode) {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano, TimeTag: cbor.EncTagRequired, JSONMarshalerTranscoder: jsonTranscoder{}}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{MaxNestedLevels: maxBodyDepth, DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return enc, dec
+}()
+
+//json.RawMessage values are written to MessagePack as the value they hold too
+func init() {
+	msgpack.Register(json.RawMessage(nil), func(e *msgpack.Encoder, v reflect.Value) error {
+		if v.Len() == 0 {
+			return e.EncodeNil()
+		}
+		value, err := decodeJSON(v.Bytes())
+		if err != nil {
+			return err
+		}
+		return e.Encode(value)
+	}, nil)
+}
+
+//jsonTranscoder writes json.RawMessage values, like audit log snapshots, as the value they hold rather than as a byte string
+type jsonTranscoder struct{}
+
+func (jsonTranscoder) Transcode(w io.Writer, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	value, err := decodeJSON(data)
+	if err != nil {
+		return err
+	}
+	encoded, err := cbor.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encoded)
+	return err
+}
+
+//decodeJSON reads a JSON value, keeping whole numbers as integers for the formats that tell them apart from floats
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return withNumbers(value), nil
+}
+
+func withNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		for i := range value {
+			value[i] = withNumbers(value[i])
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = withNumbers(value[key])
+		}
+	}
+	return value
+}
+
+func marshalMsgpack(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	err := enc.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackToJSON(data []byte) ([]byte, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	value, err := decodeMsgpack(dec, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.PeekCode(); err != io.EOF {
+		return nil, errors.New("Unexpected data after the MessagePack value")
+	}
+	return json.Marshal(value)
+}
+
+//decodeMsgpack decodes the next value like Decoder.DecodeInterface, but with string keyed maps, nesting limited to maxBodyDepth,
+//and strings checked to be valid UTF-8, which json.Marshal would quietly replace
+func decodeMsgpack(dec *msgpack.Decoder, depth int) (interface{}, error) {
+	if depth > maxBodyDepth {
+		return nil, fmt.Errorf("Can't be nested more than %d deep", maxBodyDepth)
+	}
+	code, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		length, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		items := []interface{}{}
+		for i := 0; i < length; i++ {
+			item, err := decodeMsgpack(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case msgpcode.IsFixedMap(code) || code == msgpcode.Map16 || code == msgpcode.Map32:
+		length, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		members := map[string]interface{}{}
+		for i := 0; i < length; i++ {
+			key, err := dec.DecodeString()
+			if err != nil {
+				return nil, err
+			}
+			if !utf8.ValidString(key) {
+				return nil, errors.New("Strings should be valid UTF-8")
+			}
+			members[key], err = decodeMsgpack(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return members, nil
+	}
+	value, err := dec.DecodeInterface()
+	if str, ok := value.(string); ok && !utf8.ValidString(str) {
+		return nil, errors.New("Strings should be valid UTF-8")
+	}
+	return value, err
+}
+
+func cborToJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	err := cborDecoding.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func supportedMediaTypes() []string {
+	mediaTypes := make([]string, len(formats))
+	for i, f := range formats {
+		mediaTypes[i] = f.mediaType
+	}
+	return mediaTypes
+}
+
+func (f *format) is(mediaType string) bool {
+	if mediaType == f.mediaType {
+		return true
+	}
+	for _, alias := range f.aliases {
+		if mediaType == alias {
+			return true
+		}
+	}
+	return false
+}
+
+//negotiateFormat picks the format a client wants from its Accept header, ok is false if it accepts none of them
+func negotiateFormat(accept string) (f *format, ok bool) {
+	if strings.TrimSpace(accept) == "" {
+		return formats[0], true
+	}
+
+	bestQ := 0.0
+	for _, candidate := range formats {
+		//the most specific range that matches decides the quality
+		specificity, q := -1, 0.0
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+			rangeQ := 1.0
+			if qParam, ok := params["q"]; ok {
+				rangeQ, err = strconv.ParseFloat(qParam, 64)
+				if err != nil || rangeQ < 0 || rangeQ > 1 {
+					continue
+				}
+			}
+			rangeSpecificity := -1
+			switch {
+			case candidate.is(mediaType):
+				rangeSpecificity = 2
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(candidate.mediaType, strings.TrimSuffix(mediaType, "*")):
+				rangeSpecificity = 1
+			case mediaType == "*/*":
+				rangeSpecificity = 0
+			}
+			if rangeSpecificity > specificity {
+				specificity, q = rangeSpecificity, rangeQ
+			}
+		}
+		if q > bestQ {
+			f, bestQ = candidate, q
+		}
+	}
+	return f, f != nil
+}
+
+//formatOf is the format of a request body with contentType. Bodies without one are taken to be JSON
+func formatOf(contentType string) (f *format, ok bool) {
+	if strings.TrimSpace(contentType) == "" {
+		return formats[0], true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	for _, f := range formats {
+		if f.is(mediaType) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+//routes that answer with a Response envelope, as opposed to text or HTML, by method and path template
+var envelopeRoutes = func() map[string]bool {
+	routes := map[string]bool{}
+	for _, route := range routeDocs {
+		if route.ContentType == "" {
+			routes[route.Method+" "+route.Path] = true
+		}
+	}
+	return routes
+}()
+
+func routeKey(req *http.Request) string {
+	route := mux.CurrentRoute(req)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return req.Method + " " + template
+}
+
+//bufferedResponse holds on to a response so it can be looked at before being sent
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+//negotiatedWriter is what handlers write to when the client asked for a format other than JSON.
+//marshalResponse encodes in its format, and the JSON Content-Type handlers set is swapped for the format's
+type negotiatedWriter struct {
+	http.ResponseWriter
+	format      *format
+	wroteHeader bool
+}
+
+func (n *negotiatedWriter) WriteHeader(status int) {
+	if !n.wroteHeader && strings.HasPrefix(n.Header().Get("Content-Type"), mediaTypeJSON) {
+		n.Header().Set("Content-Type", n.format.contentType)
+	}
+	n.wroteHeader = true
+	n.ResponseWriter.WriteHeader(status)
+}
+
+func (n *negotiatedWriter) Write(data []byte) (int, error) {
+	if !n.wroteHeader {
+		n.WriteHeader(http.StatusOK)
+	}
+	return n.ResponseWriter.Write(data)
+}
+
+//marshalResponse encodes response in the format negotiated for w, JSON unless negotiateResponse picked another
+func marshalResponse(w http.ResponseWriter, response Response) ([]byte, error) {
+	if negotiated, ok := w.(*negotiatedWriter); ok {
+		return negotiated.format.marshal(response)
+	}
+	return json.Marshal(response)
+}
+
+//negotiateResponse has Response envelopes sent in the format the Accept header asks for, answering 406 if none of them can be
+func negotiateResponse(next http.Handler) http.Handler {
+	const funcname = "negotiateResponse"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !envelopeRoutes[routeKey(req)] {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		f, ok := negotiateFormat(req.Header.Get("Accept"))
+		if !ok {
+			err := &apiError{
+				message: fmt.Sprintf("Can only respond with %s", strings.Join(supportedMediaTypes(), ", ")),
+				details: map[string]interface{}{"Supported": supportedMediaTypes()},
+			}
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusNotAcceptable, err)
+			return
+		}
+		if f.mediaType == mediaTypeJSON {
+			next.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(&negotiatedWriter{ResponseWriter: w, format: f}, req)
+	})
+}
+
+//decodeRequestBody converts request bodies in any of the formats to JSON for the handlers, answering 415 for other formats
+func decodeRequestBody(next http.Handler) http.Handler {
+	const funcname = "decodeRequestBody"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Body == nil || req.Body == http.NoBody {
+			next.ServeHTTP(w, req)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("Error reading request body"))
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if len(body) == 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		f, ok := formatOf(req.Header.Get("Content-Type"))
+		if !ok {
+			err := &apiError{
+				message: fmt.Sprintf("Request bodies should be one of %s", strings.Join(supportedMediaTypes(), ", ")),
+				details: map[string]interface{}{"Supported": supportedMediaTypes()},
+			}
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		if f.mediaType == mediaTypeJSON {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		var schema *openAPISchema
+		if op, ok := openAPIOperations[routeKey(req)]; ok && op.RequestBody != nil {
+			schema = op.RequestBody.Content[mediaTypeJSON].Schema
+		}
+		if f.mediaType == mediaTypeXML {
+			body, err = xmlToJSON(body, schema)
+		} else {
+			body, err = f.toJSON(body)
+		}
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusBadRequest, invalidBodyError(f.mediaType, err))
+			return
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", mediaTypeJSON)
+		next.ServeHTTP(w, req)
+	})
+}
+
+//coerceToSchema gives values read from XML, where everything is text, the types schema says they should be
+func coerceToSchema(value interface{}, schema *openAPISchema) interface{} {
+	if schema == nil {
+		return value
+	}
+	schema = resolveSchema(schema)
+	text, isText := value.(string)
+
+	switch schema.Type {
+	case "array":
+		var items []interface{}
+		switch value := value.(type) {
+		case codec.Object:
+			item, ok := value.Get(codec.XMLItem)
+			if !ok || len(value) != 1 {
+				return value
+			}
+			if array, ok := item.([]interface{}); ok {
+				items = array
+			} else {
+				items = []interface{}{item}
+			}
+		case string:
+			if strings.TrimSpace(value) != "" {
+				return value
+			}
+			items = []interface{}{}
+		default:
+			return value
+		}
+		for i := range items {
+			items[i] = coerceToSchema(items[i], schema.Items)
+		}
+		return items
+	case "object":
+		if isText && strings.TrimSpace(text) == "" {
+			return codec.Object{}
+		}
+		object, ok := value.(codec.Object)
+		if !ok {
+			return value
+		}
+		for i, member := range object {
+			if propSchema, ok := schema.Properties[member.Key]; ok {
+				object[i].Value = coerceToSchema(member.Value, propSchema)
+			} else if valueSchema, ok := schema.AdditionalProperties.(*openAPISchema); ok {
+				object[i].Value = coerceToSchema(member.Value, valueSchema)
+			}
+		}
+		return object
+	case "integer", "number":
+		trimmed := strings.TrimSpace(text)
+		if _, err := strconv.ParseFloat(trimmed, 64); isText && err == nil && json.Valid([]byte(trimmed)) {
+			return json.Number(trimmed)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(strings.TrimSpace(text)); isText && err == nil {
+			return b
+		}
+	}
+	return value
+}
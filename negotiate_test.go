@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/codec"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func Test_NegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept, expected string
+	}{
+		{"", mediaTypeJSON},
+		{"*/*", mediaTypeJSON},
+		{"application/xml", mediaTypeXML},
+		{"text/xml", mediaTypeXML},
+		{"application/x-msgpack", mediaTypeMsgpack},
+		{"application/cbor, application/json;q=0.5", mediaTypeCBOR},
+		{"application/json;q=0.5, application/*", mediaTypeXML},
+		{"text/html, */*;q=0.1", mediaTypeJSON},
+		{"application/*, application/json;q=0", mediaTypeXML},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+	for _, c := range cases {
+		f, ok := negotiateFormat(c.accept)
+		got := ""
+		if ok {
+			got = f.mediaType
+		}
+		if got != c.expected {
+			t.Errorf("Accept %q: expected %q, got %q", c.accept, c.expected, got)
+		}
+	}
+}
+
+func Test_Negotiate(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, contentType, accept string, body []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(method, path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	//XML in and out, with the number in the body read as a number
+	rec := do(http.MethodPost, "/v1/blog", "application/xml", "application/xml",
+		[]byte(`<BlogPost><Title>Ico</Title><ArticleText>Hold hands</ArticleText><AuthorName>Yorda</AuthorName><CommentsCloseAfterDays>7</CommentsCloseAfterDays></BlogPost>`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/xml; charset=utf-8" {
+		t.Errorf("Expected an XML response, got %s", contentType)
+	}
+	if vary := rec.Header()["Vary"]; !containsString(vary, "Accept") {
+		t.Errorf("Expected Vary: Accept, got %q", vary)
+	}
+	created, err := codec.UnmarshalXML(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := created.(codec.Object).Get("Data")
+	id, _ := data.(codec.Object).Get("ID")
+	postID, ok := id.(string)
+	if !ok || postID == "" {
+		t.Fatalf("Expected the ID of the new post, got %s", rec.Body.String())
+	}
+
+	for _, f := range []struct {
+		mediaType string
+		unmarshal func([]byte, interface{}) error
+	}{
+		{mediaTypeMsgpack, msgpack.Unmarshal},
+		{mediaTypeCBOR, cbor.Unmarshal},
+	} {
+		rec = do(http.MethodGet, "/v1/blog/"+postID, "", f.mediaType, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d", f.mediaType, http.StatusOK, rec.Code)
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != f.mediaType {
+			t.Errorf("Expected a %s response, got %s", f.mediaType, contentType)
+		}
+		//times are sent as the format's own timestamps
+		var post struct {
+			Data struct {
+				Title                  string
+				CommentsCloseAfterDays int
+				CreatedAt              time.Time
+			}
+		}
+		err = f.unmarshal(rec.Body.Bytes(), &post)
+		if err != nil {
+			t.Fatalf("%s: %v", f.mediaType, err)
+		}
+		if post.Data.Title != "Ico" || post.Data.CommentsCloseAfterDays != 7 || post.Data.CreatedAt.IsZero() {
+			t.Errorf("%s: expected the post back, got %+v", f.mediaType, post.Data)
+		}
+	}
+
+	//a comment in MessagePack
+	comment, _ := msgpack.Marshal(map[string]string{"AuthorName": "Wander", "CommentText": "Bring your horse"})
+	rec = do(http.MethodPost, "/v1/blog/"+postID+"/comment", "application/x-msgpack", "", comment)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, mediaTypeJSON) {
+		t.Errorf("Expected JSON without an Accept header, got %s", contentType)
+	}
+
+	errorCases := []struct {
+		name, contentType, accept string
+		body                      []byte
+		status                    int
+		code                      string
+	}{
+		{"unacceptable", "", "text/html", nil, http.StatusNotAcceptable, codeNotAcceptable},
+		{"unsupported", "text/plain", "", []byte("Ico"), http.StatusUnsupportedMediaType, codeUnsupportedMedia},
+		{"undecodable", mediaTypeCBOR, "", []byte{0xbf}, http.StatusBadRequest, codeInvalidBody},
+		{"too deep", mediaTypeMsgpack, "", append(bytes.Repeat([]byte{0x91}, maxBodyDepth+1), 0xc0), http.StatusBadRequest, codeInvalidBody},
+		{"trailing data", mediaTypeMsgpack, "", []byte{0x80, 0x80}, http.StatusBadRequest, codeInvalidBody},
+		{"invalid UTF-8", mediaTypeMsgpack, "", []byte{0x81, 0xa5, 'T', 'i', 't', 'l', 'e', 0xa1, 0xff}, http.StatusBadRequest, codeInvalidBody},
+	}
+	for _, c := range errorCases {
+		rec = do(http.MethodPost, "/v1/blog", c.contentType, c.accept, c.body)
+		if rec.Code != c.status {
+			t.Errorf("%s: expected status code %d, got %d", c.name, c.status, rec.Code)
+		}
+		var response Response
+		err = json.Unmarshal(rec.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if response.Code != c.code {
+			t.Errorf("%s: expected code %s, got %s", c.name, c.code, response.Code)
+		}
+	}
+
+	//errors are converted too
+	rec = do(http.MethodGet, "/v1/blog/nope", "", mediaTypeXML, nil)
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "<Code>post_not_found</Code>") {
+		t.Errorf("Expected a 404 in XML, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	//text routes are left alone
+	rec = do(http.MethodGet, "/health", "", mediaTypeXML, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected /health to ignore Accept, got %d", rec.Code)
+	}
+}
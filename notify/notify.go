@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/logging"
+)
+
+//Deliverer sends a single notification to its recipient
+type Deliverer interface {
+	Deliver(notification db.Notification) error
+}
+
+//LogDeliverer logs each notification to Logger, for local use
+type LogDeliverer struct {
+	Logger *logging.Logger
+}
+
+func (d LogDeliverer) Deliver(notification db.Notification) error {
+	d.Logger.Log(config.LogLevelInfo, "Logged notification instead of delivering it", logging.Fields{"func": "LogDeliverer.Deliver", "notification_id": notification.ID, "recipient": notification.Recipient, "kind": notification.Kind, "actor_name": notification.ActorName, "comment_id": notification.CommentID, "article_id": notification.ArticleID})
+	return nil
+}
+
+//FileDeliverer appends each notification as a line of JSON to the file at Path
+type FileDeliverer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (d *FileDeliverer) Deliver(notification db.Notification) error {
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.OpenFile(d.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//DeliverPending drains the notification outbox through deliverer, returning how many were delivered.
+//Notifications that fail to deliver stay in the outbox for the next attempt
+func DeliverPending(ctx context.Context, inMemDB *db.DB, deliverer Deliverer) (delivered int, err error) {
+	pending, err := db.GetUndeliveredNotifications(ctx, inMemDB)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, notification := range pending {
+		err = deliverer.Deliver(notification)
+		if err != nil {
+			return delivered, fmt.Errorf("Error delivering notification %s: %w", notification.ID, err)
+		}
+		_, err = db.MarkNotificationDelivered(ctx, inMemDB, notification.ID)
+		if err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
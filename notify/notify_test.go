@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/logging"
+)
+
+type failingDeliverer struct{}
+
+func (failingDeliverer) Deliver(notification db.Notification) error {
+	return fmt.Errorf("mail server on fire")
+}
+
+func Test_DeliverPending_File(t *testing.T) {
+	inMemDB, err := db.CreateDB()
+	if err != nil {
+		t.Error(err)
+	}
+
+	articleID, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "Test Title 1", ArticleText: "Test Body 1", AuthorName: "Dr. Eggman", OwnerID: "user:eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = db.CreateBlogComment(context.Background(), inMemDB, db.SystemActor, db.BlogComment{ArticleID: articleID, AuthorName: "Sonic", CommentText: "@Dr. Eggman you're too slow"}, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	delivered, err := DeliverPending(context.Background(), inMemDB, failingDeliverer{})
+	if err == nil {
+		t.Error("Expected delivery error, got nil")
+	}
+	if delivered != 0 {
+		t.Errorf("Expected nothing to be delivered, got %d", delivered)
+	}
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notifications.jsonl")
+	delivered, err = DeliverPending(context.Background(), inMemDB, &FileDeliverer{Path: path})
+	if err != nil {
+		t.Error(err)
+	}
+	if delivered != 1 {
+		t.Errorf("Expected 1 notification to be delivered, got %d", delivered)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines []db.Notification
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var n db.Notification
+		err = json.Unmarshal(scanner.Bytes(), &n)
+		if err != nil {
+			t.Error(err)
+		}
+		lines = append(lines, n)
+	}
+	if len(lines) != 1 || lines[0].Recipient != "Dr. Eggman" {
+		t.Errorf("Expected a single notification for Dr. Eggman in the file, got %#v", lines)
+	}
+
+	delivered, err = DeliverPending(context.Background(), inMemDB, &FileDeliverer{Path: path})
+	if err != nil {
+		t.Error(err)
+	}
+	if delivered != 0 {
+		t.Errorf("Expected outbox to be empty, got %d delivered", delivered)
+	}
+}
+
+func Test_LogDeliverer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	d := LogDeliverer{Logger: logging.New(buf, config.LogLevelInfo)}
+	err := d.Deliver(db.Notification{ID: "n1", Recipient: "Dr. Eggman", Kind: db.NotificationKindMention, ActorName: "Sonic", ArticleID: "a1", CommentID: "c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var line map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("Expected a line of JSON, got %q: %v", buf.String(), err)
+	}
+	if line["notification_id"] != "n1" || line["comment_id"] != "c1" || line["level"] != config.LogLevelInfo {
+		t.Errorf("Expected the notification to be logged, got %v", line)
+	}
+}
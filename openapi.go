@@ -0,0 +1,746 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/logging"
+	"github.com/aschereT/ea-gaming-review/validate"
+	"github.com/gorilla/mux"
+)
+
+//How a route is protected, mirroring how routes() registers it
+const (
+	//anyone can call it
+	authNone = iota
+	//API keys need the route's scope, sessions are allowed and so are anonymous callers
+	authScoped
+	//like authScoped, and bearer tokens are accepted too
+	authProtected
+	//only admins, whether logged in, by bearer token or with an admin API key
+	authAdmin
+)
+
+type queryParamDoc struct {
+	Name        string
+	Description string
+	Type        string
+	Format      string
+	Required    bool
+	Enum        []string
+	Minimum     *float64
+	Maximum     *float64
+}
+
+//routeDoc documents one route for the OpenAPI document
+type routeDoc struct {
+	Method      string
+	Path        string
+	Summary     string
+	Tag         string
+	Auth        int
+	Scope       string
+	RateLimited bool
+	Query       []queryParamDoc
+	//a zero value of the request body, nil if there isn't one
+	Request interface{}
+	//a zero value of the Data in the Response envelope
+	Response interface{}
+	//responses that aren't a JSON Response envelope, eg text/plain
+	ContentType string
+	//besides 200
+	ExtraSuccess map[int]string
+	Deprecated   bool
+	//the Cache-Control header, see cacheControl for the default
+	CacheControl string
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+var paginationParams = []queryParamDoc{
+	{Name: "offset", Description: "How many results to skip", Type: "integer", Minimum: floatPtr(0)},
+	{Name: "limit", Description: "How many results to return", Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(maxPageLimit)},
+}
+
+//routes that aren't versioned
+var metaRouteDocs = []routeDoc{
+	{Method: http.MethodGet, Path: "/health", Summary: "Check the server is up", Tag: "meta", ContentType: "text/plain", CacheControl: "no-store"},
+	{Method: http.MethodGet, Path: "/metrics", Summary: "Prometheus metrics", Tag: "meta", ContentType: "text/plain", CacheControl: "no-store"},
+	{Method: http.MethodGet, Path: "/openapi.json", Summary: "This document", Tag: "meta", ContentType: "application/json", CacheControl: "public, max-age=3600"},
+	{Method: http.MethodGet, Path: "/docs", Summary: "Browsable documentation of the API", Tag: "meta", ContentType: "text/html", CacheControl: "public, max-age=3600"},
+}
+
+//routes of version 1 of the API, relative to /v1
+var v1RouteDocs = []routeDoc{
+	{Method: http.MethodPost, Path: "/auth/register", Summary: "Create an account", Tag: "auth", RateLimited: true, Request: RegisterRequest{}, Response: CreateBlogPostOrCommentResponse{}},
+	{Method: http.MethodPost, Path: "/auth/login", Summary: "Log in, setting the session and CSRF cookies", Tag: "auth", RateLimited: true, Request: LoginRequest{}, Response: LoginResponse{}},
+	{Method: http.MethodPost, Path: "/auth/logout", Summary: "End the current session", Tag: "auth", Response: ""},
+	{Method: http.MethodGet, Path: "/auth/csrf", Summary: "Get the CSRF token to repeat in the X-CSRF-Token header", Tag: "auth", Response: CSRFTokenResponse{}, CacheControl: "no-store"},
+	{Method: http.MethodGet, Path: "/auth/verify-email", Summary: "Verify an email address, publishing the comment the link was sent for and remembering the address in this browser", Tag: "auth", Response: VerifyEmailResponse{}, CacheControl: "no-store",
+		Query: []queryParamDoc{{Name: "token", Description: "The token mailed to the address", Type: "string", Required: true}}},
+
+	{Method: http.MethodGet, Path: "/blog", Summary: "List post IDs", Tag: "posts", Auth: authScoped, Scope: db.ScopeRead, Response: GetBlogPostIDsResponse{}},
+	{Method: http.MethodPost, Path: "/blog", Summary: "Add a post", Tag: "posts", Auth: authProtected, Scope: db.ScopePostsWrite, RateLimited: true, Request: db.BlogPost{}, Response: CreateBlogPostOrCommentResponse{}},
+	{Method: http.MethodGet, Path: "/blog/{id}", Summary: "Get a post, without its comments", Tag: "posts", Auth: authScoped, Scope: db.ScopeRead, Response: db.BlogPost{}},
+	{Method: http.MethodDelete, Path: "/blog/{id}", Summary: "Delete a post and its comments", Tag: "posts", Auth: authProtected, Scope: db.ScopePostsWrite, Response: ""},
+	{Method: http.MethodPut, Path: "/blog/{id}/commentstate", Summary: "Lock or unlock comments on a post, and set when they close", Tag: "moderation", Auth: authProtected, Scope: db.ScopeCommentsModerate, Request: SetCommentStateRequest{}, Response: ""},
+
+	{Method: http.MethodGet, Path: "/blog/{id}/comment", Summary: "List the comment IDs of a post", Tag: "comments", Auth: authScoped, Scope: db.ScopeRead, Response: GetBlogCommentsIDsResponse{}},
+	{Method: http.MethodPost, Path: "/blog/{id}/comment", Summary: "Add a comment", Tag: "comments", Auth: authProtected, Scope: db.ScopeCommentsWrite, RateLimited: true, Request: CreateBlogCommentRequest{}, Response: CreateBlogPostOrCommentResponse{},
+		ExtraSuccess: map[int]string{http.StatusAccepted: "The comment is hidden until its author verifies their email"}},
+	{Method: http.MethodGet, Path: "/blog/{id}/comment/{commentID}", Summary: "Get a comment", Tag: "comments", Auth: authScoped, Scope: db.ScopeRead, Response: db.BlogComment{}},
+	{Method: http.MethodDelete, Path: "/blog/{id}/comment/{commentID}", Summary: "Delete a comment", Tag: "comments", Auth: authProtected, Scope: db.ScopeCommentsModerate, Response: ""},
+	{Method: http.MethodPatch, Path: "/blog/{id}/comment/{commentID}", Summary: "Edit a comment within the edit window", Tag: "comments", Auth: authProtected, Scope: db.ScopeCommentsWrite, RateLimited: true, Request: EditBlogCommentRequest{}, Response: db.BlogComment{}},
+	{Method: http.MethodGet, Path: "/blog/{id}/comment/{commentID}/history", Summary: "Get the previous texts of an edited comment", Tag: "moderation", Auth: authProtected, Scope: db.ScopeCommentsModerate, Response: GetCommentRevisionsResponse{}},
+	{Method: http.MethodPost, Path: "/blog/{id}/comment/{commentID}/flag", Summary: "Flag a comment", Tag: "moderation", Auth: authProtected, Scope: db.ScopeCommentsWrite, RateLimited: true, Request: FlagBlogCommentRequest{}, Response: FlagBlogCommentResponse{}},
+	{Method: http.MethodDelete, Path: "/blog/{id}/comment/{commentID}/flag", Summary: "Dismiss the flags on a comment, showing it again", Tag: "moderation", Auth: authProtected, Scope: db.ScopeCommentsModerate, Response: ""},
+	{Method: http.MethodGet, Path: "/moderation/flagged", Summary: "List the most flagged comments", Tag: "moderation", Auth: authProtected, Scope: db.ScopeCommentsModerate, Response: GetFlaggedCommentsResponse{},
+		Query: []queryParamDoc{paginationParams[1]}},
+
+	{Method: http.MethodGet, Path: "/authors", Summary: "List everyone who has posted or commented", Tag: "authors", Auth: authScoped, Scope: db.ScopeRead, Response: GetAuthorsResponse{}},
+	{Method: http.MethodGet, Path: "/authors/{name}", Summary: "Get someone's post and comment counts and activity", Tag: "authors", Auth: authScoped, Scope: db.ScopeRead, Response: db.AuthorStats{}},
+	{Method: http.MethodGet, Path: "/authors/{name}/posts", Summary: "Get a page of someone's posts, newest first", Tag: "authors", Auth: authScoped, Scope: db.ScopeRead, Response: GetAuthorPostsResponse{}, Query: paginationParams},
+	{Method: http.MethodGet, Path: "/authors/{name}/comments", Summary: "Get a page of someone's comments, newest first", Tag: "authors", Auth: authScoped, Scope: db.ScopeRead, Response: GetAuthorCommentsResponse{}, Query: paginationParams},
+
+	{Method: http.MethodGet, Path: "/notifications", Summary: "Get your notifications", Tag: "notifications", Auth: authProtected, Scope: db.ScopeRead, Response: GetNotificationsResponse{},
+		Query: []queryParamDoc{{Name: "recipient", Description: "Whose notifications to get, which can only be your own name", Type: "string"}}},
+
+	{Method: http.MethodGet, Path: "/admin/apikeys", Summary: "List API keys", Tag: "admin", Auth: authAdmin, Response: GetAPIKeysResponse{}},
+	{Method: http.MethodPost, Path: "/admin/apikeys", Summary: "Mint an API key, only shown in this response", Tag: "admin", Auth: authAdmin, Request: CreateAPIKeyRequest{}, Response: CreateAPIKeyResponse{}},
+	{Method: http.MethodDelete, Path: "/admin/apikeys/{keyID}", Summary: "Revoke an API key", Tag: "admin", Auth: authAdmin, Response: ""},
+	{Method: http.MethodPut, Path: "/admin/users/{username}/role", Summary: "Set a user's role", Tag: "admin", Auth: authAdmin, Request: SetUserRoleRequest{}, Response: ""},
+	{Method: http.MethodGet, Path: "/admin/audit", Summary: "Get a page of the audit log, newest first", Tag: "admin", Auth: authAdmin, Response: GetAuditEntriesResponse{},
+		Query: append([]queryParamDoc{
+			{Name: "actor", Description: "Only changes made by this name", Type: "string"},
+			{Name: "action", Description: "Only this kind of change", Type: "string", Enum: []string{db.AuditActionCreate, db.AuditActionUpdate, db.AuditActionDelete}},
+			{Name: "table", Description: "Only changes to this table", Type: "string"},
+			{Name: "target", Description: "Only changes to the object with this ID", Type: "string"},
+			{Name: "article", Description: "Only changes to this post and its comments", Type: "string"},
+			{Name: "since", Description: "Only changes at or after this time", Type: "string", Format: "date-time"},
+			{Name: "until", Description: "Only changes before this time", Type: "string", Format: "date-time"},
+		}, paginationParams...)},
+}
+
+//every route the server registers. Test_OpenAPI_DocumentsEveryRoute fails if one is missing
+var routeDocs = allRouteDocs()
+
+func allRouteDocs() []routeDoc {
+	docs := append([]routeDoc{}, metaRouteDocs...)
+	for _, route := range v1RouteDocs {
+		versioned := route
+		versioned.Path = "/v1" + route.Path
+		docs = append(docs, versioned)
+	}
+	//the unversioned aliases of v1, see routes()
+	for _, route := range v1RouteDocs {
+		alias := route
+		alias.Summary += ". Use /v1" + route.Path + " instead, this alias sends Deprecation and Sunset headers"
+		alias.Deprecated = true
+		docs = append(docs, alias)
+	}
+	return docs
+}
+
+//allowed values of request fields, by type and field name, that the handlers check themselves rather than with a oneof validate tag
+var fieldEnums = map[string][]string{
+	"FlagBlogCommentRequest.Reason": {db.FlagReasonSpam, db.FlagReasonHarassment, db.FlagReasonSpoilers},
+	"CreateAPIKeyRequest.Scopes":    {db.ScopeRead, db.ScopePostsWrite, db.ScopeCommentsWrite, db.ScopeCommentsModerate, db.ScopeAdmin},
+}
+
+type openAPISchema struct {
+	Ref         string                    `json:"$ref,omitempty"`
+	Type        string                    `json:"type,omitempty"`
+	Format      string                    `json:"format,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	Nullable    bool                      `json:"nullable,omitempty"`
+	Enum        []string                  `json:"enum,omitempty"`
+	MinLength   *int                      `json:"minLength,omitempty"`
+	MaxLength   *int                      `json:"maxLength,omitempty"`
+	Minimum     *float64                  `json:"minimum,omitempty"`
+	Maximum     *float64                  `json:"maximum,omitempty"`
+	Properties  map[string]*openAPISchema `json:"properties,omitempty"`
+	Required    []string                  `json:"required,omitempty"`
+	//false, or the schema of a map's values
+	AdditionalProperties interface{}      `json:"additionalProperties,omitempty"`
+	Items                *openAPISchema   `json:"items,omitempty"`
+	AllOf                []*openAPISchema `json:"allOf,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	Security    []map[string][]string      `json:"security"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+//schemaBuilder turns Go types into schemas, collecting named structs as components
+type schemaBuilder struct {
+	components map[string]*openAPISchema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *openAPISchema {
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		//any JSON value
+		return &openAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := b.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			return &openAPISchema{AllOf: []*openAPISchema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.components[t.Name()]; !ok {
+			//placeholder, so self-referencing types don't recurse forever
+			b.components[t.Name()] = &openAPISchema{}
+			*b.components[t.Name()] = *b.structSchema(t)
+		}
+		return &openAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	//interface{}, anything goes
+	return &openAPISchema{}
+}
+
+//structSchema describes t by its JSON field names, flattening embedded structs like encoding/json does
+func (b *schemaBuilder) structSchema(t reflect.Type) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: map[string]*openAPISchema{}, AdditionalProperties: false}
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			fieldSchema := b.schemaOf(field.Type)
+			for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+				switch {
+				case rule == "required":
+					schema.Required = append(schema.Required, name)
+					fieldSchema.MinLength = intPtr(1)
+				case strings.HasPrefix(rule, "max="):
+					max, err := strconv.Atoi(strings.TrimPrefix(rule, "max="))
+					if err == nil {
+						fieldSchema.MaxLength = intPtr(max)
+					}
+				case strings.HasPrefix(rule, "min="):
+					min, err := strconv.ParseFloat(strings.TrimPrefix(rule, "min="), 64)
+					if err == nil {
+						fieldSchema.Minimum = &min
+					}
+				case strings.HasPrefix(rule, "oneof="):
+					fieldSchema.Enum = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+				}
+			}
+			if enum, ok := fieldEnums[t.Name()+"."+field.Name]; ok {
+				if fieldSchema.Type == "array" {
+					fieldSchema.Items.Enum = enum
+				} else {
+					fieldSchema.Enum = enum
+				}
+			}
+			schema.Properties[name] = fieldSchema
+		}
+	}
+	addFields(t)
+	return schema
+}
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+//operationID is a name for the operation like getBlogIdComment, for client generators
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(path, "/") {
+		part = strings.Trim(part, "{}")
+		part = strings.NewReplacer(".", "", "-", "").Replace(part)
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+//jsonContent is schema in every format requests and responses can be in, see negotiate.go
+func jsonContent(schema *openAPISchema) map[string]openAPIMediaType {
+	content := map[string]openAPIMediaType{}
+	for _, mediaType := range supportedMediaTypes() {
+		content[mediaType] = openAPIMediaType{Schema: schema}
+	}
+	return content
+}
+
+func errorResponse(description string) openAPIResponse {
+	return openAPIResponse{Description: description, Content: jsonContent(&openAPISchema{Ref: "#/components/schemas/Response"})}
+}
+
+//buildOpenAPIDocument describes every route in docs, and the Response envelope they all answer with
+func buildOpenAPIDocument(docs []routeDoc) *openAPIDocument {
+	b := &schemaBuilder{components: map[string]*openAPISchema{}}
+	b.schemaOf(reflect.TypeOf(Response{}))
+	b.schemaOf(reflect.TypeOf(validate.FieldError{}))
+
+	doc := &openAPIDocument{OpenAPI: "3.0.3", Paths: map[string]map[string]*openAPIOperation{}}
+	doc.Info.Title = "ea-gaming-review"
+	doc.Info.Description = "Video game reviews and the comments on them. Every JSON response is a Response, with Data on success and Error on failure"
+	doc.Info.Version = "1.0.0"
+	doc.Components.SecuritySchemes = map[string]openAPISecurityScheme{
+		"session": {Type: "apiKey", In: "cookie", Name: sessionCookieName, Description: "Set by logging in. Requests that change anything must also send the csrf_token cookie in the X-CSRF-Token header"},
+		"apiKey":  {Type: "apiKey", In: "header", Name: apiKeyHeader, Description: "Needs the scope listed on each route"},
+		"bearer":  {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	}
+
+	for _, route := range docs {
+		op := &openAPIOperation{
+			Summary:     route.Summary,
+			OperationID: operationID(route.Method, route.Path),
+			Tags:        []string{route.Tag},
+			Deprecated:  route.Deprecated,
+			Security:    []map[string][]string{},
+			Responses:   map[string]openAPIResponse{},
+		}
+
+		switch route.Auth {
+		case authScoped:
+			op.Security = []map[string][]string{{}, {"session": {}}, {"apiKey": {route.Scope}}}
+		case authProtected:
+			op.Security = []map[string][]string{{}, {"session": {}}, {"bearer": {}}, {"apiKey": {route.Scope}}}
+		case authAdmin:
+			op.Security = []map[string][]string{{"session": {}}, {"bearer": {}}, {"apiKey": {db.ScopeAdmin}}}
+		}
+
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: match[1], In: "path", Required: true, Schema: &openAPISchema{Type: "string"}})
+		}
+		for _, param := range route.Query {
+			schema := &openAPISchema{Type: param.Type, Format: param.Format, Enum: param.Enum, Minimum: param.Minimum, Maximum: param.Maximum}
+			op.Parameters = append(op.Parameters, openAPIParameter{Name: param.Name, In: "query", Description: param.Description, Required: param.Required, Schema: schema})
+		}
+
+		if route.Request != nil {
+			op.RequestBody = &openAPIRequestBody{Required: true, Content: jsonContent(b.schemaOf(reflect.TypeOf(route.Request)))}
+		}
+
+		if route.ContentType != "" {
+			op.Responses["200"] = openAPIResponse{Description: "OK", Content: map[string]openAPIMediaType{route.ContentType: {Schema: &openAPISchema{Type: "string"}}}}
+		} else {
+			success := &openAPISchema{AllOf: []*openAPISchema{
+				{Ref: "#/components/schemas/Response"},
+				{Type: "object", Properties: map[string]*openAPISchema{"Data": b.schemaOf(reflect.TypeOf(route.Response))}},
+			}}
+			op.Responses["200"] = openAPIResponse{Description: "OK", Content: jsonContent(success)}
+			for status, description := range route.ExtraSuccess {
+				op.Responses[strconv.Itoa(status)] = openAPIResponse{Description: description, Content: jsonContent(success)}
+			}
+
+			if route.Request != nil || len(route.Query) > 0 {
+				op.Responses["400"] = errorResponse("The request is malformed or failed validation, Errors lists every problem")
+			}
+			if route.Request != nil {
+				op.Responses["413"] = errorResponse("The request body is too big")
+				op.Responses["415"] = errorResponse("The request body isn't in a supported format")
+			}
+			op.Responses["406"] = errorResponse("The Accept header allows none of the response formats")
+			if route.Auth != authNone {
+				op.Responses["401"] = errorResponse("Logging in is needed")
+				op.Responses["403"] = errorResponse("Not allowed to do this")
+			}
+			if strings.Contains(route.Path, "{") {
+				op.Responses["404"] = errorResponse("Not found")
+			}
+			if route.RateLimited {
+				op.Responses["429"] = errorResponse("Too many requests, retry after the Retry-After header")
+			}
+			op.Responses["500"] = errorResponse("Something went wrong on the server")
+		}
+		if route.Method == http.MethodGet && !strings.Contains(cacheControl(route), "no-store") {
+			op.Responses["304"] = openAPIResponse{Description: "Unchanged since the ETag in If-None-Match, or the If-Modified-Since date"}
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = map[string]*openAPIOperation{}
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	doc.Components.Schemas = b.components
+	return doc
+}
+
+//the document served at /openapi.json
+var openAPISpec = buildOpenAPIDocument(routeDocs)
+
+func openAPIHandler(w http.ResponseWriter, req *http.Request) {
+	const funcname = "openAPIHandler"
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, err := json.Marshal(openAPISpec)
+	if err != nil {
+		logError(req.Context(), funcname, err)
+		respondWithError(w, http.StatusInternalServerError, fmt.Errorf("Error marshalling response"))
+		return
+	}
+	w.Write(resp)
+}
+
+//loads Redoc from its CDN to render /openapi.json
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>ea-gaming-review API</title>
+</head>
+<body>
+<redoc spec-url="openapi.json"></redoc>
+<script src="https://cdn.jsdelivr.net/npm/redoc@2.0.0-rc.28/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+func docsHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, docsPage)
+}
+
+//documentedRoutes lists every documented method and path, sorted, eg "GET /blog"
+func documentedRoutes(doc *openAPIDocument) []string {
+	routes := []string{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+//operations by method and path template, for validateRequestMiddleware
+var openAPIOperations = func() map[string]*openAPIOperation {
+	ops := map[string]*openAPIOperation{}
+	for path, pathOps := range openAPISpec.Paths {
+		for method, op := range pathOps {
+			ops[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return ops
+}()
+
+//validateRequestMiddleware rejects query parameters and JSON bodies that don't match the route's operation in openAPISpec, listing every problem.
+//It does nothing unless the ValidateRequests feature is on
+func (s *Server) validateRequestMiddleware(next http.Handler) http.Handler {
+	const funcname = "validateRequestMiddleware"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := mux.CurrentRoute(req)
+		if !s.Config.Features.ValidateRequests || route == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		op, ok := openAPIOperations[req.Method+" "+template]
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		errs := validate.Errors{}
+		query := req.URL.Query()
+		for _, param := range op.Parameters {
+			if param.In != "query" {
+				continue
+			}
+			value, present := query[param.Name]
+			if !present {
+				if param.Required {
+					errs.Add(param.Name, "%s is required", param.Name)
+				}
+				continue
+			}
+			checkQueryParam(&errs, param.Name, value[0], param.Schema)
+		}
+
+		if op.RequestBody != nil && req.Body != nil && req.Body != http.NoBody {
+			body, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				logError(req.Context(), funcname, err)
+				respondWithError(w, http.StatusBadRequest, fmt.Errorf("Error reading request body"))
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+			var value interface{}
+			err = dec.Decode(&value)
+			if err != nil {
+				errs.Add("", "Request body should be valid JSON")
+			} else {
+				checkJSONValue(&errs, "", value, op.RequestBody.Content[mediaTypeJSON].Schema)
+			}
+		}
+
+		if len(errs) > 0 {
+			logAt(req.Context(), config.LogLevelDebug, funcname, "Rejected request", logging.Fields{"route": template, "error": errs.Error()})
+			respondWithErrors(w, http.StatusBadRequest, errs)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func checkQueryParam(errs *validate.Errors, name, value string, schema *openAPISchema) {
+	switch {
+	case schema.Type == "integer":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			errs.Add(name, "%s should be a whole number", name)
+			return
+		}
+		checkRange(errs, name, float64(n), schema)
+	case schema.Format == "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs.Add(name, "%s should be an RFC 3339 timestamp", name)
+		}
+	}
+	checkEnum(errs, name, value, schema)
+}
+
+func checkRange(errs *validate.Errors, name string, n float64, schema *openAPISchema) {
+	if schema.Minimum != nil && n < *schema.Minimum {
+		errs.Add(name, "%s should be at least %v", name, *schema.Minimum)
+	}
+	if schema.Maximum != nil && n > *schema.Maximum {
+		errs.Add(name, "%s should be at most %v", name, *schema.Maximum)
+	}
+}
+
+func checkEnum(errs *validate.Errors, name, value string, schema *openAPISchema) {
+	if len(schema.Enum) == 0 {
+		return
+	}
+	for _, allowed := range schema.Enum {
+		if value == allowed {
+			return
+		}
+	}
+	errs.Add(name, "%s should be one of %s", name, strings.Join(schema.Enum, ", "))
+}
+
+//resolveSchema follows $refs and allOfs of a single schema to the schema they point to
+func resolveSchema(schema *openAPISchema) *openAPISchema {
+	for {
+		switch {
+		case schema.Ref != "":
+			schema = openAPISpec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		case len(schema.AllOf) == 1:
+			schema = schema.AllOf[0]
+		default:
+			return schema
+		}
+	}
+}
+
+//checkJSONValue checks value, decoded with UseNumber, against schema. name is where in the body value is, like Scopes[0]
+func checkJSONValue(errs *validate.Errors, name string, value interface{}, schema *openAPISchema) {
+	nullable := schema.Nullable
+	schema = resolveSchema(schema)
+	field := name
+	if field == "" {
+		field = "Request body"
+	}
+	if value == nil {
+		if !nullable && schema.Type != "" {
+			errs.Add(name, "%s should not be null", field)
+		}
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			errs.Add(name, "%s should be a string", field)
+			return
+		}
+		if schema.Format == "date-time" {
+			_, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				errs.Add(name, "%s should be an RFC 3339 timestamp", field)
+			}
+		}
+		if schema.MinLength != nil && utf8.RuneCountInString(strings.TrimSpace(s)) < *schema.MinLength {
+			errs.Add(name, "%s is required", field)
+		}
+		if schema.MaxLength != nil && utf8.RuneCountInString(s) > *schema.MaxLength {
+			errs.Add(name, "%s should be at most %d characters", field, *schema.MaxLength)
+		}
+		checkEnum(errs, name, s, schema)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			errs.Add(name, "%s should be a number", field)
+			return
+		}
+		f, err := n.Float64()
+		if err != nil || (schema.Type == "integer" && strings.ContainsAny(n.String(), ".eE")) {
+			errs.Add(name, "%s should be a whole number", field)
+			return
+		}
+		checkRange(errs, name, f, schema)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs.Add(name, "%s should be true or false", field)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			errs.Add(name, "%s should be an array", field)
+			return
+		}
+		for i, item := range items {
+			checkJSONValue(errs, fmt.Sprintf("%s[%d]", name, i), item, schema.Items)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.Add(name, "%s should be an object", field)
+			return
+		}
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				errs.Add(joinFieldName(name, required), "%s is required", joinFieldName(name, required))
+			}
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propSchema, ok := schema.Properties[key]; ok {
+				checkJSONValue(errs, joinFieldName(name, key), object[key], propSchema)
+			} else if valueSchema, ok := schema.AdditionalProperties.(*openAPISchema); ok {
+				checkJSONValue(errs, joinFieldName(name, key), object[key], valueSchema)
+			} else if schema.AdditionalProperties == false {
+				errs.Add(joinFieldName(name, key), "%s is not a known field", joinFieldName(name, key))
+			}
+		}
+	}
+}
+
+func joinFieldName(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func Test_OpenAPI_DocumentsEveryRoute(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := []string{}
+	err = server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		if route.GetHandler() == nil {
+			//a subrouter, its routes are walked separately
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			registered = append(registered, method+" "+path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(registered)
+
+	documented := documentedRoutes(openAPISpec)
+	if !reflect.DeepEqual(registered, documented) {
+		t.Errorf("Expected every route to be documented and every documented route to exist.\nRegistered: %v\nDocumented: %v", registered, documented)
+	}
+}
+
+func Test_OpenAPI_Serve(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var doc struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			Parameters []struct {
+				Name string
+				In   string
+			}
+			Responses  map[string]json.RawMessage
+			Deprecated bool
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string
+				}
+				Required []string
+			}
+		}
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Components.Schemas["Response"].Properties["Errors"]; !ok {
+		t.Errorf("Expected the Response envelope to be described, got %#v", doc.Components.Schemas["Response"])
+	}
+	if post := doc.Components.Schemas["BlogPost"]; !reflect.DeepEqual(post.Required, []string{"Title", "ArticleText"}) {
+		t.Errorf("Expected the required BlogPost fields, got %v", post.Required)
+	}
+	if reason := doc.Components.Schemas["FlagBlogCommentRequest"].Properties["Reason"]; len(reason.Enum) == 0 {
+		t.Error("Expected the flag reasons to be listed")
+	}
+
+	getComment := doc.Paths["/v1/blog/{id}/comment/{commentID}"]["get"]
+	if len(getComment.Parameters) != 2 || getComment.Parameters[1].Name != "commentID" || getComment.Parameters[1].In != "path" {
+		t.Errorf("Expected both path parameters, got %#v", getComment.Parameters)
+	}
+	if _, ok := getComment.Responses["404"]; !ok {
+		t.Errorf("Expected a 404 response, got %v", getComment.Responses)
+	}
+	if _, ok := doc.Paths["/v1/blog/{id}/comment"]["post"].Responses["202"]; !ok {
+		t.Error("Expected comment creation to document its 202 response")
+	}
+	if getComment.Deprecated || !doc.Paths["/blog/{id}/comment/{commentID}"]["get"].Deprecated {
+		t.Error("Expected only the unversioned alias to be deprecated")
+	}
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/docs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Errorf("Expected the docs page to load the document, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_ValidateRequestMiddleware(t *testing.T) {
+	cfg := testConfig()
+	cfg.Features.ValidateRequests = true
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		fields             []string
+	}{
+		{http.MethodPost, "/blog", `{"Title":"Ask Me About Loom","ArticleText":"Weave the Opening draft","AuthorName":"Bobbin"}`, http.StatusOK, nil},
+		{http.MethodPost, "/blog", `{"Title":5,"ArticleText":"","Genre":"adventure"}`, http.StatusBadRequest, []string{"ArticleText", "Genre", "Title"}},
+		{http.MethodPost, "/blog", `{"Title":"Loom"`, http.StatusBadRequest, []string{""}},
+		{http.MethodPost, "/blog", `{"ArticleText":"` + strings.Repeat("a", 5) + `","Title":"` + strings.Repeat("b", 201) + `"}`, http.StatusBadRequest, []string{"Title"}},
+		{http.MethodGet, "/authors/Bobbin/posts?limit=many&offset=-1", "", http.StatusBadRequest, []string{"offset", "limit"}},
+		{http.MethodGet, "/authors/Bobbin/posts?limit=10", "", http.StatusOK, nil},
+		{http.MethodGet, "/auth/verify-email", "", http.StatusBadRequest, []string{"token"}},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Errorf("%s %s: expected status code %d, got %d %s", c.method, c.path, c.status, rec.Code, rec.Body.String())
+			continue
+		}
+		if c.fields == nil {
+			continue
+		}
+
+		var resp Response
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := []string{}
+		for _, fieldErr := range resp.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		if !reflect.DeepEqual(fields, c.fields) {
+			t.Errorf("%s %s: expected problems with %v, got %#v", c.method, c.path, c.fields, resp.Errors)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aschereT/ea-gaming-review/db"
+)
+
+//action is something the policy decides whether an actor can do
+type action string
+
+const (
+	actionCreatePost       = action("create posts")
+	actionDeletePost       = action("delete this post")
+	actionModerateComments = action("moderate comments on this post")
+	actionDeleteComment    = action("delete this comment")
+	actionModerateAll      = action("moderate all comments")
+	actionAdminister       = action("administer the site")
+)
+
+//actor is whoever is making a request. Anonymous actors have no ID, Name or Role
+type actor struct {
+	//identifies the user, token subject or API key, unlike Name which anyone can post under
+	ID   string
+	Name string
+	Role string
+}
+
+//currentActor works out who is making req and what role they have.
+//Bearer tokens take their role from the role claim, defaulting to author, and API keys are treated as admins, editors or authors depending on their scopes
+func currentActor(req *http.Request) actor {
+	if user := currentUser(req); user != nil {
+		return actor{ID: "user:" + user.ID, Name: user.DisplayName, Role: user.Role}
+	}
+	if claims := currentClaims(req); claims != nil {
+		name := claims.Name
+		if name == "" {
+			name = claims.Subject
+		}
+		role := claims.Role
+		if !db.IsValidRole(role) {
+			role = db.DefaultRole
+		}
+		return actor{ID: "jwt:" + claims.Subject, Name: name, Role: role}
+	}
+	if apiKey := currentAPIKey(req); apiKey != nil {
+		id := "apikey:" + apiKey.ID
+		switch {
+		case apiKey.HasScope(db.ScopeAdmin):
+			return actor{ID: id, Name: apiKey.Name, Role: db.RoleAdmin}
+		case apiKey.HasScope(db.ScopeCommentsModerate):
+			return actor{ID: id, Name: apiKey.Name, Role: db.RoleEditor}
+		}
+		return actor{ID: id, Name: apiKey.Name, Role: db.RoleAuthor}
+	}
+	return actor{}
+}
+
+//can is the policy. post and comment are what act is being done to, and can be nil if act isn't about them
+func (a actor) can(act action, post *db.BlogPost, comment *db.BlogComment) bool {
+	if a.Role == db.RoleAdmin {
+		return true
+	}
+	isEditor := a.Role == db.RoleEditor
+	//ownership goes by ID, since anyone can post under someone else's name while logged out
+	ownsPost := a.ID != "" && post != nil && post.OwnerID == a.ID
+
+	switch act {
+	case actionCreatePost:
+		//anonymous posting is allowed unless REQUIRE_AUTH_FOR_WRITES is set
+		return a.Role != db.RoleCommenter
+	case actionDeletePost, actionModerateComments:
+		return isEditor || (ownsPost && a.Role == db.RoleAuthor)
+	case actionDeleteComment:
+		ownsComment := a.ID != "" && comment != nil && comment.OwnerID == a.ID
+		return isEditor || ownsComment || (ownsPost && a.Role == db.RoleAuthor)
+	case actionModerateAll:
+		return isEditor
+	}
+	return false
+}
+
+//authorize checks if whoever is making req can do act, giving the status code and error to respond with if they can't
+func authorize(req *http.Request, act action, post *db.BlogPost, comment *db.BlogComment) (statusCode int, err error) {
+	a := currentActor(req)
+	if a.can(act, post, comment) {
+		return http.StatusOK, nil
+	}
+	if a.ID == "" {
+		return http.StatusUnauthorized, fmt.Errorf("Log in to %s", act)
+	}
+	return http.StatusForbidden, fmt.Errorf("%s is not allowed to %s", a.Name, act)
+}
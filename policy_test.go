@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+)
+
+func Test_Policy(t *testing.T) {
+	post := &db.BlogPost{ID: "post", AuthorName: "Dr. Eggman", OwnerID: "user:eggman"}
+	comment := &db.BlogComment{ID: "comment", ArticleID: "post", AuthorName: "Anony Mouse", OwnerID: "user:mouse"}
+
+	anonymous := actor{}
+	admin := actor{ID: "user:root", Name: "Root", Role: db.RoleAdmin}
+	editor := actor{ID: "user:moderator", Name: "Moderator", Role: db.RoleEditor}
+	postAuthor := actor{ID: "user:eggman", Name: "Dr. Eggman", Role: db.RoleAuthor}
+	otherAuthor := actor{ID: "user:sonic", Name: "Sonic", Role: db.RoleAuthor}
+	commentAuthor := actor{ID: "user:mouse", Name: "Anony Mouse", Role: db.RoleCommenter}
+	demotedPostAuthor := actor{ID: "user:eggman", Name: "Dr. Eggman", Role: db.RoleCommenter}
+	//an API key named after the post's author doesn't own the post
+	impostor := actor{ID: "apikey:eggman", Name: "Dr. Eggman", Role: db.RoleAuthor}
+
+	cases := []struct {
+		actor    actor
+		action   action
+		expected bool
+	}{
+		{anonymous, actionCreatePost, true},
+		{commentAuthor, actionCreatePost, false},
+		{otherAuthor, actionCreatePost, true},
+
+		{anonymous, actionDeletePost, false},
+		{otherAuthor, actionDeletePost, false},
+		{demotedPostAuthor, actionDeletePost, false},
+		{postAuthor, actionDeletePost, true},
+		{impostor, actionDeletePost, false},
+		{editor, actionDeletePost, true},
+		{admin, actionDeletePost, true},
+
+		{otherAuthor, actionModerateComments, false},
+		{postAuthor, actionModerateComments, true},
+		{editor, actionModerateComments, true},
+
+		{anonymous, actionDeleteComment, false},
+		{otherAuthor, actionDeleteComment, false},
+		{commentAuthor, actionDeleteComment, true},
+		{impostor, actionDeleteComment, false},
+		{postAuthor, actionDeleteComment, true},
+
+		{postAuthor, actionModerateAll, false},
+		{editor, actionModerateAll, true},
+
+		{editor, actionAdminister, false},
+		{admin, actionAdminister, true},
+	}
+	for _, c := range cases {
+		if actual := c.actor.can(c.action, post, comment); actual != c.expected {
+			t.Errorf("Expected %#v to be able to %s: %v, got %v", c.actor, c.action, c.expected, actual)
+		}
+	}
+}
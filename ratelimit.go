@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/ratelimit"
+)
+
+//clientIP returns the IP address req came from. If the TrustProxyHeaders feature is on and req came through trusted proxies,
+//X-Forwarded-For is followed from the right back to the first hop that isn't one of them. Anything further left was sent by the client, who can put whatever they like there
+func clientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		ip = req.RemoteAddr
+	}
+	s := currentServer(req)
+	if s == nil || !s.Config.Features.TrustProxyHeaders {
+		return ip
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && s.trustedProxy(ip); i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+//trustedProxy is whether ip is one of Config.TrustedProxies
+func (s *Server) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range s.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+//parseTrustedProxies reads the CIDRs in Config.TrustedProxies
+func parseTrustedProxies(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading trusted proxy %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+//rateLimitKey picks who to count req against: its API key, user or bearer token subject, falling back to the client IP for anonymous requests
+func rateLimitKey(req *http.Request) string {
+	if apiKey := currentAPIKey(req); apiKey != nil {
+		return "apikey:" + apiKey.ID
+	}
+	if user := currentUser(req); user != nil {
+		return "user:" + user.ID
+	}
+	if claims := currentClaims(req); claims != nil {
+		return "token:" + claims.Subject
+	}
+	return "ip:" + clientIP(req)
+}
+
+//seconds rounds d up to whole seconds, for headers
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+//rateLimited applies the limiter registered as name to next. Routes without a limiter aren't limited
+func (s *Server) rateLimited(name string, next http.HandlerFunc) http.HandlerFunc {
+	const funcname = "rateLimited"
+	return func(w http.ResponseWriter, req *http.Request) {
+		limiter, ok := s.rateLimiters[name]
+		if !ok || !limiter.Limit().Enabled() {
+			next(w, req)
+			return
+		}
+
+		key := rateLimitKey(req)
+		result := limiter.Allow(key, time.Now())
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			err := &apiError{
+				message: fmt.Sprintf("Too many requests, try again in %s seconds", seconds(result.RetryAfter)),
+				details: map[string]interface{}{"RetryAfterSeconds": math.Ceil(result.RetryAfter.Seconds())},
+			}
+			logError(req.Context(), funcname, fmt.Errorf("Rate limited %s on %s: %w", key, name, err))
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+			respondWithError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		next(w, req)
+	}
+}
+
+//newRateLimiters makes a limiter for each group of rate limited routes, named as the routes are registered with
+func newRateLimiters(limits config.RateLimits) (map[string]*ratelimit.Limiter, error) {
+	limiters := map[string]*ratelimit.Limiter{}
+	for name, spec := range map[string]string{"auth": limits.Auth, "posts": limits.Posts, "comments": limits.Comments, "flags": limits.Flags} {
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading the %s rate limit: %w", name, err)
+		}
+		limiters[name] = ratelimit.New(limit)
+	}
+	return limiters, nil
+}
+
+//runRateLimitEvictor forgets idle rate limit buckets every interval, so memory doesn't grow with every client ever seen. It returns once stop is closed
+func (s *Server) runRateLimitEvictor(interval time.Duration, stop <-chan struct{}) {
+	const funcname = "runRateLimitEvictor"
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for name, limiter := range s.rateLimiters {
+			if evicted := limiter.Evict(time.Now()); evicted > 0 {
+				log(context.Background(), funcname, "Evicted", evicted, "idle", name, "rate limit buckets")
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Limit allows bursts of up to Requests, refilling evenly so that Requests more are allowed every Per
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+//Enabled checks if the limit actually limits anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+//ParseLimit reads limits like 10/1m, meaning 10 requests a minute. Empty and 0 mean unlimited
+func ParseLimit(spec string) (Limit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" {
+		return Limit{}, nil
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("Limit should look like requests/duration, got %q", spec)
+	}
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("Limit requests should be a positive number, got %q", parts[0])
+	}
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("Limit duration should be positive, got %q", parts[1])
+	}
+
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+//Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	//the most requests allowed in a burst
+	Limit int
+	//requests left in the current burst
+	Remaining int
+	//how long until another request is allowed, 0 if one is allowed now
+	RetryAfter time.Duration
+	//how long until the bucket is full again
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+//Limiter keeps a token bucket per key, eg per client IP. It is safe for concurrent use
+type Limiter struct {
+	limit   Limit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func New(limit Limit) *Limiter {
+	return &Limiter{limit: limit, buckets: map[string]*bucket{}}
+}
+
+//Limit returns the limit applied to every key
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+func (l *Limiter) refillRate() float64 {
+	return float64(l.limit.Requests) / float64(l.limit.Per)
+}
+
+//refill tops up b for the time since it was last updated
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	elapsed := now.Sub(b.updated)
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(l.limit.Requests), b.tokens+float64(elapsed)*l.refillRate())
+		b.updated = now
+	}
+}
+
+//Allow takes a token from the bucket of key if there is one
+func (l *Limiter) Allow(key string, now time.Time) Result {
+	if !l.limit.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Requests), updated: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	result := Result{Limit: l.limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / l.refillRate())
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(l.limit.Requests) - b.tokens) / l.refillRate())
+	return result
+}
+
+//Evict forgets buckets that have been idle long enough to refill, since they are no different to a new bucket. It returns how many were evicted
+func (l *Limiter) Evict(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Requests) {
+			delete(l.buckets, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+//Len returns how many keys are being tracked
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ParseLimit(t *testing.T) {
+	cases := []struct {
+		spec        string
+		expected    Limit
+		expectedErr bool
+	}{
+		{"", Limit{}, false},
+		{"0", Limit{}, false},
+		{"10/1m", Limit{Requests: 10, Per: time.Minute}, false},
+		{"5/30s", Limit{Requests: 5, Per: 30 * time.Second}, false},
+		{"10", Limit{}, true},
+		{"ten/1m", Limit{}, true},
+		{"10/-1m", Limit{}, true},
+	}
+	for _, c := range cases {
+		actual, err := ParseLimit(c.spec)
+		if (err != nil) != c.expectedErr {
+			t.Errorf("Expected error for %q: %v, got %v", c.spec, c.expectedErr, err)
+		}
+		if actual != c.expected {
+			t.Errorf("Expected %q to parse as %#v, got %#v", c.spec, c.expected, actual)
+		}
+	}
+}
+
+func Test_Limiter(t *testing.T) {
+	start := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	limiter := New(Limit{Requests: 2, Per: time.Minute})
+
+	for i, expectedRemaining := range []int{1, 0} {
+		result := limiter.Allow("1.2.3.4", start)
+		if !result.Allowed || result.Remaining != expectedRemaining || result.Limit != 2 {
+			t.Errorf("Expected request %d to be allowed with %d remaining, got %#v", i, expectedRemaining, result)
+		}
+	}
+
+	result := limiter.Allow("1.2.3.4", start)
+	if result.Allowed {
+		t.Error("Expected the third request in a burst to be limited")
+	}
+	if result.RetryAfter != 30*time.Second {
+		t.Errorf("Expected to retry after a token refills in 30s, got %s", result.RetryAfter)
+	}
+	if result.Reset != time.Minute {
+		t.Errorf("Expected bucket to be full again in 1m, got %s", result.Reset)
+	}
+
+	result = limiter.Allow("5.6.7.8", start)
+	if !result.Allowed {
+		t.Error("Expected other keys to have their own bucket")
+	}
+
+	result = limiter.Allow("1.2.3.4", start.Add(30*time.Second))
+	if !result.Allowed {
+		t.Error("Expected a token to have refilled after 30s")
+	}
+
+	evicted := limiter.Evict(start.Add(time.Minute))
+	if evicted != 1 || limiter.Len() != 1 {
+		t.Errorf("Expected only the refilled bucket to be evicted, evicted %d leaving %d", evicted, limiter.Len())
+	}
+	evicted = limiter.Evict(start.Add(2 * time.Minute))
+	if evicted != 1 || limiter.Len() != 0 {
+		t.Errorf("Expected every bucket to be evicted once idle, evicted %d leaving %d", evicted, limiter.Len())
+	}
+
+	unlimited := New(Limit{})
+	for i := 0; i < 100; i++ {
+		if !unlimited.Allow("1.2.3.4", start).Allowed {
+			t.Fatal("Expected an unlimited limiter to allow everything")
+		}
+	}
+}
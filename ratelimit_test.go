@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/gorilla/mux"
+)
+
+func Test_RateLimited(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+	cfg := testConfig()
+	cfg.RateLimits.Comments = "1/1m"
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := db.CreateBlogPost(context.Background(), inMemDB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	r := mux.NewRouter()
+	r.Use(sessionMiddleware)
+	r.HandleFunc("/blog/{id}/comment", server.rateLimited("comments", createBlogCommentHandler))
+
+	cookie := loginAs(t, "Sonic")
+	cases := []struct {
+		remoteAddr         string
+		cookie             *http.Cookie
+		expectedStatusCode int
+		expectedRemaining  string
+	}{
+		{"1.2.3.4:1234", nil, http.StatusOK, "0"},
+		{"1.2.3.4:5678", nil, http.StatusTooManyRequests, "0"},
+		{"5.6.7.8:1234", nil, http.StatusOK, "0"},
+		//logged in users have their own bucket, wherever they come from
+		{"1.2.3.4:1234", cookie, http.StatusOK, "0"},
+		{"5.6.7.8:1234", cookie, http.StatusTooManyRequests, "0"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog/"+id+"/comment", strings.NewReader("{\"AuthorName\": \"Anony Mouse\",\"CommentText\": \"first!\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		req.RemoteAddr = c.remoteAddr
+		if c.cookie != nil {
+			req.AddCookie(c.cookie)
+		}
+
+		r.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d from %s, got %d", c.expectedStatusCode, c.remoteAddr, rec.Code)
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "1" || rec.Header().Get("X-RateLimit-Remaining") != c.expectedRemaining {
+			t.Errorf("Expected rate limit headers, got %v", rec.Header())
+		}
+		if rec.Code != http.StatusTooManyRequests {
+			continue
+		}
+
+		if rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("Expected to retry after 60 seconds, got %q", rec.Header().Get("Retry-After"))
+		}
+		var actualResponse Response
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		if actualResponse.Error == "" {
+			t.Error("Expected an error in the response")
+		}
+	}
+}
+
+func Test_ClientIP(t *testing.T) {
+	cfg := testConfig()
+	cfg.Features.TrustProxyHeaders = true
+	trusting, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusting, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		server     *Server
+		remoteAddr string
+		forwarded  []string
+		expectedIP string
+	}{
+		{trusting, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{trusting, "10.0.0.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		//whatever the client put in front of what the proxy added is ignored
+		{trusting, "10.0.0.1:1234", []string{"6.6.6.6, 203.0.113.7"}, "203.0.113.7"},
+		{trusting, "10.0.0.1:1234", []string{"6.6.6.6", "203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{trusting, "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{trusting, "10.0.0.1:1234", []string{"203.0.113.7, nonsense"}, "10.0.0.1"},
+		//only proxies are believed
+		{trusting, "198.51.100.1:1234", []string{"203.0.113.7"}, "198.51.100.1"},
+		{untrusting, "10.0.0.1:1234", []string{"203.0.113.7"}, "10.0.0.1"},
+	}
+	for _, c := range cases {
+		var actualIP string
+		handler := servedBy(c.server, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			actualIP = clientIP(req)
+		}))
+		req, err := http.NewRequest(http.MethodGet, "/blog", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = c.remoteAddr
+		for _, forwarded := range c.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if actualIP != c.expectedIP {
+			t.Errorf("Expected %s from %s forwarded for %v, got %s", c.expectedIP, c.remoteAddr, c.forwarded, actualIP)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/logging"
+	"github.com/segmentio/ksuid"
+)
+
+const requestIDContextKey = contextKey("requestID")
+
+const requestIDHeader = "X-Request-ID"
+
+//client supplied request IDs longer than this are replaced
+const maxRequestIDLength = 128
+
+//currentRequestID returns the ID of the request ctx belongs to, or "" outside of one
+func currentRequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+//checks a client supplied request ID is safe to log and echo back
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//requestIDMiddleware tags req with its X-Request-ID, generating one if the client didn't send a usable one, and echoes it in the response
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = ksuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDContextKey, requestID)))
+	})
+}
+
+//statusRecorder remembers the status and size of a response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+//accessLog logs every request once it has been served, with its status and how long it took.
+//Server errors are logged at error level, everything else at info
+func accessLog(next http.Handler) http.Handler {
+	const funcname = "accessLog"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, req)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		fields := logging.Fields{
+			"method":      req.Method,
+			"path":        req.URL.Path,
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote_ip":   clientIP(req),
+			"user_agent":  req.UserAgent(),
+		}
+		if len(req.URL.RawQuery) > 0 {
+			fields["query"] = logging.RedactQuery(req.URL.Query())
+		}
+		level := config.LogLevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = config.LogLevelError
+		}
+		logAt(req.Context(), level, funcname, "Served request", fields)
+	})
+}
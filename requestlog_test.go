@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+//captures everything logged until the returned func is called
+func captureLogs() (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	logger.SetOutput(buf)
+	return buf, func() {
+		logger.SetOutput(os.Stdout)
+	}
+}
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]interface{}
+		err := dec.Decode(&line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func Test_RequestID(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		sent       string
+		keepsValue bool
+	}{
+		{"sonic-123", true},
+		{"", false},
+		{"has spaces\r\nand newlines", false},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, c := range cases {
+		buf, restore := captureLogs()
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/blog/missing", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if c.sent != "" {
+			req.Header.Set(requestIDHeader, c.sent)
+		}
+		server.ServeHTTP(rec, req)
+		restore()
+
+		requestID := rec.Header().Get(requestIDHeader)
+		if c.keepsValue && requestID != c.sent {
+			t.Errorf("Expected request ID %q to be echoed, got %q", c.sent, requestID)
+		}
+		if !c.keepsValue && (requestID == "" || requestID == c.sent) {
+			t.Errorf("Expected request ID %q to be replaced, got %q", c.sent, requestID)
+		}
+
+		lines := decodeLogLines(t, buf)
+		if len(lines) < 2 {
+			t.Fatalf("Expected the handler's error and the access log, got %#v", lines)
+		}
+		for _, line := range lines {
+			if line["request_id"] != requestID {
+				t.Errorf("Expected every log line to have request ID %q, got %#v", requestID, line)
+			}
+		}
+		accessLine := lines[len(lines)-1]
+		if accessLine["func"] != "accessLog" || accessLine["status"] != float64(http.StatusNotFound) || accessLine["path"] != "/blog/missing" {
+			t.Errorf("Expected an access log line for the 404, got %#v", accessLine)
+		}
+		if _, ok := accessLine["duration_ms"].(float64); !ok {
+			t.Errorf("Expected the access log to have the latency, got %#v", accessLine)
+		}
+	}
+}
+
+func Test_AccessLog_Redaction(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, restore := captureLogs()
+	defer restore()
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/auth/verify-email?token=sonic.secret", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	server.ServeHTTP(rec, req)
+
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodPost, "/auth/register", strings.NewReader("{\"Username\":\"sonic\",\"DisplayName\":\"Sonic\",\"Password\":\"chilidogs\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	server.ServeHTTP(rec, req)
+
+	logged := buf.String()
+	for _, secret := range []string{"sonic.secret", "chilidogs"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Expected %q not to be logged, got %s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, "token=%5BREDACTED%5D") {
+		t.Errorf("Expected the token query parameter to be redacted, got %s", logged)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/jwt"
+	"github.com/aschereT/ea-gaming-review/mailer"
+	"github.com/aschereT/ea-gaming-review/notify"
+	"github.com/aschereT/ea-gaming-review/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serverContextKey = contextKey("server")
+
+//the config handlers see when they aren't running in a Server
+var defaultConfig = config.Default()
+
+//Server is one instance of the API, owning its routes and store, so several can run in one process
+type Server struct {
+	Config config.Config
+	DB     *db.DB
+	Router *mux.Router
+	//what is exposed at /metrics
+	Metrics *prometheus.Registry
+
+	handler         http.Handler
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	//serves Metrics in whichever Prometheus format the scraper asks for
+	metricsHandler http.Handler
+	dbTxns         *prometheus.CounterVec
+	dbAbortedTxns  prometheus.Counter
+	dbTxnDuration  *prometheus.HistogramVec
+
+	//keys bearer tokens can be signed with, from Config.JWT
+	jwtKeys *jwt.Keyset
+	//limiters for each group of rate limited routes, by the name the routes were registered with
+	rateLimiters map[string]*ratelimit.Limiter
+	//proxies X-Forwarded-For is believed from, from Config.TrustedProxies
+	trustedProxies []*net.IPNet
+	//clients negotiating an older TLS version than Config.TLS.MinVersion are turned away
+	tlsMinVersion uint16
+	//sends verification emails, from Config.Mail
+	mailer mailer.Mailer
+	//signs email verification tokens
+	emailTokenSecret []byte
+	//where the notification dispatcher delivers to, from Config.Notifications
+	deliverer notify.Deliverer
+	//exports request and db spans, from Config.Tracing. nil when tracing is off
+	tracerProvider *sdktrace.TracerProvider
+	//what the file trace exporter writes to, closed once tracerProvider has exported the last spans
+	traceFile *os.File
+
+	mu           sync.Mutex
+	httpServers  []*http.Server
+	shuttingDown bool
+	//closed to tell background jobs to stop
+	stop     chan struct{}
+	stopOnce sync.Once
+	jobs     sync.WaitGroup
+}
+
+//NewServer sets up a Server with an empty store
+func NewServer(cfg config.Config) (*Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var store *db.DB
+	switch cfg.Storage {
+	case config.StorageMemory:
+		store, err = db.CreateDB()
+	default:
+		err = fmt.Errorf("Unsupported storage %s", cfg.Storage)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Config: cfg, DB: store, Router: mux.NewRouter(), stop: make(chan struct{})}
+	s.jwtKeys, err = newKeyset(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+	s.rateLimiters, err = newRateLimiters(cfg.RateLimits)
+	if err != nil {
+		return nil, err
+	}
+	s.trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	s.tlsMinVersion, err = parseTLSVersion(cfg.TLS.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	s.mailer, err = newMailer(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	s.emailTokenSecret, err = newEmailTokenSecret(cfg.EmailVerification.Secret)
+	if err != nil {
+		return nil, err
+	}
+	s.deliverer, err = newDeliverer(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	err = s.openAuditLog()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AdminAPIKey != "" {
+		_, err = db.RegisterAPIKey(context.Background(), s.DB, db.SystemActor, "bootstrap admin", cfg.AdminAPIKey, []string{db.ScopeAdmin}, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.tracerProvider, s.traceFile, err = newTracerProvider(cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setupMetrics()
+	s.routes()
+	s.handler = requestIDMiddleware(s.traceRequests(accessLog(s.instrument(corsMiddleware(cfg.CORS, s.Router)))))
+	return s, nil
+}
+
+func (s *Server) routes() {
+	r := s.Router
+	r.Use(cacheResponse, compressResponse, negotiateResponse, limitRequestBody, decodeRequestBody, sessionMiddleware, csrfMiddleware, apiKeyMiddleware, s.validateRequestMiddleware)
+	r.HandleFunc("/health", healthCheckHandler).Methods(http.MethodGet)
+	r.Handle("/metrics", s.metricsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods(http.MethodGet)
+	r.HandleFunc("/docs", docsHandler).Methods(http.MethodGet)
+
+	s.v1Routes(r.PathPrefix("/v1").Subrouter())
+	//the routes from before versioning, until their sunset
+	legacy := r.NewRoute().Subrouter()
+	legacy.Use(deprecated(unversionedDeprecatedAt, unversionedSunsetAt, "/v1"))
+	s.v1Routes(legacy)
+}
+
+//v1Routes registers version 1 of the API on api. Later versions get their own func, sharing handlers and db calls where their responses haven't changed
+func (s *Server) v1Routes(api *mux.Router) {
+	api.HandleFunc("/auth/register", s.rateLimited("auth", registerHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/auth/login", s.rateLimited("auth", loginHandler)).Methods(http.MethodPost)
+	api.HandleFunc("/auth/logout", logoutHandler).Methods(http.MethodPost)
+	api.HandleFunc("/auth/csrf", csrfTokenHandler).Methods(http.MethodGet)
+	api.HandleFunc("/auth/verify-email", s.verifyEmailHandler).Methods(http.MethodGet)
+
+	//API keys need the scope a route is registered with
+	scoped := func(scope string, handler http.HandlerFunc) http.Handler {
+		return requireScope(scope, handler)
+	}
+	//mutating blog routes, and routes which need to know who is asking, also go through bearer token auth
+	protected := func(scope string, handler http.HandlerFunc) http.Handler {
+		return s.bearerAuthMiddleware(requireScope(scope, handler))
+	}
+	//admins can be logged in, or have a bearer token or an API key with the admin scope
+	admin := func(handler http.HandlerFunc) http.Handler {
+		return s.bearerAuthMiddleware(requireAdmin(handler))
+	}
+
+	api.Handle("/blog", scoped(db.ScopeRead, getBlogPostsIDsHandler)).Methods(http.MethodGet)
+	api.Handle("/blog", protected(db.ScopePostsWrite, s.rateLimited("posts", createBlogPostHandler))).Methods(http.MethodPost)
+
+	api.Handle("/blog/{id}", scoped(db.ScopeRead, getSingleBlogPostHandler)).Methods(http.MethodGet)
+	api.Handle("/blog/{id}", protected(db.ScopePostsWrite, deleteBlogPostHandler)).Methods(http.MethodDelete)
+	api.Handle("/blog/{id}/commentstate", protected(db.ScopeCommentsModerate, setCommentStateHandler)).Methods(http.MethodPut)
+
+	api.Handle("/blog/{id}/comment", scoped(db.ScopeRead, getBlogCommentsIDsHandler)).Methods(http.MethodGet)
+	api.Handle("/blog/{id}/comment", protected(db.ScopeCommentsWrite, s.rateLimited("comments", createBlogCommentHandler))).Methods(http.MethodPost)
+
+	api.Handle("/blog/{id}/comment/{commentID}", scoped(db.ScopeRead, getSingleBlogCommentHandler)).Methods(http.MethodGet)
+	api.Handle("/blog/{id}/comment/{commentID}", protected(db.ScopeCommentsModerate, deleteBlogCommentHandler)).Methods(http.MethodDelete)
+	api.Handle("/blog/{id}/comment/{commentID}", protected(db.ScopeCommentsWrite, s.rateLimited("comments", editBlogCommentHandler))).Methods(http.MethodPatch)
+	api.Handle("/blog/{id}/comment/{commentID}/history", protected(db.ScopeCommentsModerate, getCommentRevisionsHandler)).Methods(http.MethodGet)
+
+	api.Handle("/blog/{id}/comment/{commentID}/flag", protected(db.ScopeCommentsWrite, s.rateLimited("flags", flagBlogCommentHandler))).Methods(http.MethodPost)
+	api.Handle("/blog/{id}/comment/{commentID}/flag", protected(db.ScopeCommentsModerate, clearBlogCommentFlagsHandler)).Methods(http.MethodDelete)
+
+	api.Handle("/moderation/flagged", protected(db.ScopeCommentsModerate, getFlaggedCommentsHandler)).Methods(http.MethodGet)
+
+	api.Handle("/authors", scoped(db.ScopeRead, getAuthorsHandler)).Methods(http.MethodGet)
+	api.Handle("/authors/{name}", scoped(db.ScopeRead, getAuthorHandler)).Methods(http.MethodGet)
+	api.Handle("/authors/{name}/posts", scoped(db.ScopeRead, getAuthorPostsHandler)).Methods(http.MethodGet)
+	api.Handle("/authors/{name}/comments", scoped(db.ScopeRead, getAuthorCommentsHandler)).Methods(http.MethodGet)
+
+	api.Handle("/notifications", protected(db.ScopeRead, getNotificationsHandler)).Methods(http.MethodGet)
+
+	api.Handle("/admin/apikeys", admin(getAPIKeysHandler)).Methods(http.MethodGet)
+	api.Handle("/admin/apikeys", admin(createAPIKeyHandler)).Methods(http.MethodPost)
+	api.Handle("/admin/apikeys/{keyID}", admin(revokeAPIKeyHandler)).Methods(http.MethodDelete)
+	api.Handle("/admin/users/{username}/role", admin(setUserRoleHandler)).Methods(http.MethodPut)
+	api.Handle("/admin/audit", admin(getAuditEntriesHandler)).Methods(http.MethodGet)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), serverContextKey, s)))
+}
+
+//HTTPServer is an http.Server serving s with the configured address and timeouts
+func (s *Server) HTTPServer() *http.Server {
+	return &http.Server{
+		Addr:         s.Config.Addr,
+		Handler:      s,
+		ReadTimeout:  s.Config.ReadTimeout.Duration,
+		WriteTimeout: s.Config.WriteTimeout.Duration,
+		IdleTimeout:  s.Config.IdleTimeout.Duration,
+	}
+}
+
+//Go runs job in the background until the server shuts down, when stop is closed. Shutdown waits for it to return
+func (s *Server) Go(job func(stop <-chan struct{})) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		job(s.stop)
+	}()
+}
+
+//track remembers servers so Shutdown can stop them, failing if it already has
+func (s *Server) track(servers ...*http.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown {
+		return http.ErrServerClosed
+	}
+	s.httpServers = append(s.httpServers, servers...)
+	return nil
+}
+
+//ListenAndServe serves s on the configured address until it fails or is shut down, when it returns http.ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Config.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+//Serve serves s on ln, over TLS if a certificate is configured
+func (s *Server) Serve(ln net.Listener) error {
+	const funcname = "Server.Serve"
+	httpServer := s.HTTPServer()
+	if !s.Config.TLS.Enabled() {
+		err := s.track(httpServer)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		log(context.Background(), funcname, "server up, listening at", ln.Addr())
+		return httpServer.Serve(ln)
+	}
+
+	reloader, err := newCertReloader(s.Config.TLS.CertFile, s.Config.TLS.KeyFile)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	httpServer.TLSConfig = tlsConfig(reloader, s.tlsMinVersion)
+	var redirect *http.Server
+	if s.Config.TLS.RedirectAddr != "" {
+		redirect = &http.Server{
+			Addr:         s.Config.TLS.RedirectAddr,
+			Handler:      redirectToHTTPS(ln.Addr().String()),
+			ReadTimeout:  s.Config.ReadTimeout.Duration,
+			WriteTimeout: s.Config.WriteTimeout.Duration,
+			IdleTimeout:  s.Config.IdleTimeout.Duration,
+		}
+		err = s.track(httpServer, redirect)
+	} else {
+		err = s.track(httpServer)
+	}
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	s.Go(func(stop <-chan struct{}) {
+		reloader.watch(time.Duration(s.Config.TLS.ReloadIntervalSeconds)*time.Second, stop)
+	})
+	if redirect != nil {
+		go func() {
+			log(context.Background(), funcname, "redirecting HTTP at", redirect.Addr, "to HTTPS")
+			err := redirect.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				logError(context.Background(), funcname, err)
+			}
+		}()
+	}
+
+	log(context.Background(), funcname, "server up, listening with TLS at", ln.Addr())
+	return httpServer.ServeTLS(ln, "", "")
+}
+
+//Shutdown stops accepting connections and waits for in-flight requests to finish, then stops background jobs and waits for them to flush,
+//then exports the last spans. If ctx is done first, the remaining connections are closed and an error is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	servers := s.httpServers
+	s.mu.Unlock()
+
+	var shutdownErr error
+	for _, httpServer := range servers {
+		err := httpServer.Shutdown(ctx)
+		if err != nil {
+			httpServer.Close()
+			if shutdownErr == nil {
+				shutdownErr = fmt.Errorf("Error draining connections: %w", err)
+			}
+		}
+	}
+
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	finished := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		if shutdownErr == nil {
+			shutdownErr = fmt.Errorf("Background jobs didn't finish: %w", ctx.Err())
+		}
+	}
+
+	if s.tracerProvider != nil {
+		err := s.tracerProvider.Shutdown(ctx)
+		if err != nil && shutdownErr == nil {
+			shutdownErr = fmt.Errorf("Error exporting spans: %w", err)
+		}
+	}
+	if s.traceFile != nil {
+		err := s.traceFile.Close()
+		if err != nil && shutdownErr == nil {
+			shutdownErr = fmt.Errorf("Error closing trace file: %w", err)
+		}
+	}
+	return shutdownErr
+}
+
+//currentServer is the Server handling req, or nil outside of one, eg when tests call handlers directly
+func currentServer(req *http.Request) *Server {
+	s, _ := req.Context().Value(serverContextKey).(*Server)
+	return s
+}
+
+//currentConfig is the config of the Server handling req, or the defaults outside of one
+func currentConfig(req *http.Request) config.Config {
+	if s := currentServer(req); s != nil {
+		return s.Config
+	}
+	return defaultConfig
+}
+
+//currentDB is the store of the Server handling req, or inMemDB outside of one
+func currentDB(req *http.Request) *db.DB {
+	if s := currentServer(req); s != nil {
+		return s.DB
+	}
+	return inMemDB
+}
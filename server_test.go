@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/jwt"
+)
+
+//testConfig is the default config with the audit log kept in memory, so tests don't write audit.jsonl
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.AuditLogFile = ""
+	return cfg
+}
+
+//servedBy runs next as if s was serving it, for tests that build their own router but need s's config
+func servedBy(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), serverContextKey, s)))
+	})
+}
+
+func Test_Server(t *testing.T) {
+	first, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	cfg.MaxBodyBytes = 16
+	second, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//each server goes by its own config
+	for server, expected := range map[*Server]int{first: http.StatusOK, second: http.StatusRequestEntityTooLarge} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}"))
+		if err != nil {
+			t.Error(err)
+		}
+		server.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Fatalf("Expected status code %d creating a post, got %d", expected, rec.Code)
+		}
+	}
+
+	//each server only sees its own store
+	for server, expected := range map[*Server]int{first: 1, second: 0} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, "/blog", nil)
+		if err != nil {
+			t.Error(err)
+		}
+		server.ServeHTTP(rec, req)
+		var actualResponse expectedResponseIDs
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(actualResponse.Data.IDs) != expected {
+			t.Errorf("Expected %d posts, got %v", expected, actualResponse.Data.IDs)
+		}
+	}
+}
+
+func Test_Server_BearerAuthRoutes(t *testing.T) {
+	key := jwt.Key{ID: "test-1", Algorithm: jwt.AlgorithmHS256, Secret: []byte(strings.Repeat("s", 32))}
+	cfg := testConfig()
+	cfg.JWT.Keys = "test-1:HS256:" + base64.StdEncoding.EncodeToString(key.Secret)
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.CreateBlogPost(context.Background(), server.DB, db.SystemActor, db.BlogPost{Title: "I've come to make an announcement", ArticleText: "walnut moon", AuthorName: "Dr. Eggman"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := db.CreateBlogComment(context.Background(), server.DB, db.SystemActor, db.BlogComment{ArticleID: id, AuthorName: "Sonic", CommentText: "first!"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenWithRole := func(role string) string {
+		token, err := jwt.Sign(jwt.Claims{Subject: "sso-" + role, Role: role, ExpiresAt: time.Now().Add(time.Hour).Unix()}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	editor := tokenWithRole(db.RoleEditor)
+	admin := tokenWithRole(db.RoleAdmin)
+
+	cases := []struct {
+		path               string
+		token              string
+		expectedStatusCode int
+	}{
+		{"/blog/" + id + "/comment/" + commentID + "/history", "", http.StatusUnauthorized},
+		{"/blog/" + id + "/comment/" + commentID + "/history", editor, http.StatusOK},
+		{"/moderation/flagged", "", http.StatusUnauthorized},
+		{"/moderation/flagged", editor, http.StatusOK},
+		{"/admin/audit", editor, http.StatusForbidden},
+		{"/admin/audit", admin, http.StatusOK},
+		{"/admin/apikeys", admin, http.StatusOK},
+		{"/v1/admin/apikeys", admin, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodGet, c.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d from %s, got %d: %s", c.expectedStatusCode, c.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func Test_NewServer_Config(t *testing.T) {
+	cfg := testConfig()
+	cfg.Addr = ":9090"
+	cfg.ReadTimeout = config.Duration{Duration: 5 * time.Second}
+	cfg.AdminAPIKey = "bootstrap-admin-key"
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := server.HTTPServer()
+	if httpServer.Addr != ":9090" || httpServer.ReadTimeout != 5*time.Second || httpServer.Handler != server {
+		t.Errorf("Expected the http.Server to use the config, got %#v", httpServer)
+	}
+	apiKey, err := db.AuthenticateAPIKey(context.Background(), server.DB, "bootstrap-admin-key")
+	if err != nil || apiKey == nil || !apiKey.HasScope(db.ScopeAdmin) {
+		t.Errorf("Expected the admin API key to be registered, got %#v, %v", apiKey, err)
+	}
+
+	cfg.Storage = "postgres"
+	_, err = NewServer(cfg)
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported storage backend")
+	}
+}
+
+func Test_Server_Shutdown(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//a request that is still running when shutdown starts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.Router.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	flushed := false
+	server.Go(func(stop <-chan struct{}) {
+		<-stop
+		flushed = true
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+
+	slowResponse := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			slowResponse <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		slowResponse <- string(body)
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- server.Shutdown(context.Background())
+	}()
+	err = <-serveErr
+	if err != http.ErrServerClosed {
+		t.Errorf("Expected Serve to return %v once shutting down, got %v", http.ErrServerClosed, err)
+	}
+	_, err = http.Get("http://" + ln.Addr().String() + "/health")
+	if err == nil {
+		t.Errorf("Expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if body := <-slowResponse; body != "done" {
+		t.Errorf("Expected the in-flight request to finish, got %q", body)
+	}
+	err = <-shutdownErr
+	if err != nil {
+		t.Error(err)
+	}
+	if !flushed {
+		t.Errorf("Expected background jobs to finish before Shutdown returned")
+	}
+}
+
+func Test_Server_Shutdown_Deadline(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	server.Go(func(stop <-chan struct{}) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err == nil {
+		t.Errorf("Expected an error when background jobs outlive the deadline")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Serve(ln)
+	if err != http.ErrServerClosed {
+		t.Errorf("Expected Serve after Shutdown to return %v, got %v", http.ErrServerClosed, err)
+	}
+}
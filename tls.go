@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//parseTLSVersion reads a TLS version such as 1.2
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("TLS version should be one of 1.0, 1.1, 1.2 or 1.3, got %s", version)
+}
+
+//certReloader serves a certificate loaded from disk, picking up changes to the files so certificates can be rotated without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	_, err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func modTime(path string) (time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+//reload loads the certificate again if either file changed since it was last loaded.
+//If the new files don't make a valid certificate the old one is kept
+func (c *certReloader) reload() (reloaded bool, err error) {
+	certMod, err := modTime(c.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyMod, err := modTime(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && certMod.Equal(c.certMod) && keyMod.Equal(c.keyMod)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.certMod = certMod
+	c.keyMod = keyMod
+	return true, nil
+}
+
+//GetCertificate is for tls.Config
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+//periodically checks the certificate files for changes, until stop is closed
+func (c *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	const funcname = "certReloader.watch"
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := c.reload()
+		if err != nil {
+			logError(context.Background(), funcname, fmt.Errorf("Error reloading certificate, keeping the old one: %w", err))
+		}
+		if reloaded {
+			log(context.Background(), funcname, "Reloaded certificate from", c.certFile)
+		}
+	}
+}
+
+//tlsConfig serves certificates from reloader over HTTP/2 or HTTP/1.1
+func tlsConfig(reloader *certReloader, minVersion uint16) *tls.Config {
+	return &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     minVersion,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+//redirectToHTTPS sends plain HTTP requests to the same URL over HTTPS on httpsAddr's port
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			host = req.Host
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		//308 rather than 301 so clients keep the method and body
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//writes a self-signed certificate with the given serial number to certFile and its key to keyFile, stamped with modified
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64, modified time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{certFile, keyFile} {
+		err = os.Chtimes(path, modified, modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func servedSerial(t *testing.T, reloader *certReloader) int64 {
+	cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.SerialNumber.Int64()
+}
+
+func Test_CertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	issuedAt := time.Date(2020, time.March, 30, 7, 34, 23, 0, time.UTC)
+	writeTestCert(t, certFile, keyFile, 1, issuedAt)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, reloader); serial != 1 {
+		t.Errorf("Expected certificate 1, got %d", serial)
+	}
+	reloaded, err := reloader.reload()
+	if err != nil || reloaded {
+		t.Errorf("Expected nothing to reload when the files haven't changed, got %t, %v", reloaded, err)
+	}
+
+	writeTestCert(t, certFile, keyFile, 2, issuedAt.Add(time.Hour))
+	reloaded, err = reloader.reload()
+	if err != nil || !reloaded {
+		t.Errorf("Expected the rotated certificate to be reloaded, got %t, %v", reloaded, err)
+	}
+	if serial := servedSerial(t, reloader); serial != 2 {
+		t.Errorf("Expected certificate 2, got %d", serial)
+	}
+
+	//a half written certificate shouldn't take the server down
+	err = ioutil.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(certFile, issuedAt.Add(2*time.Hour), issuedAt.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reloader.reload()
+	if err == nil {
+		t.Errorf("Expected an error reloading an invalid certificate")
+	}
+	if serial := servedSerial(t, reloader); serial != 2 {
+		t.Errorf("Expected to keep serving certificate 2, got %d", serial)
+	}
+
+	config := tlsConfig(reloader, tls.VersionTLS12)
+	if config.MinVersion != tls.VersionTLS12 || len(config.NextProtos) == 0 || config.NextProtos[0] != "h2" {
+		t.Errorf("Expected TLS 1.2 or newer preferring HTTP/2, got %#v", config)
+	}
+}
+
+func Test_ParseTLSVersion(t *testing.T) {
+	version, err := parseTLSVersion("1.3")
+	if err != nil || version != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got %x, %v", version, err)
+	}
+	_, err = parseTLSVersion("SSLv3")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown TLS version")
+	}
+}
+
+func Test_RedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		host      string
+		target    string
+		expected  string
+	}{
+		{":443", "reviews.example.com", "/blog?offset=20", "https://reviews.example.com/blog?offset=20"},
+		{":8443", "reviews.example.com:8080", "/blog/1", "https://reviews.example.com:8443/blog/1"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "http://"+test.host+test.target, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		redirectToHTTPS(test.httpsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected status code %d, got %d", http.StatusPermanentRedirect, rec.Code)
+		}
+		if location := rec.Header().Get("Location"); location != test.expected {
+			t.Errorf("Expected redirect to %s, got %s", test.expected, location)
+		}
+	}
+}
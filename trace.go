@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//the instrumentation name request spans are recorded under
+const tracerName = "github.com/aschereT/ea-gaming-review"
+
+//how many finished spans are held between exports before new ones are dropped
+const maxQueuedSpans = 10000
+
+//requests continue the trace in their W3C traceparent and tracestate headers
+var tracePropagator = propagation.TraceContext{}
+
+//newTracerProvider exports spans where cfg says, batching them up for its export interval. nil means tracing is off.
+//file is what the file exporter writes to, to close once the provider is shut down
+func newTracerProvider(cfg config.Tracing) (provider *sdktrace.TracerProvider, file *os.File, err error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case config.TraceExporterNone:
+		return nil, nil, nil
+	case config.TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TraceExporterFile:
+		file, err = os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		}
+	case config.TraceExporterOTLP:
+		//the endpoint and headers come from the standard OTEL_EXPORTER_OTLP_* variables
+		exporter, err = otlptracehttp.New(context.Background())
+	default:
+		err = fmt.Errorf("Unknown trace exporter %s", cfg.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, nil, err
+	}
+
+	service, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(cfg.ExportInterval.Duration), sdktrace.WithMaxQueueSize(maxQueuedSpans)),
+		sdktrace.WithResource(service),
+	), file, nil
+}
+
+//tracer records s's request spans with its own provider, or the global one when tracing isn't configured
+func (s *Server) tracer() trace.Tracer {
+	if s.tracerProvider != nil {
+		return s.tracerProvider.Tracer(tracerName)
+	}
+	return otel.Tracer(tracerName)
+}
+
+//traceRequests gives every request a server span named after its route, continuing the trace in its traceparent header if it has one
+func (s *Server) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := tracePropagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		route := routeTemplate(s.Router, req)
+		ctx, span := s.tracer().Start(ctx, req.Method+" "+route, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", req.URL.Path),
+			attribute.String("request_id", currentRequestID(ctx)),
+		)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, req.WithContext(ctx))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("Responded %d", recorder.status))
+		}
+	})
+}
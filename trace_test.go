@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Test_TraceRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, restore := captureLogs()
+	defer restore()
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"I've come to make an announcement\",\"ArticleText\":\"walnut moon\",\"AuthorName\":\"Dr. Eggman\"}"))
+	if err != nil {
+		t.Error(err)
+	}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var serverSpan, dbSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "POST /blog":
+			serverSpan = span
+		case "db.CreateBlogPost":
+			dbSpan = span
+		}
+	}
+	if serverSpan == nil || dbSpan == nil {
+		t.Fatalf("Expected a server span and a db span, got %#v", recorder.Ended())
+	}
+	if serverSpan.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || serverSpan.Parent().SpanID().String() != "00f067aa0ba902b7" || serverSpan.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected the server span to continue the propagated trace, got %#v", serverSpan)
+	}
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range serverSpan.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	if attributes["http.route"].AsString() != "/blog" || attributes["http.status_code"].AsInt64() != http.StatusOK {
+		t.Errorf("Expected the server span to have the route and status, got %#v", serverSpan.Attributes())
+	}
+	if dbSpan.SpanContext().TraceID() != serverSpan.SpanContext().TraceID() || dbSpan.Parent().SpanID() != serverSpan.SpanContext().SpanID() {
+		t.Errorf("Expected the db span to be a child of the server span, got %#v", dbSpan)
+	}
+
+	for _, line := range decodeLogLines(t, buf) {
+		if line["trace_id"] != serverSpan.SpanContext().TraceID().String() {
+			t.Errorf("Expected every log line to have the trace ID, got %#v", line)
+		}
+	}
+}
+
+func Test_TraceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig()
+	cfg.Tracing.Exporter = config.TraceExporterFile
+	cfg.Tracing.File = filepath.Join(dir, "traces.jsonl")
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodGet, "/blog", nil)
+	if err != nil {
+		t.Error(err)
+	}
+	server.ServeHTTP(rec, req)
+
+	err = server.Shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the spans are exported on shutdown, then the file is closed
+	raw, err := ioutil.ReadFile(cfg.Tracing.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"Name":"GET /blog"`) || !strings.Contains(string(raw), `"Name":"db.GetBlogIDs"`) {
+		t.Errorf("Expected the request and db spans in the trace file, got %s", raw)
+	}
+	_, err = server.traceFile.Write([]byte("\n"))
+	if !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Expected the trace file to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+//FieldError is a problem with a single field of a request
+type FieldError struct {
+	Field   string `json:"Field"`
+	Message string `json:"Message"`
+}
+
+//Errors are all the problems found with a request
+type Errors []FieldError
+
+//Add records a problem with field
+func (errs *Errors) Add(field, format string, a ...interface{}) {
+	*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+}
+
+//Error joins the messages of every problem
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, fieldErr := range errs {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+type rules struct {
+	required  bool
+	maxLength int
+	multiline bool
+	//the only values a string can have, if any are given
+	oneOf []string
+	//the smallest an int can be, if hasMin
+	min    int
+	hasMin bool
+}
+
+func parseRules(tag string) (r rules, err error) {
+	for _, rule := range strings.Split(tag, ",") {
+		switch {
+		case rule == "required":
+			r.required = true
+		case rule == "multiline":
+			r.multiline = true
+		case strings.HasPrefix(rule, "max="):
+			r.maxLength, err = strconv.Atoi(strings.TrimPrefix(rule, "max="))
+			if err != nil {
+				return r, fmt.Errorf("Bad max in validate tag %q: %w", tag, err)
+			}
+		case strings.HasPrefix(rule, "min="):
+			r.min, err = strconv.Atoi(strings.TrimPrefix(rule, "min="))
+			if err != nil {
+				return r, fmt.Errorf("Bad min in validate tag %q: %w", tag, err)
+			}
+			r.hasMin = true
+		case strings.HasPrefix(rule, "oneof="):
+			r.oneOf = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			if len(r.oneOf) == 0 {
+				return r, fmt.Errorf("Empty oneof in validate tag %q", tag)
+			}
+		default:
+			return r, fmt.Errorf("Unknown rule %q in validate tag %q", rule, tag)
+		}
+	}
+	return r, nil
+}
+
+//fieldName is the name a field has in JSON, which is what clients know it by
+func fieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+//String cleans up value and checks it against rules, adding any problems to errs under field.
+//Surrounding whitespace is trimmed and the text is normalised to NFC. Invalid UTF-8 and control characters are rejected, except for newlines and tabs in multiline fields
+func String(errs *Errors, field string, value *string, required bool, maxLength int, multiline bool) {
+	if !utf8.ValidString(*value) {
+		errs.Add(field, "%s should be valid UTF-8", field)
+		return
+	}
+	*value = norm.NFC.String(strings.TrimSpace(*value))
+
+	if *value == "" {
+		if required {
+			errs.Add(field, "%s should not be empty", field)
+		}
+		return
+	}
+	if maxLength > 0 && utf8.RuneCountInString(*value) > maxLength {
+		errs.Add(field, "%s should be at most %d characters", field, maxLength)
+	}
+	for _, r := range *value {
+		if multiline && (r == '\n' || r == '\t' || r == '\r') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			errs.Add(field, "%s should not contain control characters", field)
+			break
+		}
+	}
+}
+
+//Struct cleans up and checks every string and int field of the struct v points to that has a validate tag, like
+//	Title string `validate:"required,max=200"`
+//required fields can't be empty, max limits how many characters they can have, multiline fields can have newlines and tabs,
+//and oneof=a b c only allows the values listed. Int fields can have a min=N they can't go below.
+//Fields of embedded structs are checked too.
+//It panics if a tag is malformed, since that is a programming error
+func Struct(v interface{}) Errors {
+	errs := Errors{}
+	checkStruct(&errs, reflect.ValueOf(v).Elem())
+	return errs
+}
+
+func checkStruct(errs *Errors, value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			checkStruct(errs, value.Field(i))
+			continue
+		}
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || (field.Type.Kind() != reflect.String && field.Type.Kind() != reflect.Int) {
+			continue
+		}
+		r, err := parseRules(tag)
+		if err != nil {
+			panic(err)
+		}
+		name := fieldName(field)
+
+		if field.Type.Kind() == reflect.Int {
+			if n := value.Field(i).Int(); r.hasMin && n < int64(r.min) {
+				if r.min == 0 {
+					errs.Add(name, "%s should not be negative", name)
+				} else {
+					errs.Add(name, "%s should be at least %d", name, r.min)
+				}
+			}
+			continue
+		}
+
+		str := value.Field(i).String()
+		before := len(*errs)
+		String(errs, name, &str, r.required, r.maxLength, r.multiline)
+		value.Field(i).SetString(str)
+		if len(*errs) == before && str != "" && len(r.oneOf) > 0 && !contains(r.oneOf, str) {
+			errs.Add(name, "%s should be one of %s", name, listOf(r.oneOf))
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//listOf joins values like a, b or c
+func listOf(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
@@ -0,0 +1,127 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type review struct {
+	Title       string `json:"Title" validate:"required,max=10"`
+	ArticleText string `json:"ArticleText" validate:"required,multiline"`
+	AuthorName  string `json:"AuthorName" validate:"max=5"`
+	Password    string `json:"Password"`
+}
+
+func Test_Struct(t *testing.T) {
+	cases := []struct {
+		input          review
+		expected       review
+		expectedErrors Errors
+	}{
+		{
+			review{Title: "  Sonic  ", ArticleText: "gotta go\n\tfast", Password: " secret "},
+			review{Title: "Sonic", ArticleText: "gotta go\n\tfast", Password: " secret "},
+			Errors{},
+		},
+		{
+			//e + combining acute accent is normalised to é
+			review{Title: "Poke\u0301mon", ArticleText: "gotta catch em all"},
+			review{Title: "Pok\u00e9mon", ArticleText: "gotta catch em all"},
+			Errors{},
+		},
+		{
+			review{Title: "   ", ArticleText: "", AuthorName: "Dr. Eggman"},
+			review{Title: "", ArticleText: "", AuthorName: "Dr. Eggman"},
+			Errors{
+				{Field: "Title", Message: "Title should not be empty"},
+				{Field: "ArticleText", Message: "ArticleText should not be empty"},
+				{Field: "AuthorName", Message: "AuthorName should be at most 5 characters"},
+			},
+		},
+		{
+			review{Title: "bell\a", ArticleText: "null\x00", AuthorName: "a\nb"},
+			review{Title: "bell\a", ArticleText: "null\x00", AuthorName: "a\nb"},
+			Errors{
+				{Field: "Title", Message: "Title should not contain control characters"},
+				{Field: "ArticleText", Message: "ArticleText should not contain control characters"},
+				{Field: "AuthorName", Message: "AuthorName should not contain control characters"},
+			},
+		},
+		{
+			review{Title: "\xff", ArticleText: "ok"},
+			review{Title: "\xff", ArticleText: "ok"},
+			Errors{{Field: "Title", Message: "Title should be valid UTF-8"}},
+		},
+	}
+	for _, c := range cases {
+		actual := c.input
+		errs := Struct(&actual)
+		if actual != c.expected {
+			t.Errorf("Expected %#v to be cleaned up to %#v, got %#v", c.input, c.expected, actual)
+		}
+		if !reflect.DeepEqual(errs, c.expectedErrors) {
+			t.Errorf("Expected errors %#v, got %#v", c.expectedErrors, errs)
+		}
+	}
+}
+
+func Test_Struct_Embedded(t *testing.T) {
+	actual := struct {
+		review
+		Email string `json:"Email" validate:"max=5"`
+	}{review: review{Title: " Sonic ", ArticleText: ""}, Email: "sonic@example.com"}
+	errs := Struct(&actual)
+	if actual.Title != "Sonic" {
+		t.Errorf("Expected the embedded Title to be cleaned up, got %q", actual.Title)
+	}
+	expectedErrors := Errors{
+		{Field: "ArticleText", Message: "ArticleText should not be empty"},
+		{Field: "Email", Message: "Email should be at most 5 characters"},
+	}
+	if !reflect.DeepEqual(errs, expectedErrors) {
+		t.Errorf("Expected errors %#v, got %#v", expectedErrors, errs)
+	}
+}
+
+func Test_Struct_OneOfAndMin(t *testing.T) {
+	type commentState struct {
+		State string `json:"State" validate:"required,oneof=open locked"`
+		Mode  string `json:"Mode" validate:"oneof=a b c"`
+		Days  int    `json:"Days" validate:"min=0"`
+		Limit int    `json:"Limit" validate:"min=1"`
+	}
+	cases := []struct {
+		input          commentState
+		expectedErrors Errors
+	}{
+		{commentState{State: " locked ", Limit: 1}, Errors{}},
+		{commentState{State: "open", Mode: "b", Days: 3, Limit: 5}, Errors{}},
+		{
+			commentState{State: "closed", Mode: "d", Days: -1, Limit: 0},
+			Errors{
+				{Field: "State", Message: "State should be one of open or locked"},
+				{Field: "Mode", Message: "Mode should be one of a, b or c"},
+				{Field: "Days", Message: "Days should not be negative"},
+				{Field: "Limit", Message: "Limit should be at least 1"},
+			},
+		},
+		{commentState{Limit: 1}, Errors{{Field: "State", Message: "State should not be empty"}}},
+	}
+	for _, c := range cases {
+		actual := c.input
+		errs := Struct(&actual)
+		if !reflect.DeepEqual(errs, c.expectedErrors) {
+			t.Errorf("Expected errors %#v for %#v, got %#v", c.expectedErrors, c.input, errs)
+		}
+	}
+}
+
+func Test_Errors(t *testing.T) {
+	errs := Errors{}
+	errs.Add("Title", "%s should not be empty", "Title")
+	errs.Add("ID", "ID should not be defined")
+	expected := "Title should not be empty; ID should not be defined"
+	if errs.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, errs.Error())
+	}
+}
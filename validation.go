@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+)
+
+//limitRequestBody rejects request bodies that are too big or aren't valid UTF-8, before any handler decodes them.
+//encoding/json would otherwise quietly replace invalid UTF-8 with U+FFFD
+func limitRequestBody(next http.Handler) http.Handler {
+	const funcname = "limitRequestBody"
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Body == nil || req.Body == http.NoBody {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		maxBodyBytes := currentConfig(req).MaxBodyBytes
+		body, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(maxBodyBytes)+1))
+		req.Body.Close()
+		if err != nil {
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusBadRequest, fmt.Errorf("Error reading request body"))
+			return
+		}
+		if len(body) > maxBodyBytes {
+			err = &apiError{message: fmt.Sprintf("Request body should be at most %d bytes", maxBodyBytes), details: map[string]interface{}{"MaxBytes": maxBodyBytes}}
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if f, ok := formatOf(req.Header.Get("Content-Type")); !(ok && f.binary) && !utf8.Valid(body) {
+			err = fmt.Errorf("Request body should be valid UTF-8")
+			logError(req.Context(), funcname, err)
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aschereT/ea-gaming-review/db"
+	"github.com/aschereT/ea-gaming-review/validate"
+)
+
+func Test_CreateBlogPost_ReportsEveryError(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"   \",\"ArticleText\":\"walnut\\u0000moon\",\"AuthorName\":\"\",\"CommentsCloseAfterDays\":-1}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	http.HandlerFunc(createBlogPostHandler).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	var actualResponse Response
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	expectedErrors := validate.Errors{
+		{Field: "Title", Message: "Title should not be empty"},
+		{Field: "ArticleText", Message: "ArticleText should not contain control characters"},
+		{Field: "CommentsCloseAfterDays", Message: "CommentsCloseAfterDays should not be negative"},
+		{Field: "AuthorName", Message: "AuthorName should not be empty"},
+	}
+	if !reflect.DeepEqual(actualResponse.Errors, expectedErrors) {
+		t.Errorf("Expected errors %#v, got %#v", expectedErrors, actualResponse.Errors)
+	}
+}
+
+func Test_CreateBlogPost_CleansUpFields(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/blog", strings.NewReader("{\"Title\":\"  Poke\\u0301mon review \",\"ArticleText\":\"gotta\\ncatch em all\\n\",\"AuthorName\":\" Ash \"}"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	http.HandlerFunc(createBlogPostHandler).ServeHTTP(rec, req)
+
+	var actualResponse expectedResponseCreateBlogPostOrComment
+	err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+	if err != nil {
+		t.Error(err)
+	}
+	post, err := db.GetBlogPost(context.Background(), inMemDB, actualResponse.Data.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if post == nil || post.Title != "Pokémon review" || post.ArticleText != "gotta\ncatch em all" || post.AuthorName != "Ash" {
+		t.Errorf("Expected post fields to be trimmed and normalised, got %#v", post)
+	}
+}
+
+func Test_LimitRequestBody(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxBodyBytes = 16
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := servedBy(server, limitRequestBody(http.HandlerFunc(healthCheckHandler)))
+	cases := []struct {
+		body               string
+		expectedStatusCode int
+	}{
+		{"{\"Title\":\"ok\"}", http.StatusOK},
+		{"{\"Title\":\"this is far too long\"}", http.StatusRequestEntityTooLarge},
+		{"{\"Title\":\"\xff\"}", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(http.MethodPost, "/health", strings.NewReader(c.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.expectedStatusCode {
+			t.Errorf("Expected status code %d for %q, got %d", c.expectedStatusCode, c.body, rec.Code)
+		}
+	}
+}
+
+func Test_ReportsEveryError_StructTags(t *testing.T) {
+	//set up in-mem db, and tear down after
+	inMemDB = setupDB()
+	defer func() {
+		inMemDB = nil
+	}()
+
+	cases := []struct {
+		handler        http.HandlerFunc
+		method         string
+		body           string
+		expectedErrors validate.Errors
+	}{
+		{setCommentStateHandler, http.MethodPut, "{\"CommentState\":\"closed\",\"CommentsCloseAfterDays\":-1}", validate.Errors{
+			{Field: "CommentState", Message: "CommentState should be one of open or locked"},
+			{Field: "CommentsCloseAfterDays", Message: "CommentsCloseAfterDays should not be negative"},
+		}},
+		{setUserRoleHandler, http.MethodPut, "{\"Role\":\"overlord\"}", validate.Errors{
+			{Field: "Role", Message: "Role should be one of admin, editor, author or commenter"},
+		}},
+		{loginHandler, http.MethodPost, "{\"Username\":\"  \",\"Password\":\"chilidogs\"}", validate.Errors{
+			{Field: "Username", Message: "Username should not be empty"},
+		}},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest(c.method, "/", strings.NewReader(c.body))
+		if err != nil {
+			t.Error(err)
+		}
+
+		c.handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d for %s, got %d", http.StatusBadRequest, c.body, rec.Code)
+		}
+		var actualResponse Response
+		err = json.Unmarshal(rec.Body.Bytes(), &actualResponse)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(actualResponse.Errors, c.expectedErrors) {
+			t.Errorf("Expected errors %#v for %s, got %#v", c.expectedErrors, c.body, actualResponse.Errors)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//the unversioned routes are aliases of /v1, kept until clients have moved over
+var (
+	unversionedDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	unversionedSunsetAt     = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
+//deprecated marks responses of routes that are going away with Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+//and links to where the route moved to, which is its path under successorPrefix
+func deprecated(since, sunset time.Time, successorPrefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", "<"+successorPrefix+req.URL.EscapedPath()+">; rel=\"successor-version\"")
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_Versions(t *testing.T) {
+	server, err := NewServer(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest(http.MethodPost, "/v1/blog", strings.NewReader(`{"Title":"Vib-Ribbon","ArticleText":"Load your own CDs","AuthorName":"Vibri"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if deprecation := rec.Header().Get("Deprecation"); deprecation != "" {
+		t.Errorf("Expected /v1 not to be deprecated, got %s", deprecation)
+	}
+	var created struct {
+		Data CreateBlogPostOrCommentResponse
+	}
+	err = json.Unmarshal(rec.Body.Bytes(), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the unversioned alias sees the same posts
+	rec = httptest.NewRecorder()
+	req, err = http.NewRequest(http.MethodGet, "/blog/"+created.Data.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if deprecation := rec.Header().Get("Deprecation"); deprecation != "@1792281600" {
+		t.Errorf("Expected a Deprecation header, got %q", deprecation)
+	}
+	if sunset := rec.Header().Get("Sunset"); sunset != "Sun, 18 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Expected a Sunset header, got %q", sunset)
+	}
+	if link := rec.Header().Get("Link"); link != "</v1/blog/"+created.Data.ID+">; rel=\"successor-version\"" {
+		t.Errorf("Expected a link to the /v1 route, got %q", link)
+	}
+
+	for _, r := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPut, "/v1/blog", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/health", http.StatusNotFound},
+		{http.MethodGet, "/v2/blog", http.StatusNotFound},
+	} {
+		rec = httptest.NewRecorder()
+		req, err = http.NewRequest(r.method, r.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.ServeHTTP(rec, req)
+		if rec.Code != r.status {
+			t.Errorf("%s %s: expected status code %d, got %d", r.method, r.path, r.status, rec.Code)
+		}
+	}
+}